@@ -1,54 +1,174 @@
 package main
 
 import (
-	"cabinet/src/main/model"
-	"encoding/json"
+	"cabinet/src/main/audit"
+	"cabinet/src/main/auth"
+	"cabinet/src/main/controller"
+	"cabinet/src/main/datasource"
+	"cabinet/src/main/job"
+	"cabinet/src/main/mail"
+	"cabinet/src/main/migrations"
+	"cabinet/src/main/phone"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/service"
+	"cabinet/src/main/storage"
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
-
-	"github.com/google/uuid"
 )
 
+const addrEnv = "CABINET_HTTP_ADDR"
+const defaultAddr = ":8080"
+const shutdownTimeout = 15 * time.Second
+
 func main() {
-	p := &model.Profile{
-		Login:        "",
-		FistName:     "",
-		MiddleName:   "",
-		LastName:     "",
-		PrimaryEmail: "",
-		Email:        nil,
-		Phone:        "",
-		Tags:         nil,
-		Biography:    "",
-		Company:      "",
-		Location:     "",
-		ExternalID:   uuid.UUID{},
-		Avatar:       uuid.UUID{},
-		Metadata:     nil,
-		Attachments:  nil,
-	}
-
-	p.ID = uuid.New()
-	p.Created = time.Now().UTC()
-	p.Changed = time.Now().UTC()
-
-	a := &model.Attachment{
-		Private: false,
-		Tags:    nil,
-		Title:   "",
-		Profile: model.Profile{},
-	}
-
-	a.ID = uuid.New()
-	a.Created = time.Now().UTC()
-	a.Name = "Name"
-	a.Description = "Description"
-	a.S3Key = uuid.New()
-	a.UserID = uuid.New()
-
-	pJson, _ := json.Marshal(p)
-	aJson, _ := json.Marshal(a)
-
-	slog.Info(string(pJson))
-	slog.Info(string(aJson))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:]); err != nil {
+		slog.Error("Cabinet failed", slog.Any("err", err))
+		os.Exit(1)
+	}
+}
+
+// run serves the REST API until ctx is done, or runs `migrate up|down|status`
+func run(ctx context.Context, args []string) error {
+	ds, err := datasource.NewFromEnv(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer ds.Close()
+
+	if err = ds.Ping(ctx); err != nil {
+		return err
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		var command = "up"
+
+		if len(args) > 1 {
+			command = args[1]
+		}
+
+		return migrate(ctx, ds, command)
+	}
+
+	if err = migrate(ctx, ds, "up"); err != nil {
+		return err
+	}
+
+	purgeCfg, err := job.PurgeConfigFromEnv()
+
+	if err != nil {
+		return err
+	}
+
+	stopAudit := audit.NewRecorder(ds).Listen()
+	defer stopAudit()
+
+	blobs, err := storage.NewFromEnv()
+
+	if err != nil {
+		return err
+	}
+
+	// attachments first, purged profiles take their remaining attachments along
+	go job.NewPurger(purgeCfg,
+		service.NewBlobPurger(repository.NewAttachmentRepo(ds), blobs),
+		service.NewBlobPurger(repository.NewProfileRepo(ds), blobs)).Run(ctx)
+
+	mailer, err := mail.NewFromEnv()
+
+	if err != nil {
+		return err
+	}
+
+	var addr = defaultAddr
+
+	if value := os.Getenv(addrEnv); value != "" {
+		addr = value
+	}
+
+	apiCfg, err := controller.ConfigFromEnv()
+
+	if err != nil {
+		return err
+	}
+
+	if !apiCfg.Auth.Enabled() {
+		slog.Warn("Authentication is disabled, every request is anonymous and read only", slog.String("env", auth.IssuerEnv))
+	}
+
+	sender, err := phone.NewSender(apiCfg.Phone)
+
+	if err != nil {
+		return err
+	}
+
+	if sender == nil {
+		slog.Warn("SMS is disabled, phone numbers can not be verified", slog.String("env", phone.BackendEnv))
+	}
+
+	server := controller.NewServer(addr, controller.NewRouter(ds, blobs, mailer, sender, apiCfg))
+	serveErr := make(chan error, 1)
+
+	go func() {
+		slog.Info("Cabinet is listening", slog.String("addr", addr))
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Cabinet is shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return server.Shutdown(shutdownCtx)
+}
+
+func migrate(ctx context.Context, ds *datasource.Datasource, command string) error {
+	migrator, err := migrations.New(ds.Db)
+
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		_, err = migrator.Up(ctx)
+	case "down":
+		_, err = migrator.Down(ctx)
+	case "status":
+		var statuses []migrations.Status
+
+		if statuses, err = migrator.Status(ctx); err == nil {
+			for _, status := range statuses {
+				slog.Info("Migration",
+					slog.Int("version", status.Version),
+					slog.String("name", status.Name),
+					slog.Any("applied", status.Applied),
+					slog.Bool("modified", status.Modified))
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+	}
+
+	return err
 }
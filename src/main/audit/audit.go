@@ -0,0 +1,180 @@
+package audit
+
+import (
+	"bytes"
+	"cabinet/src/main/datasource"
+	"cabinet/src/main/model"
+	modelCommon "cabinet/src/main/model/common"
+	"cabinet/src/main/model/interfaces"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/repository/common"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OpSnapshot baseline entry of an entity that existed before its first audited change
+const OpSnapshot = "snapshot"
+
+// ignoredColumns bookkeeping columns left out of states and diffs, fields tagged audit:"-" are left out too
+var ignoredColumns = map[string]bool{
+	"id": true, "changed": true, "version": true,
+}
+
+type actorKey struct{}
+
+// WithActor ctx attributing changes to the actor profile
+func WithActor(ctx context.Context, actor uuid.UUID) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom actor of ctx, uuid.Nil for system changes
+func ActorFrom(ctx context.Context) uuid.UUID {
+	actor, _ := ctx.Value(actorKey{}).(uuid.UUID)
+	return actor
+}
+
+// Recorder writes users.audit_log entries for changes reported by the model hooks.
+// Entries join the transaction of the change when it runs in Datasource.RunInTx.
+// Bulk statements without an entity value, like purges, are not recorded.
+type Recorder struct {
+	datasource *datasource.Datasource
+	entries    *repository.AuditRepo
+	now        func() time.Time
+}
+
+func NewRecorder(datasource *datasource.Datasource) *Recorder {
+	return &Recorder{datasource: datasource, entries: repository.NewAuditRepo(datasource), now: time.Now}
+}
+
+// Listen records changes until the returned function is called
+func (r *Recorder) Listen() (stop func()) {
+	return modelCommon.OnChange(r.record)
+}
+
+// record diffs the stored entity against the state of its latest entry, unchanged entities,
+// e.g. updates rejected by optimistic locking, are not recorded
+func (r *Recorder) record(ctx context.Context, change modelCommon.Change) error {
+	entity, ok := change.Entity.(interfaces.Identifiable)
+
+	if !ok || entity.GetId() == uuid.Nil {
+		return nil
+	}
+
+	var id = entity.GetId()
+	var previous map[string]json.RawMessage
+
+	latest, err := r.entries.Latest(ctx, change.Model, id)
+
+	switch {
+	case err == nil:
+		previous = latest.State
+	case !errors.Is(err, common.ErrNotFound):
+		return err
+	case change.Stage == modelCommon.BeforeChange:
+		// the entity predates auditing, keep its current state as the base of the diff
+		state, err := r.state(ctx, change.Entity, id)
+
+		if err != nil || len(state) == 0 {
+			return err
+		}
+
+		return r.entries.Append(ctx, r.entry(ctx, change.Model, id, OpSnapshot, nil, state))
+	}
+
+	if change.Stage == modelCommon.BeforeChange {
+		return nil
+	}
+
+	state, err := r.state(ctx, change.Entity, id)
+
+	if err != nil {
+		return err
+	}
+
+	diff := Diff(previous, state)
+
+	if len(diff) == 0 {
+		return nil
+	}
+
+	return r.entries.Append(ctx, r.entry(ctx, change.Model, id, string(change.Operation), diff, state))
+}
+
+func (r *Recorder) entry(ctx context.Context, entityType string, id uuid.UUID, operation string,
+	diff map[string]model.FieldChange, state map[string]json.RawMessage) *model.AuditEntry {
+	if diff == nil {
+		diff = map[string]model.FieldChange{}
+	}
+
+	return &model.AuditEntry{
+		Created:    r.now().UTC(),
+		ActorID:    ActorFrom(ctx),
+		EntityType: entityType,
+		EntityID:   id,
+		Operation:  operation,
+		Diff:       diff,
+		State:      state,
+	}
+}
+
+// state stored columns of the entity row, nil when the row does not exist
+func (r *Recorder) state(ctx context.Context, entity any, id uuid.UUID) (map[string]json.RawMessage, error) {
+	var typ = reflect.TypeOf(entity).Elem()
+	var table = r.datasource.Db.Table(typ)
+	var stored = reflect.New(typ)
+
+	query := r.datasource.IDB(ctx).NewSelect().Model(stored.Interface()).Where("?TableAlias.id = ?", id)
+
+	if table.SoftDeleteField != nil {
+		query = query.WhereAllWithDeleted()
+	}
+
+	if err := query.Scan(ctx); errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var state = make(map[string]json.RawMessage, len(table.Fields))
+
+	for _, field := range table.Fields {
+		if ignoredColumns[field.Name] || field.StructField.Tag.Get("audit") == "-" {
+			continue
+		}
+
+		value, err := json.Marshal(field.Value(stored.Elem()).Interface())
+
+		if err != nil {
+			return nil, err
+		}
+
+		state[field.Name] = value
+	}
+
+	return state, nil
+}
+
+// Diff columns whose JSON values differ between the states, a nil state is a missing entity
+func Diff(before map[string]json.RawMessage, after map[string]json.RawMessage) map[string]model.FieldChange {
+	var diff = map[string]model.FieldChange{}
+
+	for column, value := range after {
+		if old, ok := before[column]; !ok || !bytes.Equal(old, value) {
+			diff[column] = model.FieldChange{Old: old, New: value}
+		}
+	}
+
+	for column, old := range before {
+		if _, ok := after[column]; !ok {
+			diff[column] = model.FieldChange{Old: old}
+		}
+	}
+
+	return diff
+}
@@ -0,0 +1,193 @@
+package audit
+
+import (
+	"cabinet/src/main/datasource"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var auditColumns = []string{"id", "created", "actor_id", "entity_type", "entity_id", "operation", "diff", "state"}
+var attachmentColumns = []string{"id", "created", "deleted_at", "name", "description", "private", "tags", "title", "s3_key", "user_id", "metadata"}
+
+func newRegexpDatasource(t *testing.T) (*datasource.Datasource, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+
+	if err != nil {
+		t.Fatalf("An error was not expected when opening a stub database connection: %s", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	return datasource.NewFromDB(context.Background(), db, datasource.DefaultConfig()), mock
+}
+
+func TestDiff(t *testing.T) {
+	var before = map[string]json.RawMessage{
+		"name":    json.RawMessage(`"old"`),
+		"private": json.RawMessage(`true`),
+		"removed": json.RawMessage(`1`),
+	}
+	var after = map[string]json.RawMessage{
+		"name":    json.RawMessage(`"new"`),
+		"private": json.RawMessage(`true`),
+		"added":   json.RawMessage(`[]`),
+	}
+
+	diff := Diff(before, after)
+
+	assert.Equal(t, map[string]model.FieldChange{
+		"name":    {Old: json.RawMessage(`"old"`), New: json.RawMessage(`"new"`)},
+		"removed": {Old: json.RawMessage(`1`)},
+		"added":   {New: json.RawMessage(`[]`)},
+	}, diff)
+	assert.Empty(t, Diff(after, after))
+	assert.Len(t, Diff(nil, after), 3)
+
+	slog.Info("TestDiff success")
+}
+
+func TestRecorderDelete(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var actor = uuid.New()
+	var attachmentId = uuid.New()
+	var userId = uuid.New()
+	var created = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var deleted = time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	var state = `{"created":"2025-01-01T00:00:00Z","deleted_at":"0001-01-01T00:00:00Z","description":"","metadata":null,` +
+		`"name":"Name","private":true,"s3_key":"` + attachmentId.String() + `","tags":null,"title":"Title","user_id":"` + userId.String() + `"}`
+	var latest = func() *sqlmock.Rows {
+		return mock.NewRows(auditColumns).
+			AddRow(1, created, nil, "attachment", attachmentId, "insert", []byte(`{}`), []byte(state))
+	}
+
+	// before the delete the entity already has history, nothing to snapshot
+	mock.ExpectQuery(`FROM "users"."audit_log" AS "audit" WHERE \("audit".entity_type = 'attachment'\)` +
+		` AND \("audit".entity_id = '` + attachmentId.String() + `'\) ORDER BY "audit".id DESC LIMIT 1`).
+		WillReturnRows(latest())
+	mock.ExpectExec(`UPDATE "users"."attachments" AS "attachment" SET "deleted_at" = `).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM "users"."audit_log" AS "audit"`).
+		WillReturnRows(latest())
+	mock.ExpectQuery(`FROM "users"."attachments" AS "attachment" WHERE \("attachment".id = '` + attachmentId.String() + `'\)$`).
+		WillReturnRows(mock.NewRows(attachmentColumns).
+			AddRow(attachmentId, created, deleted, "Name", "", true, nil, "Title", attachmentId, userId, nil))
+	mock.ExpectQuery(`INSERT INTO "users"."audit_log" .* VALUES \(DEFAULT, '.*', '` + actor.String() + `', 'attachment', '` +
+		attachmentId.String() + `', 'delete', '\{"deleted_at":\{"old":"0001-01-01T00:00:00Z","new":"2025-01-02T00:00:00Z"\}\}', '.*'\) RETURNING "id"`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(2))
+
+	var stop = NewRecorder(ds).Listen()
+
+	err := repository.NewAttachmentRepo(ds).Delete(WithActor(context.Background(), actor), attachmentId)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// stopped recorder leaves changes unaudited
+	stop()
+
+	mock.ExpectExec(`UPDATE "users"."attachments" AS "attachment" SET "deleted_at" = `).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repository.NewAttachmentRepo(ds).Delete(context.Background(), attachmentId)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestRecorderDelete success")
+}
+
+func TestRecorderSnapshot(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var attachmentId = uuid.New()
+	var userId = uuid.New()
+	var created = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// entity predating the audit log gets a baseline snapshot before its first change
+	mock.ExpectQuery(`FROM "users"."audit_log" AS "audit"`).
+		WillReturnRows(mock.NewRows(auditColumns))
+	mock.ExpectQuery(`FROM "users"."attachments" AS "attachment" WHERE \("attachment".id = '` + attachmentId.String() + `'\)$`).
+		WillReturnRows(mock.NewRows(attachmentColumns).
+			AddRow(attachmentId, created, nil, "Name", "", true, nil, "Title", attachmentId, userId, nil))
+	mock.ExpectQuery(`INSERT INTO "users"."audit_log" .* VALUES \(DEFAULT, '.*', DEFAULT, 'attachment', '` +
+		attachmentId.String() + `', 'snapshot', '\{\}', '\{"created":"2025-01-01T00:00:00Z",.*"title":"Title".*\}'\) RETURNING "id"`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(`UPDATE "users"."attachments" AS "attachment" SET "deleted_at" = `).
+		WillReturnError(context.DeadlineExceeded)
+
+	var stop = NewRecorder(ds).Listen()
+	defer stop()
+
+	err := repository.NewAttachmentRepo(ds).Delete(context.Background(), attachmentId)
+
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestRecorderSnapshot success")
+}
+
+func TestRecorderSecrets(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var profileId = uuid.New()
+	var created = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var expires = created.Add(10 * time.Minute)
+
+	var phone = &model.PhoneVerification{ProfileID: profileId, Phone: "+4915112345678", CodeHash: "code-hash", Expires: expires}
+	phone.ID = uuid.New()
+	phone.Created = created
+	var email = &model.EmailVerification{ProfileID: profileId, Email: "john@smith.com", TokenHash: "token-hash", Expires: expires, Primary: true}
+	email.ID = uuid.New()
+	email.Created = created
+
+	// the hashes are stored but never reach the audit log
+	mock.ExpectQuery(`INSERT INTO "users"."phone_verifications" .*'code-hash'`).
+		WillReturnRows(mock.NewRows([]string{"consumed"}).AddRow(nil))
+	mock.ExpectQuery(`FROM "users"."audit_log" AS "audit"`).
+		WillReturnRows(mock.NewRows(auditColumns))
+	mock.ExpectQuery(`FROM "users"."phone_verifications" AS "phone_verification" WHERE \("phone_verification".id = '` + phone.ID.String() + `'\)$`).
+		WillReturnRows(mock.NewRows([]string{"id", "created", "profile_id", "phone", "code_hash", "expires", "attempts", "consumed"}).
+			AddRow(phone.ID, created, profileId, phone.Phone, "code-hash", expires, 0, nil))
+	mock.ExpectQuery(`INSERT INTO "users"."audit_log" .* VALUES \(DEFAULT, '.*', DEFAULT, 'phone_verification', '` + phone.ID.String() + `', 'insert', ` +
+		`'\{"attempts":\{[^}]*\},"consumed":\{[^}]*\},"created":\{[^}]*\},"expires":\{[^}]*\},"phone":\{[^}]*\},"profile_id":\{[^}]*\}\}', ` +
+		`'\{"attempts":0,"consumed":"0001-01-01T00:00:00Z","created":"2025-01-01T00:00:00Z","expires":"2025-01-01T00:10:00Z",` +
+		`"phone":"\+4915112345678","profile_id":"` + profileId.String() + `"\}'\) RETURNING "id"`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`INSERT INTO "users"."email_verifications" .*'token-hash'`).
+		WillReturnRows(mock.NewRows([]string{"consumed"}).AddRow(nil))
+	mock.ExpectQuery(`FROM "users"."audit_log" AS "audit"`).
+		WillReturnRows(mock.NewRows(auditColumns))
+	mock.ExpectQuery(`FROM "users"."email_verifications" AS "verification" WHERE \("verification".id = '` + email.ID.String() + `'\)$`).
+		WillReturnRows(mock.NewRows([]string{"id", "created", "profile_id", "email", "token_hash", "expires", "consumed", "is_primary"}).
+			AddRow(email.ID, created, profileId, email.Email, "token-hash", expires, nil, true))
+	mock.ExpectQuery(`INSERT INTO "users"."audit_log" .* VALUES \(DEFAULT, '.*', DEFAULT, 'email_verification', '` + email.ID.String() + `', 'insert', ` +
+		`'\{"consumed":\{[^}]*\},"created":\{[^}]*\},"email":\{[^}]*\},"expires":\{[^}]*\},"is_primary":\{[^}]*\},"profile_id":\{[^}]*\}\}', ` +
+		`'\{"consumed":"0001-01-01T00:00:00Z","created":"2025-01-01T00:00:00Z","email":"john@smith.com",` +
+		`"expires":"2025-01-01T00:10:00Z","is_primary":true,"profile_id":"` + profileId.String() + `"\}'\) RETURNING "id"`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(2))
+
+	var stop = NewRecorder(ds).Listen()
+	defer stop()
+
+	_, err := ds.Db.NewInsert().Model(phone).Exec(context.Background())
+
+	assert.NoError(t, err)
+
+	_, err = ds.Db.NewInsert().Model(email).Exec(context.Background())
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestRecorderSecrets success")
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"cabinet/src/main/model"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Environment variables read by ConfigFromEnv
+const (
+	IssuerEnv   = "CABINET_OIDC_ISSUER"
+	AudienceEnv = "CABINET_OIDC_AUDIENCE"
+	JWKSURLEnv  = "CABINET_OIDC_JWKS_URL"
+	RefreshEnv  = "CABINET_OIDC_JWKS_REFRESH"
+)
+
+// AdminRole realm role allowed to read and change every profile
+const AdminRole = "admin"
+
+// keycloakCertsPath JWKS endpoint relative to a Keycloak realm issuer
+const keycloakCertsPath = "/protocol/openid-connect/certs"
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// signingMethods asymmetric algorithms accepted, HMAC and none are always rejected
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// Config OIDC provider settings, an empty Issuer disables authentication
+type Config struct {
+	Issuer     string        // e.g. https://keycloak/realms/cabinet
+	Audience   string        // required aud, or azp for Keycloak access tokens, when set
+	JWKSURL    string        // Keycloak certs endpoint of the issuer when empty
+	Refresh    time.Duration // JWKS cache lifetime
+	MinRefresh time.Duration // minimal pause between refreshes for unknown kids
+	Leeway     time.Duration // clock skew tolerated in exp, nbf and iat
+}
+
+func DefaultConfig() Config {
+	return Config{Refresh: time.Hour, MinRefresh: time.Minute, Leeway: 30 * time.Second}
+}
+
+// ConfigFromEnv DefaultConfig overridden by the CABINET_OIDC_* environment variables
+func ConfigFromEnv() (Config, error) {
+	var cfg = DefaultConfig()
+
+	cfg.Issuer = strings.TrimSuffix(os.Getenv(IssuerEnv), "/")
+	cfg.Audience = os.Getenv(AudienceEnv)
+	cfg.JWKSURL = os.Getenv(JWKSURLEnv)
+
+	if value, ok := os.LookupEnv(RefreshEnv); ok {
+		refresh, err := time.ParseDuration(value)
+
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", RefreshEnv, err)
+		}
+
+		cfg.Refresh = refresh
+	}
+
+	return cfg, nil
+}
+
+// Enabled reports whether tokens are verified at all
+func (c Config) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// Claims OIDC claims of a Keycloak access or id token
+type Claims struct {
+	jwt.RegisteredClaims
+	AuthorizedParty   string `json:"azp,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+	Name              string `json:"name,omitempty"`
+	GivenName         string `json:"given_name,omitempty"`
+	FamilyName        string `json:"family_name,omitempty"`
+	RealmAccess       struct {
+		Roles []string `json:"roles,omitempty"`
+	} `json:"realm_access,omitempty"`
+}
+
+// ExternalID subject as the Keycloak user id stored in Profile.ExternalID
+func (c *Claims) ExternalID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+// HasRole reports whether the realm role is granted
+func (c *Claims) HasRole(role string) bool {
+	for _, granted := range c.RealmAccess.Roles {
+		if granted == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier validates signature, issuer, audience and lifetime of bearer tokens
+type Verifier struct {
+	cfg    Config
+	keys   *KeySet
+	parser *jwt.Parser
+}
+
+func NewVerifier(cfg Config, client *http.Client) *Verifier {
+	var jwksURL = cfg.JWKSURL
+
+	if jwksURL == "" {
+		jwksURL = cfg.Issuer + keycloakCertsPath
+	}
+
+	var parser = jwt.NewParser(
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithLeeway(cfg.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt())
+
+	return &Verifier{cfg: cfg, keys: NewKeySet(jwksURL, client, cfg.Refresh, cfg.MinRefresh), parser: parser}
+}
+
+// Verify parsed claims of a valid token, errors wrap ErrInvalidToken unless the JWKS is unavailable
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	var claims = &Claims{}
+	var keysErr error
+
+	_, err := v.parser.ParseWithClaims(token, claims, func(parsed *jwt.Token) (any, error) {
+		kid, _ := parsed.Header["kid"].(string)
+		key, err := v.keys.Key(ctx, kid)
+
+		if err != nil && !errors.Is(err, ErrUnknownKey) {
+			keysErr = err
+		}
+
+		return key, err
+	})
+
+	if keysErr != nil {
+		return nil, keysErr
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if v.cfg.Audience != "" && !claims.hasAudience(v.cfg.Audience) {
+		return nil, fmt.Errorf("%w: audience %q not granted", ErrInvalidToken, v.cfg.Audience)
+	}
+
+	if _, err = claims.ExternalID(); err != nil {
+		return nil, fmt.Errorf("%w: subject: %w", ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
+
+// hasAudience Keycloak access tokens name the client in azp, aud lists resource servers
+func (c *Claims) hasAudience(audience string) bool {
+	if c.AuthorizedParty == audience {
+		return true
+	}
+
+	for _, granted := range c.Audience {
+		if granted == audience {
+			return true
+		}
+	}
+
+	return false
+}
+
+type claimsKey struct{}
+type profileKey struct{}
+
+// WithClaims ctx of an authenticated request
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFrom claims of the request, nil when anonymous
+func ClaimsFrom(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*Claims)
+	return claims
+}
+
+// WithProfile ctx carrying the profile of the caller
+func WithProfile(ctx context.Context, profile *model.Profile) context.Context {
+	return context.WithValue(ctx, profileKey{}, profile)
+}
+
+// ProfileFrom profile of the caller, nil when anonymous or not provisioned
+func ProfileFrom(ctx context.Context) *model.Profile {
+	profile, _ := ctx.Value(profileKey{}).(*model.Profile)
+	return profile
+}
+
+// Viewer caller an authorization decision is made for, the zero Viewer is anonymous
+type Viewer struct {
+	ID    uuid.UUID // profile of the caller
+	Admin bool      // AdminRole granted by the token
+}
+
+func (v Viewer) IsAnonymous() bool {
+	return v.ID == uuid.Nil
+}
+
+// ViewerFrom viewer of the request, anonymous without a resolved profile
+func ViewerFrom(ctx context.Context) Viewer {
+	var profile = ProfileFrom(ctx)
+
+	if profile == nil {
+		return Viewer{}
+	}
+
+	var claims = ClaimsFrom(ctx)
+
+	return Viewer{ID: profile.ID, Admin: claims != nil && claims.HasRole(AdminRole)}
+}
+
+// BearerToken token of the Authorization header, empty when absent
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
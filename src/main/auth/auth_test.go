@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const testIssuer = "https://keycloak.test/realms/cabinet"
+
+// testProvider serves the JWKS of its current keys and counts the fetches
+type testProvider struct {
+	keys    map[string]any
+	fetches atomic.Int32
+	server  *httptest.Server
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	var provider = &testProvider{keys: map[string]any{}}
+
+	provider.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provider.fetches.Add(1)
+
+		var keys []map[string]string
+
+		for kid, key := range provider.keys {
+			switch key := key.(type) {
+			case *rsa.PrivateKey:
+				keys = append(keys, map[string]string{"kty": "RSA", "kid": kid, "use": "sig",
+					"n": encodeInt(key.N), "e": encodeInt(big.NewInt(int64(key.E)))})
+			case *ecdsa.PrivateKey:
+				keys = append(keys, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256",
+					"x": encodeInt(key.X), "y": encodeInt(key.Y)})
+			}
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+
+	t.Cleanup(provider.server.Close)
+
+	return provider
+}
+
+func (p *testProvider) addRSA(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	p.keys[kid] = key
+}
+
+func (p *testProvider) verifier() *Verifier {
+	var cfg = DefaultConfig()
+	cfg.Issuer = testIssuer
+	cfg.Audience = "cabinet"
+	cfg.JWKSURL = p.server.URL
+	cfg.MinRefresh = 0
+
+	return NewVerifier(cfg, p.server.Client())
+}
+
+func encodeInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+func newTestClaims() *Claims {
+	var now = time.Now()
+	var claims = &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Subject:   uuid.New().String(),
+			Audience:  jwt.ClaimStrings{"account"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+		AuthorizedParty:   "cabinet",
+		PreferredUsername: "jsmith",
+		Email:             "john@smith.com",
+	}
+	claims.RealmAccess.Roles = []string{"admin"}
+	return claims
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims *Claims) string {
+	var token = jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+
+	return signed
+}
+
+func TestVerifyToken(t *testing.T) {
+	var provider = newTestProvider(t)
+	provider.addRSA(t, "rsa1")
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	provider.keys["ec1"] = ecKey
+
+	var verifier = provider.verifier()
+	var ctx = context.Background()
+
+	var claims = newTestClaims()
+	verified, err := verifier.Verify(ctx, sign(t, jwt.SigningMethodRS256, provider.keys["rsa1"], "rsa1", claims))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "jsmith", verified.PreferredUsername)
+	assert.True(t, verified.HasRole("admin"))
+
+	externalID, err := verified.ExternalID()
+	assert.NoError(t, err)
+	assert.Equal(t, claims.Subject, externalID.String())
+
+	_, err = verifier.Verify(ctx, sign(t, jwt.SigningMethodES256, ecKey, "ec1", newTestClaims()))
+	assert.NoError(t, err)
+
+	var expired = newTestClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+
+	var foreign = newTestClaims()
+	foreign.Issuer = "https://evil.test"
+
+	var otherClient = newTestClaims()
+	otherClient.AuthorizedParty = "other"
+
+	var notUser = newTestClaims()
+	notUser.Subject = "service-account"
+
+	for name, token := range map[string]string{
+		"expired":  sign(t, jwt.SigningMethodRS256, provider.keys["rsa1"], "rsa1", expired),
+		"issuer":   sign(t, jwt.SigningMethodRS256, provider.keys["rsa1"], "rsa1", foreign),
+		"audience": sign(t, jwt.SigningMethodRS256, provider.keys["rsa1"], "rsa1", otherClient),
+		"subject":  sign(t, jwt.SigningMethodRS256, provider.keys["rsa1"], "rsa1", notUser),
+		"hmac":     sign(t, jwt.SigningMethodHS256, []byte("secret"), "rsa1", newTestClaims()),
+		"none":     sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "rsa1", newTestClaims()),
+		"kid":      sign(t, jwt.SigningMethodRS256, provider.keys["rsa1"], "unknown", newTestClaims()),
+		"garbage":  "not.a.token",
+	} {
+		_, err = verifier.Verify(ctx, token)
+		assert.ErrorIs(t, err, ErrInvalidToken, name)
+	}
+
+	slog.Info("TestVerifyToken success")
+}
+
+func TestKeyRotation(t *testing.T) {
+	var provider = newTestProvider(t)
+	provider.addRSA(t, "old")
+
+	var verifier = provider.verifier()
+	var ctx = context.Background()
+	var now = time.Now()
+	verifier.keys.now = func() time.Time { return now }
+	verifier.keys.minRefresh = time.Minute
+
+	_, err := verifier.Verify(ctx, sign(t, jwt.SigningMethodRS256, provider.keys["old"], "old", newTestClaims()))
+	assert.NoError(t, err)
+
+	_, err = verifier.Verify(ctx, sign(t, jwt.SigningMethodRS256, provider.keys["old"], "old", newTestClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), provider.fetches.Load())
+
+	// the provider rotates, the new kid triggers a refresh once MinRefresh passed
+	provider.addRSA(t, "new")
+	delete(provider.keys, "old")
+
+	var rotated = sign(t, jwt.SigningMethodRS256, provider.keys["new"], "new", newTestClaims())
+
+	_, err = verifier.Verify(ctx, rotated)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, int32(1), provider.fetches.Load())
+
+	now = now.Add(time.Minute)
+
+	_, err = verifier.Verify(ctx, rotated)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), provider.fetches.Load())
+
+	// cached keys survive an unreachable provider
+	provider.server.Close()
+	now = now.Add(2 * time.Hour)
+
+	_, err = verifier.Verify(ctx, rotated)
+	assert.NoError(t, err)
+
+	slog.Info("TestKeyRotation success")
+}
+
+func TestBearerToken(t *testing.T) {
+	for header, expected := range map[string]string{
+		"Bearer abc":   "abc",
+		"bearer  abc ": "abc",
+		"Basic abc":    "",
+		"":             "",
+	} {
+		var r = httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", header)
+		assert.Equal(t, expected, BearerToken(r), header)
+	}
+
+	slog.Info("TestBearerToken success")
+}
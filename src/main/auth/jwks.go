@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// maxJWKSBytes limit of a JWKS response
+const maxJWKSBytes = 1 << 20
+
+// jwk public key of a JWKS document, private members are ignored
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// KeySet signing keys fetched from a JWKS endpoint. Keys are refreshed once the cache
+// expires, and earlier when a token names an unknown kid, at most once per MinRefresh.
+// Stale keys stay in use while the endpoint is unreachable.
+type KeySet struct {
+	url        string
+	client     *http.Client
+	refresh    time.Duration
+	minRefresh time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]any
+	fetched time.Time
+}
+
+func NewKeySet(url string, client *http.Client, refresh time.Duration, minRefresh time.Duration) *KeySet {
+	return &KeySet{url: url, client: client, refresh: refresh, minRefresh: minRefresh, now: time.Now}
+}
+
+// Key public key with the kid, *rsa.PublicKey or *ecdsa.PublicKey
+func (k *KeySet) Key(ctx context.Context, kid string) (any, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var now = k.now()
+	key, known := k.keys[kid]
+	var expired = now.Sub(k.fetched) >= k.refresh
+	var rotated = !known && now.Sub(k.fetched) >= k.minRefresh
+
+	if expired || rotated {
+		keys, err := k.fetch(ctx)
+
+		switch {
+		case err == nil:
+			k.keys, k.fetched = keys, now
+			key, known = keys[kid]
+		case k.keys == nil:
+			return nil, err
+		default:
+			slog.Warn("Refreshing JWKS failed, using cached keys", slog.String("url", k.url), slog.Any("err", err))
+		}
+	}
+
+	if !known {
+		return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+	}
+
+	return key, nil
+}
+
+func (k *KeySet) fetch(ctx context.Context) (map[string]any, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := k.client.Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS %s: status %d", k.url, response.StatusCode)
+	}
+
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err = json.NewDecoder(http.MaxBytesReader(nil, response.Body, maxJWKSBytes)).Decode(&document); err != nil {
+		return nil, fmt.Errorf("JWKS %s: %w", k.url, err)
+	}
+
+	var keys = make(map[string]any, len(document.Keys))
+
+	for _, key := range document.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		public, err := key.publicKey()
+
+		if err != nil {
+			slog.Warn("Skipping JWKS key", slog.String("kid", key.Kid), slog.Any("err", err))
+			continue
+		}
+
+		keys[key.Kid] = public
+	}
+
+	return keys, nil
+}
+
+func (j jwk) publicKey() (any, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeInt(j.N)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeInt(j.E)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent out of range")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+
+		x, err := decodeInt(j.X)
+
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeInt(j.Y)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(decoded) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+
+	return new(big.Int).SetBytes(decoded), nil
+}
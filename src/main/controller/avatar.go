@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"cabinet/src/main/auth"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/service"
+	"cabinet/src/main/storage"
+	"cabinet/src/main/view/profile"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// avatarMaxAge client cache lifetime of avatar renditions, revalidated by ETag afterwards
+const avatarMaxAge = "public, max-age=300"
+
+// AvatarController REST resource /profiles/{id}/avatar, avatars are public, changes are guarded by the policy
+type AvatarController struct {
+	profiles repository.IProfileRepository
+	avatars  *service.AvatarService
+	policy   service.Policy
+}
+
+func NewAvatarController(profiles repository.IProfileRepository, avatars *service.AvatarService, policy service.Policy) *AvatarController {
+	return &AvatarController{profiles: profiles, avatars: avatars, policy: policy}
+}
+
+func (c *AvatarController) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /profiles/{id}/avatar", c.get)
+	mux.HandleFunc("PUT /profiles/{id}/avatar", c.replace)
+	mux.HandleFunc("DELETE /profiles/{id}/avatar", c.delete)
+}
+
+// get serves the rendition covering the size parameter, the original when size is omitted
+func (c *AvatarController) get(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseId(w, r)
+
+	if !ok {
+		return
+	}
+
+	var size = service.OriginalSize
+
+	if value := r.URL.Query().Get("size"); value != "" {
+		parsed, err := strconv.Atoi(value)
+
+		if err != nil || parsed < 0 {
+			writeError(w, http.StatusBadRequest, MsgBadRequest, "size: must be a non-negative integer")
+			return
+		}
+
+		size = parsed
+	}
+
+	content, info, err := c.avatars.Open(r.Context(), id, size)
+
+	if err != nil {
+		writeAvatarError(w, err)
+		return
+	}
+
+	defer content.Close()
+
+	var tag = strconv.Quote(info.ETag)
+
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Cache-Control", avatarMaxAge)
+
+	if r.Header.Get("If-None-Match") == tag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err = io.Copy(w, content); err != nil {
+		slog.Error("Writing avatar failed", slog.Any("err", err))
+	}
+}
+
+// replace takes the image as the raw request body, the Content-Type header must match its content
+func (c *AvatarController) replace(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseId(w, r)
+
+	if !ok {
+		return
+	}
+
+	found, err := c.find(r, id, service.ActionWrite)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	if !ifMatch(r, found.Version) {
+		writeError(w, http.StatusPreconditionFailed, MsgPrecondition)
+		return
+	}
+
+	if err = c.avatars.Replace(r.Context(), found, r.Body, r.Header.Get("Content-Type")); err != nil {
+		writeAvatarError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(found.Version))
+	writeResult(w, http.StatusOK, profile.FromProfile(found, true))
+}
+
+func (c *AvatarController) delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseId(w, r)
+
+	if !ok {
+		return
+	}
+
+	found, err := c.find(r, id, service.ActionDelete)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	if !ifMatch(r, found.Version) {
+		writeError(w, http.StatusPreconditionFailed, MsgPrecondition)
+		return
+	}
+
+	if err = c.avatars.Remove(r.Context(), found); err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// find profile the caller may change the avatar of
+func (c *AvatarController) find(r *http.Request, id uuid.UUID, action service.Action) (*model.Profile, error) {
+	found, err := c.profiles.FindById(r.Context(), id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = service.Authorize(c.policy, auth.ViewerFrom(r.Context()), action, found); err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// writeAvatarError maps image validation and storage errors, others as writeRepoError
+func writeAvatarError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUnsupportedImage):
+		writeError(w, http.StatusUnsupportedMediaType, MsgUnsupportedMedia, err.Error())
+	case errors.Is(err, service.ErrImageTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, MsgTooLarge, err.Error())
+	case errors.Is(err, service.ErrInvalidImage):
+		writeError(w, http.StatusBadRequest, MsgInvalidImage, err.Error())
+	case errors.Is(err, storage.ErrNotFound):
+		writeError(w, http.StatusNotFound, MsgNotFound)
+	default:
+		writeRepoError(w, err)
+	}
+}
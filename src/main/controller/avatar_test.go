@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"bytes"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/repotest"
+	"cabinet/src/main/service"
+	"cabinet/src/main/storage"
+	"cabinet/src/main/view/common"
+	"cabinet/src/main/view/profile"
+	"encoding/json"
+	"image"
+	"image/gif"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newAvatarTestServer(repo *repotest.Profiles, blobs storage.BlobStore) *httptest.Server {
+	var mux = http.NewServeMux()
+	NewAvatarController(repo, service.NewAvatarService(repo, blobs, service.DefaultImageLimits()), service.DefaultPolicy()).Register(mux)
+	return httptest.NewServer(withTestViewer(mux))
+}
+
+func TestAvatarLifecycle(t *testing.T) {
+	var stored = newTestProfile("avatar")
+	var blobs = storage.NewMemoryStore()
+	var repo = repotest.NewProfiles(stored)
+	var server = newAvatarTestServer(repo, blobs)
+	defer server.Close()
+
+	var url = server.URL + "/profiles/" + stored.ID.String() + "/avatar"
+	var encoded bytes.Buffer
+	assert.NoError(t, png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 300, 200))))
+
+	resp, _ := doRequest(t, http.MethodGet, url, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodPut, url, encoded.String(), "Content-Type", "image/png")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodPut, url, encoded.String(), "Content-Type", "image/png", "Authorization", bearer(newTestProfile("other")))
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Empty(t, blobs.Keys())
+
+	resp, body := doRequest(t, http.MethodPut, url, encoded.String(), "Content-Type", "image/png", "If-Match", `"0"`, "Authorization", bearer(stored))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"1"`, resp.Header.Get("ETag"))
+
+	var result common.ResultDto[profile.ProfileDto]
+	assert.NoError(t, json.Unmarshal(body, &result))
+	assert.NotNil(t, result.Result.Avatar)
+	assert.Len(t, blobs.Keys(), len(service.AvatarSizes)+1)
+
+	// the profile as updated
+	var updated = repo.Last("Update")[0].(model.Profile)
+	updated.Version++
+	repo.Profiles = []*model.Profile{&updated}
+
+	resp, body = doRequest(t, http.MethodGet, url+"?size=100", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+
+	thumbnail, err := png.Decode(bytes.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 128, 128), thumbnail.Bounds())
+
+	resp, _ = doRequest(t, http.MethodGet, url+"?size=100", "", "If-None-Match", resp.Header.Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	resp, body = doRequest(t, http.MethodGet, url, "")
+	original, err := png.Decode(bytes.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 300, 200), original.Bounds())
+
+	resp, _ = doRequest(t, http.MethodGet, url+"?size=large", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var gifData bytes.Buffer
+	assert.NoError(t, gif.Encode(&gifData, image.NewGray(image.Rect(0, 0, 100, 100)), nil))
+
+	resp, _ = doRequest(t, http.MethodPut, url, gifData.String(), "Content-Type", "image/gif", "Authorization", bearer(stored))
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodDelete, url, "", "If-Match", `"0"`, "Authorization", bearer(stored))
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodDelete, url, "", "Authorization", bearer(stored))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Empty(t, blobs.Keys())
+
+	resp, _ = doRequest(t, http.MethodGet, url, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	slog.Info("TestAvatarLifecycle success")
+}
@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"cabinet/src/main/auth"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/service"
+	"cabinet/src/main/view/profile"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// EmailController REST resources of profile addresses and their confirmation, see service.EmailVerifier
+// and service.ProfileService. Owners manage the addresses of their profile, the mailed token alone confirms one.
+type EmailController struct {
+	profiles repository.IProfileRepository
+	verifier *service.EmailVerifier
+	emails   *service.ProfileService
+	policy   service.Policy
+}
+
+func NewEmailController(profiles repository.IProfileRepository, verifier *service.EmailVerifier, emails *service.ProfileService, policy service.Policy) *EmailController {
+	return &EmailController{profiles: profiles, verifier: verifier, emails: emails, policy: policy}
+}
+
+func (c *EmailController) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /profiles/{id}/email/verification", c.pending)
+	mux.HandleFunc("POST /profiles/{id}/email/verification", c.request)
+	mux.HandleFunc("POST /email/verify", c.confirm)
+	mux.HandleFunc("GET /profiles/{id}/emails", c.list)
+	mux.HandleFunc("POST /profiles/{id}/emails", c.add)
+	mux.HandleFunc("DELETE /profiles/{id}/emails/{emailId}", c.remove)
+	mux.HandleFunc("POST /profiles/{id}/emails/{emailId}/verification", c.verify)
+	mux.HandleFunc("POST /profiles/{id}/emails/{emailId}/primary", c.primary)
+}
+
+// pending address waiting for its confirmation, 404 when there is none
+func (c *EmailController) pending(w http.ResponseWriter, r *http.Request) {
+	found, ok := c.find(w, r)
+
+	if !ok {
+		return
+	}
+
+	pending, err := c.verifier.Pending(r.Context(), found.ID)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	if pending == nil {
+		writeError(w, http.StatusNotFound, MsgNotFound)
+		return
+	}
+
+	writeResult(w, http.StatusOK, profile.FromVerification(pending))
+}
+
+// request mails a new token, also for the current unverified address. 204 when it is verified already.
+func (c *EmailController) request(w http.ResponseWriter, r *http.Request) {
+	found, ok := c.find(w, r)
+
+	if !ok {
+		return
+	}
+
+	var request = &profile.EmailVerificationRequest{}
+
+	if !decodeBody(w, r, request) {
+		return
+	}
+
+	verification, err := c.verifier.Request(r.Context(), found, request.Email)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	if verification == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeResult(w, http.StatusAccepted, profile.FromVerification(verification))
+}
+
+// confirm makes the address of the token the verified primary email, the caller may be anonymous
+func (c *EmailController) confirm(w http.ResponseWriter, r *http.Request) {
+	var request = &profile.ConfirmEmailRequest{}
+
+	if !decodeBody(w, r, request) {
+		return
+	}
+
+	confirmed, err := c.verifier.Confirm(r.Context(), request.Token)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	writeResult(w, http.StatusOK, profile.ShortFromProfile(confirmed))
+}
+
+// list addresses of the profile, the primary one first
+func (c *EmailController) list(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseId(w, r)
+
+	if !ok {
+		return
+	}
+
+	emails, err := c.emails.Emails(r.Context(), id)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	writeResult(w, http.StatusOK, profile.FromEmails(emails))
+}
+
+// add secondary address, its verification is mailed
+func (c *EmailController) add(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseId(w, r)
+
+	if !ok {
+		return
+	}
+
+	var request = &profile.AddEmailRequest{}
+
+	if !decodeBody(w, r, request) {
+		return
+	}
+
+	added, err := c.emails.AddEmail(r.Context(), id, request.Email)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	writeResult(w, http.StatusCreated, profile.FromEmail(added))
+}
+
+// remove secondary address, 409 for the primary one
+func (c *EmailController) remove(w http.ResponseWriter, r *http.Request) {
+	id, emailID, ok := parseEmailId(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := c.emails.RemoveEmail(r.Context(), id, emailID); err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verify mails a new token for the address, 204 when it is verified already
+func (c *EmailController) verify(w http.ResponseWriter, r *http.Request) {
+	id, emailID, ok := parseEmailId(w, r)
+
+	if !ok {
+		return
+	}
+
+	verification, err := c.emails.VerifyEmail(r.Context(), id, emailID)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	if verification == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeResult(w, http.StatusAccepted, profile.FromVerification(verification))
+}
+
+// primary makes a verified address the primary email, 409 while it is unverified
+func (c *EmailController) primary(w http.ResponseWriter, r *http.Request) {
+	id, emailID, ok := parseEmailId(w, r)
+
+	if !ok {
+		return
+	}
+
+	address, err := c.emails.MakePrimary(r.Context(), id, emailID)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	writeResult(w, http.StatusOK, profile.FromEmail(address))
+}
+
+// find profile the viewer may change
+func (c *EmailController) find(w http.ResponseWriter, r *http.Request) (*model.Profile, bool) {
+	return findWritable(w, r, c.profiles, c.policy)
+}
+
+// findWritable profile of the path the viewer may change, writes the error response otherwise
+func findWritable(w http.ResponseWriter, r *http.Request, profiles repository.IProfileRepository, policy service.Policy) (*model.Profile, bool) {
+	id, ok := parseId(w, r)
+
+	if !ok {
+		return nil, false
+	}
+
+	found, err := profiles.FindById(r.Context(), id)
+
+	if err == nil {
+		err = service.Authorize(policy, auth.ViewerFrom(r.Context()), service.ActionWrite, found)
+	}
+
+	if err != nil {
+		writeRepoError(w, err)
+		return nil, false
+	}
+
+	return found, true
+}
+
+// parseEmailId profile and address ids of the path, writes 400 when either is malformed
+func parseEmailId(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	id, ok := parseId(w, r)
+
+	if !ok {
+		return uuid.UUID{}, uuid.UUID{}, false
+	}
+
+	emailID, err := uuid.Parse(r.PathValue("emailId"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, MsgInvalidId, err.Error())
+		return uuid.UUID{}, uuid.UUID{}, false
+	}
+
+	return id, emailID, true
+}
@@ -0,0 +1,294 @@
+package controller
+
+import (
+	"cabinet/src/main/mail"
+	"cabinet/src/main/model"
+	repoCommon "cabinet/src/main/repository/common"
+	"cabinet/src/main/view/common"
+	"cabinet/src/main/view/profile"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var tokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// mailedToken token of the latest verification mail
+func mailedToken(t *testing.T, mailer *mail.MemoryMailer, to string) string {
+	message, ok := mailer.Last()
+
+	assert.True(t, ok)
+	assert.Equal(t, to, message.To)
+
+	match := tokenPattern.FindStringSubmatch(message.Body)
+
+	if !assert.NotNil(t, match, message.Body) {
+		return ""
+	}
+
+	return match[1]
+}
+
+func TestEmailVerification(t *testing.T) {
+	var stored = newTestProfile("login1")
+	var other = newTestProfile("login2")
+	var server = newTestServer(stored, other)
+	defer server.Close()
+
+	server.emails.Emails = []*model.ProfileEmail{{ProfileID: other.ID, Email: "login2@smith.com", Primary: true}}
+
+	var profileURL = server.URL + "/profiles/" + stored.ID.String()
+	var result common.ResultDto[profile.ProfileDto]
+	var errorDto common.ErrorDto
+
+	// updates that are not stored mail nothing
+	resp, _ := doRequest(t, http.MethodPatch, profileURL, `{"primaryEmail": "new@smith.com", "phone": "call me"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	server.profiles.Fail("Update", &repoCommon.UniqueViolationError{Field: "Login", Constraint: "profiles_login_key"})
+
+	resp, _ = doRequest(t, http.MethodPatch, profileURL, `{"primaryEmail": "new@smith.com", "login": "login2"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Empty(t, server.mailer.Sent())
+
+	// a new address is mailed a confirmation, the profile keeps the old one until it is confirmed
+	resp, body := doRequest(t, http.MethodPatch, profileURL, `{"primaryEmail": "New@Smith.com", "company": "Acme"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &result))
+	assert.Equal(t, "login1@smith.com", result.Result.PrimaryEmail)
+	assert.Nil(t, result.Result.Verified)
+
+	var updated = server.profiles.Last("Update")[0].(model.Profile)
+	var requested = server.verifications.Last("Create")[0].(model.EmailVerification)
+
+	assert.Equal(t, "Acme", updated.Company)
+	assert.Equal(t, "login1@smith.com", updated.PrimaryEmail)
+	assert.Equal(t, "new@smith.com", requested.Email)
+	assert.True(t, requested.Primary)
+
+	var token = mailedToken(t, server.mailer, "new@smith.com")
+
+	// a pending address is not mailed again
+	server.verifications.Pending = &requested
+
+	resp, _ = doRequest(t, http.MethodPatch, profileURL, `{"primaryEmail": "new@smith.com"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, server.mailer.Sent(), 1)
+
+	// only viewers who may change the profile see the pending address
+	_, body = doRequest(t, http.MethodGet, profileURL, "", "Authorization", bearer(stored))
+
+	assert.Contains(t, string(body), `"pendingEmail":"new@smith.com"`)
+
+	_, body = doRequest(t, http.MethodGet, profileURL, "", "Authorization", bearer(other))
+
+	assert.NotContains(t, string(body), "new@smith.com")
+
+	resp, body = doRequest(t, http.MethodGet, profileURL+"/email/verification", "", "Authorization", bearer(stored))
+
+	var pending common.ResultDto[profile.EmailVerificationDto]
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &pending))
+	assert.Equal(t, "new@smith.com", pending.Result.Email)
+	assert.Equal(t, requested.Expires, pending.Result.Expires)
+
+	resp, _ = doRequest(t, http.MethodGet, profileURL+"/email/verification", "", "Authorization", bearer(other))
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// tokens confirm once, the caller may be anonymous
+	resp, body = doRequest(t, http.MethodPost, server.URL+"/email/verify", `{"token": "forged"}`)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, MsgInvalidToken, errorDto.Message)
+
+	var confirmed = *stored
+	confirmed.PrimaryEmail = "new@smith.com"
+	confirmed.EmailVerified = time.Now().UTC()
+	server.verifications.Confirmed = &confirmed
+
+	resp, body = doRequest(t, http.MethodPost, server.URL+"/email/verify", `{"token": "`+token+`"}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `"login":"login1"`)
+	assert.Equal(t, requested.TokenHash, server.verifications.Last("Confirm")[0])
+
+	server.verifications.Pending = nil
+
+	resp, _ = doRequest(t, http.MethodGet, profileURL+"/email/verification", "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// explicit requests, verified addresses are not mailed again and taken ones are refused
+	stored.PrimaryEmail, stored.EmailVerified = confirmed.PrimaryEmail, confirmed.EmailVerified
+
+	resp, _ = doRequest(t, http.MethodPost, profileURL+"/email/verification", `{"email": "new@smith.com"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, body = doRequest(t, http.MethodPost, profileURL+"/email/verification", `{"email": "login2@smith.com"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, []string{"PrimaryEmail"}, errorDto.Details)
+	assert.Len(t, server.mailer.Sent(), 1)
+
+	resp, _ = doRequest(t, http.MethodPost, profileURL+"/email/verification", `{"email": "first@smith.com"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.NotEmpty(t, mailedToken(t, server.mailer, "first@smith.com"))
+
+	resp, _ = doRequest(t, http.MethodPost, profileURL+"/email/verification", `{"email": "john"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodPost, profileURL+"/email/verification", `{"email": "third@smith.com"}`)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Len(t, server.verifications.Calls("Create"), 2)
+
+	// removing the address needs no confirmation
+	resp, _ = doRequest(t, http.MethodPatch, profileURL, `{"primaryEmail": ""}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, server.profiles.Last("Update")[0].(model.Profile).PrimaryEmail)
+	assert.True(t, server.profiles.Last("Update")[0].(model.Profile).EmailVerified.IsZero())
+
+	slog.Info("TestEmailVerification success")
+}
+
+func TestProfileEmails(t *testing.T) {
+	var stored = newTestProfile("login1")
+	var other = newTestProfile("login2")
+	var server = newTestServer(stored, other)
+	defer server.Close()
+
+	var primary = &model.ProfileEmail{ProfileID: stored.ID, Email: "login1@smith.com", Primary: true}
+	primary.ID = uuid.New()
+	var foreign = &model.ProfileEmail{ProfileID: other.ID, Email: "login2@smith.com", Primary: true}
+	foreign.ID = uuid.New()
+
+	server.emails.Emails = []*model.ProfileEmail{primary, foreign}
+
+	var emailsURL = server.URL + "/profiles/" + stored.ID.String() + "/emails"
+	var added common.ResultDto[profile.EmailDto]
+	var listed common.ResultDto[[]profile.EmailDto]
+	var errorDto common.ErrorDto
+
+	// added addresses are unverified until their mailed token is confirmed
+	resp, body := doRequest(t, http.MethodPost, emailsURL, `{"email": "John@Acme.com"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &added))
+	assert.Equal(t, "john@acme.com", added.Result.Email)
+	assert.Nil(t, added.Result.Verified)
+	assert.False(t, added.Result.Primary)
+	assert.Equal(t, "john@acme.com", server.emails.Last("Create")[0].(model.ProfileEmail).Email)
+	assert.False(t, server.verifications.Last("Create")[0].(model.EmailVerification).Primary)
+	assert.NotEmpty(t, mailedToken(t, server.mailer, "john@acme.com"))
+
+	var address = &model.ProfileEmail{ProfileID: stored.ID, Email: added.Result.Email}
+	address.ID = added.Result.ID
+	server.emails.Emails = append(server.emails.Emails, address)
+
+	var addedURL = emailsURL + "/" + address.ID.String()
+
+	resp, body = doRequest(t, http.MethodPost, emailsURL, `{"email": "LOGIN2@smith.com"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, []string{"Email"}, errorDto.Details)
+
+	resp, _ = doRequest(t, http.MethodPost, emailsURL, `{"email": "doe"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodPost, emailsURL, `{"email": "jdoe@acme.com"}`, "Authorization", bearer(other))
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Len(t, server.emails.Calls("Create"), 1)
+
+	resp, body = doRequest(t, http.MethodPost, addedURL+"/primary", "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, MsgUnverifiedEmail, errorDto.Message)
+
+	// verified addresses are not mailed again and become primary
+	address.Verified = time.Now().UTC()
+
+	resp, _ = doRequest(t, http.MethodPost, addedURL+"/verification", "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, body = doRequest(t, http.MethodPost, addedURL+"/primary", "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &added))
+	assert.True(t, added.Result.Primary)
+	assert.NotNil(t, added.Result.Verified)
+	assert.Equal(t, "john@acme.com", server.profiles.Last("Update")[0].(model.Profile).PrimaryEmail)
+
+	resp, body = doRequest(t, http.MethodGet, emailsURL, "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &listed))
+	assert.Len(t, listed.Result, 2)
+	assert.Equal(t, "login1@smith.com", listed.Result[0].Email)
+	assert.Equal(t, "john@acme.com", listed.Result[1].Email)
+
+	// profiles show their addresses
+	stored.Emails = []*model.ProfileEmail{address}
+
+	_, body = doRequest(t, http.MethodGet, server.URL+"/profiles/"+stored.ID.String(), "", "Authorization", bearer(stored))
+
+	assert.Contains(t, string(body), `"emails":[{"id":"`+address.ID.String())
+
+	// an unverified primary address is mailed a new primary token
+	resp, _ = doRequest(t, http.MethodPost, emailsURL+"/"+primary.ID.String()+"/verification", "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.NotEmpty(t, mailedToken(t, server.mailer, "login1@smith.com"))
+	assert.True(t, server.verifications.Last("Create")[0].(model.EmailVerification).Primary)
+
+	// the primary address is kept, addresses of other profiles are not found
+	resp, body = doRequest(t, http.MethodDelete, emailsURL+"/"+primary.ID.String(), "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, MsgPrimaryEmail, errorDto.Message)
+
+	resp, _ = doRequest(t, http.MethodDelete, emailsURL+"/"+foreign.ID.String(), "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodDelete, emailsURL+"/invalid", "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Empty(t, server.emails.Calls("Delete"))
+
+	resp, _ = doRequest(t, http.MethodDelete, addedURL, "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, []any{address.ID}, server.emails.Last("Delete"))
+
+	resp, body = doRequest(t, http.MethodGet, server.URL+"/profiles/"+other.ID.String()+"/emails", "", "Authorization", bearer(other))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &listed))
+	assert.Len(t, listed.Result, 1)
+
+	slog.Info("TestProfileEmails success")
+}
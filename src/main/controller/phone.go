@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"cabinet/src/main/repository"
+	"cabinet/src/main/service"
+	"cabinet/src/main/view/profile"
+	"net/http"
+)
+
+// PhoneController REST resources confirming the phone of a profile by a texted code, see service.PhoneVerifier.
+// Owners verify the number of their profile, 503 while SMS is disabled.
+type PhoneController struct {
+	profiles repository.IProfileRepository
+	verifier *service.PhoneVerifier
+	policy   service.Policy
+}
+
+func NewPhoneController(profiles repository.IProfileRepository, verifier *service.PhoneVerifier, policy service.Policy) *PhoneController {
+	return &PhoneController{profiles: profiles, verifier: verifier, policy: policy}
+}
+
+func (c *PhoneController) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /profiles/{id}/phone/verification", c.request)
+	mux.HandleFunc("POST /profiles/{id}/phone/verify", c.confirm)
+}
+
+// request texts a new code to the number of the profile, 204 when it is verified already
+func (c *PhoneController) request(w http.ResponseWriter, r *http.Request) {
+	found, ok := findWritable(w, r, c.profiles, c.policy)
+
+	if !ok {
+		return
+	}
+
+	verification, err := c.verifier.Request(r.Context(), found)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	if verification == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeResult(w, http.StatusAccepted, profile.FromPhoneVerification(verification))
+}
+
+// confirm marks the number verified when the code matches, wrong codes are 400
+func (c *PhoneController) confirm(w http.ResponseWriter, r *http.Request) {
+	found, ok := findWritable(w, r, c.profiles, c.policy)
+
+	if !ok {
+		return
+	}
+
+	var request = &profile.ConfirmPhoneRequest{}
+
+	if !decodeBody(w, r, request) {
+		return
+	}
+
+	confirmed, err := c.verifier.Confirm(r.Context(), found, request.Code)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(confirmed.Version))
+	writeResult(w, http.StatusOK, profile.FromProfile(confirmed, true))
+}
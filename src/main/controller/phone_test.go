@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"cabinet/src/main/model"
+	"cabinet/src/main/phone"
+	repoCommon "cabinet/src/main/repository/common"
+	"cabinet/src/main/service"
+	"cabinet/src/main/view/common"
+	"cabinet/src/main/view/profile"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+var codePattern = regexp.MustCompile(`\b([0-9]{6})\b`)
+
+// textedCode code of the latest verification SMS
+func textedCode(t *testing.T, sender *phone.MemorySender, to string) string {
+	message, ok := sender.Last()
+
+	assert.True(t, ok)
+	assert.Equal(t, to, message.To)
+
+	match := codePattern.FindStringSubmatch(message.Body)
+
+	if !assert.NotNil(t, match, message.Body) {
+		return ""
+	}
+
+	return match[1]
+}
+
+func TestProfilePhone(t *testing.T) {
+	var stored = newTestProfile("login1")
+	var server = newTestServer(stored)
+	defer server.Close()
+
+	var dto common.ResultDto[*profile.ProfileDto]
+
+	// stored normalized, shown as typed
+	resp, body := doRequest(t, http.MethodPatch, server.URL+"/profiles/"+stored.ID.String(), `{"phone": "(202) 555-0143"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &dto))
+	assert.Equal(t, "(202) 555-0143", dto.Result.Phone)
+	assert.Equal(t, "+12025550143", dto.Result.PhoneNumber)
+	assert.Nil(t, dto.Result.PhoneVerified)
+	assert.Equal(t, "+12025550143", server.profiles.Last("Update")[0].(model.Profile).PhoneE164)
+
+	resp, body = doRequest(t, http.MethodPatch, server.URL+"/profiles/"+stored.ID.String(), `{"phone": "call me"}`, "Authorization", bearer(stored))
+
+	var errorDto common.ErrorDto
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, MsgValidation, errorDto.Message)
+	assert.Equal(t, []string{"phone: phone"}, errorDto.Details)
+
+	resp, _ = doRequest(t, http.MethodPost, server.URL+"/profiles", `{"login": "login2", "phone": "555"}`, "Authorization", adminToken)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Len(t, server.profiles.Calls("Update"), 1)
+	assert.Empty(t, server.profiles.Calls("Create"))
+
+	// searched by the normalized number however it is typed, only among profiles the viewer may read
+	resp, _ = doRequest(t, http.MethodGet, server.URL+"/profiles?phone=%2B1%20202-555-0143", "")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var db = bun.NewDB(&sql.DB{}, pgdialect.New())
+	var filter = server.profiles.Last("FindPage")[0].(repoCommon.Filter)
+	var listed = filter(db.NewSelect().Model((*model.Profile)(nil)).Column("id")).String()
+
+	assert.Contains(t, listed, `phone_e164 = '+12025550143'`)
+	assert.Contains(t, listed, "private IS FALSE")
+
+	resp, _ = doRequest(t, http.MethodGet, server.URL+"/profiles?phone=nobody", "")
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// only the owner verifies the number
+	stored.Phone, stored.PhoneE164 = "(202) 555-0143", "+12025550143"
+
+	var other = newTestProfile("other")
+
+	resp, _ = doRequest(t, http.MethodPost, server.URL+"/profiles/"+stored.ID.String()+"/phone/verification", "", "Authorization", bearer(other))
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	var verification common.ResultDto[*profile.PhoneVerificationDto]
+
+	resp, body = doRequest(t, http.MethodPost, server.URL+"/profiles/"+stored.ID.String()+"/phone/verification", "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &verification))
+	assert.Equal(t, "+12025550143", verification.Result.Phone)
+
+	var issued = server.phones.Last("Create")[0].(model.PhoneVerification)
+
+	// codes are not resent right away
+	server.phones.Fail("Create", service.ErrTooFrequent)
+
+	resp, body = doRequest(t, http.MethodPost, server.URL+"/profiles/"+stored.ID.String()+"/phone/verification", "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, MsgTooFrequent, errorDto.Message)
+	assert.Len(t, server.sender.Sent(), 1)
+
+	var code = textedCode(t, server.sender, "+12025550143")
+	var wrong = "000000"
+
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	server.phones.Pending = &issued
+
+	resp, body = doRequest(t, http.MethodPost, server.URL+"/profiles/"+stored.ID.String()+"/phone/verify", `{"code": "`+wrong+`"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, MsgInvalidToken, errorDto.Message)
+	assert.Len(t, server.phones.Calls("Attempt"), 1)
+
+	var confirmed = *stored
+	confirmed.PhoneVerified = time.Now().UTC()
+	server.phones.Confirmed = &confirmed
+
+	resp, body = doRequest(t, http.MethodPost, server.URL+"/profiles/"+stored.ID.String()+"/phone/verify", `{"code": "`+code+`"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &dto))
+	assert.NotNil(t, dto.Result.PhoneVerified)
+	assert.NotEmpty(t, resp.Header.Get("ETag"))
+
+	// single use
+	server.phones.Pending = nil
+
+	resp, _ = doRequest(t, http.MethodPost, server.URL+"/profiles/"+stored.ID.String()+"/phone/verify", `{"code": "`+code+`"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	stored.PhoneVerified = confirmed.PhoneVerified
+
+	resp, _ = doRequest(t, http.MethodPost, server.URL+"/profiles/"+stored.ID.String()+"/phone/verification", "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Len(t, server.sender.Sent(), 1)
+
+	// the same number typed differently stays verified, another one does not
+	resp, body = doRequest(t, http.MethodPatch, server.URL+"/profiles/"+stored.ID.String(), `{"phone": "202.555.0143"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &dto))
+	assert.NotNil(t, dto.Result.PhoneVerified)
+
+	resp, body = doRequest(t, http.MethodPatch, server.URL+"/profiles/"+stored.ID.String(), `{"phone": "+44 20 7946 0958"}`, "Authorization", bearer(stored))
+
+	dto = common.ResultDto[*profile.ProfileDto]{}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &dto))
+	assert.Equal(t, "+442079460958", dto.Result.PhoneNumber)
+	assert.Nil(t, dto.Result.PhoneVerified)
+
+	resp, _ = doRequest(t, http.MethodPatch, server.URL+"/profiles/"+stored.ID.String(), `{"phone": ""}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, server.profiles.Last("Update")[0].(model.Profile).PhoneE164)
+
+	stored.Phone, stored.PhoneE164, stored.PhoneVerified = "", "", time.Time{}
+
+	resp, body = doRequest(t, http.MethodPost, server.URL+"/profiles/"+stored.ID.String()+"/phone/verification", "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, MsgNoPhone, errorDto.Message)
+
+	slog.Info("TestProfilePhone success")
+}
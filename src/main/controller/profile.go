@@ -0,0 +1,457 @@
+package controller
+
+import (
+	"cabinet/src/main/auth"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository"
+	repoCommon "cabinet/src/main/repository/common"
+	"cabinet/src/main/service"
+	"cabinet/src/main/view/common"
+	"cabinet/src/main/view/profile"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const defaultPageSize = 20
+const maxPageSize = 100
+
+// ProfileController REST resource /profiles, the policy guards private fields and changes.
+// New primary emails are stored once the verifier confirmed them, phones are stored normalized as well.
+type ProfileController struct {
+	profiles repository.IProfileRepository
+	cursors  *common.CursorCodec
+	policy   service.Policy
+	verifier *service.EmailVerifier
+	phones   *service.PhoneVerifier
+}
+
+func NewProfileController(profiles repository.IProfileRepository, cursors *common.CursorCodec, policy service.Policy, verifier *service.EmailVerifier, phones *service.PhoneVerifier) *ProfileController {
+	return &ProfileController{profiles: profiles, cursors: cursors, policy: policy, verifier: verifier, phones: phones}
+}
+
+func (c *ProfileController) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /profiles", c.list)
+	mux.HandleFunc("POST /profiles", c.create)
+	mux.HandleFunc("GET /profiles/search", c.search)
+	mux.HandleFunc("GET /profiles/{id}", c.get)
+	mux.HandleFunc("PUT /profiles/{id}", c.replace)
+	mux.HandleFunc("PATCH /profiles/{id}", c.patch)
+	mux.HandleFunc("DELETE /profiles/{id}", c.delete)
+}
+
+// list pages by page number, or by opaque cursor when the cursor parameter is present.
+// filter=field:op:value and sort=-field narrow and order the listing, cursor pages keep the creation order.
+// phone matches the normalized number however it is typed.
+func (c *ProfileController) list(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, ok := parsePage(w, r)
+
+	if !ok {
+		return
+	}
+
+	spec, err := repoCommon.ParseSpec(r.URL.Query())
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, MsgInvalidFilter, err.Error())
+		return
+	}
+
+	var keyset = r.URL.Query().Has("cursor")
+
+	if keyset && len(spec.Orders) > 0 {
+		writeError(w, http.StatusBadRequest, MsgInvalidFilter, "sort is not supported with cursor")
+		return
+	}
+
+	filter, err := c.filter(r, spec)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, MsgInvalidFilter, err.Error())
+		return
+	}
+
+	if keyset {
+		c.listKeyset(w, r, filter, pageSize)
+		return
+	}
+
+	paged, err := c.profiles.FindPage(r.Context(), filter, page, pageSize)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	if !common.IsValidPagination(&paged.Pageable) {
+		writeError(w, http.StatusBadRequest, MsgInvalidPage)
+		return
+	}
+
+	dtos := profile.FromProfiles(paged.Entities, c.detailed(r))
+
+	writeJSON(w, http.StatusOK, common.NewPaged(dtos, paged.Pageable).Result())
+}
+
+func (c *ProfileController) listKeyset(w http.ResponseWriter, r *http.Request, filter repoCommon.Filter, pageSize uint) {
+	cursor, err := c.cursors.Decode(r.URL.Query().Get("cursor"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, MsgInvalidCursor)
+		return
+	}
+
+	page, err := c.profiles.FindKeyset(r.Context(), filter, cursor, pageSize)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	dtos := profile.FromProfiles(page.Entities, c.detailed(r))
+
+	writeJSON(w, http.StatusOK, common.BuildCursorPage(dtos, page.Next, page.Prev, pageSize, c.cursors))
+}
+
+// search ranks profiles matching the q parameter
+func (c *ProfileController) search(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, ok := parsePage(w, r)
+
+	if !ok {
+		return
+	}
+
+	var query = strings.TrimSpace(r.URL.Query().Get("q"))
+
+	if query == "" {
+		writeError(w, http.StatusBadRequest, MsgBadRequest, "q: must not be empty")
+		return
+	}
+
+	paged, err := c.profiles.Search(r.Context(), query, page, pageSize)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	if !common.IsValidPagination(&paged.Pageable) {
+		writeError(w, http.StatusBadRequest, MsgInvalidPage)
+		return
+	}
+
+	dtos := profile.FromMatches(paged.Entities, c.detailed(r))
+
+	writeJSON(w, http.StatusOK, common.NewPaged(dtos, paged.Pageable).Result())
+}
+
+func (c *ProfileController) get(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseId(w, r)
+
+	if !ok {
+		return
+	}
+
+	found, err := c.profiles.FindById(r.Context(), id)
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	var dto = profile.FromProfile(found, c.detailed(r)(found))
+
+	if c.policy.Can(auth.ViewerFrom(r.Context()), service.ActionWrite, found) {
+		c.withPending(r, dto)
+	}
+
+	w.Header().Set("ETag", etag(found.Version))
+	writeResult(w, http.StatusOK, dto)
+}
+
+func (c *ProfileController) create(w http.ResponseWriter, r *http.Request) {
+	var request = &profile.CreateProfileRequest{}
+
+	if !decodeBody(w, r, request) {
+		return
+	}
+
+	created := request.ToModel()
+
+	err := service.Authorize(c.policy, auth.ViewerFrom(r.Context()), service.ActionCreate, created)
+
+	if err == nil {
+		err = c.phones.Apply(created)
+	}
+
+	if email := request.RequestedEmail(); err == nil && email != "" {
+		err = c.verifier.Available(r.Context(), uuid.Nil, email)
+	}
+
+	if err == nil {
+		err = c.profiles.Create(r.Context(), created)
+	}
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	c.mail(r, created, request.RequestedEmail())
+
+	w.Header().Set("Location", "/profiles/"+created.ID.String())
+	w.Header().Set("ETag", etag(created.Version))
+	writeResult(w, http.StatusCreated, c.withPending(r, profile.FromProfile(created, true)))
+}
+
+func (c *ProfileController) replace(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseId(w, r)
+
+	if !ok {
+		return
+	}
+
+	var request = &profile.CreateProfileRequest{}
+
+	if !decodeBody(w, r, request) {
+		return
+	}
+
+	c.update(w, r, id, request.ApplyTo, request.RequestedEmail())
+}
+
+func (c *ProfileController) patch(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseId(w, r)
+
+	if !ok {
+		return
+	}
+
+	var request = &profile.UpdateProfileRequest{}
+
+	if !decodeBody(w, r, request) {
+		return
+	}
+
+	c.update(w, r, id, request.ApplyTo, request.RequestedEmail())
+}
+
+// update applies the request to the stored profile, internal columns are kept, a new email is mailed once
+// the profile is stored. An If-Match header must carry the current ETag, concurrent updates fail with 412 either way.
+func (c *ProfileController) update(w http.ResponseWriter, r *http.Request, id uuid.UUID, apply func(p *model.Profile), email string) {
+	found, err := c.profiles.FindById(r.Context(), id)
+
+	if err == nil {
+		err = service.Authorize(c.policy, auth.ViewerFrom(r.Context()), service.ActionWrite, found)
+	}
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	if !ifMatch(r, found.Version) {
+		writeError(w, http.StatusPreconditionFailed, MsgPrecondition)
+		return
+	}
+
+	email, err = c.pendingEmail(r, found, email)
+
+	if err == nil {
+		apply(found)
+		err = c.phones.Apply(found)
+	}
+
+	if err == nil {
+		err = c.profiles.Update(r.Context(), found)
+	}
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	c.mail(r, found, email)
+
+	w.Header().Set("ETag", etag(found.Version))
+	writeResult(w, http.StatusOK, c.withPending(r, profile.FromProfile(found, true)))
+}
+
+func (c *ProfileController) delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseId(w, r)
+
+	if !ok {
+		return
+	}
+
+	found, err := c.profiles.FindById(r.Context(), id)
+
+	if err == nil {
+		err = service.Authorize(c.policy, auth.ViewerFrom(r.Context()), service.ActionDelete, found)
+	}
+
+	if err == nil {
+		err = c.profiles.Delete(r.Context(), id)
+	}
+
+	if err != nil {
+		writeRepoError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pendingEmail address to mail a confirmation once the profile is stored, empty when the email is unchanged
+// or pending already. Addresses of other profiles fail like EmailVerifier.Available.
+func (c *ProfileController) pendingEmail(r *http.Request, found *model.Profile, email string) (string, error) {
+	if email == "" || strings.EqualFold(email, found.PrimaryEmail) {
+		return "", nil
+	}
+
+	pending, err := c.verifier.Pending(r.Context(), found.ID)
+
+	if err != nil {
+		return "", err
+	}
+
+	if pending != nil && strings.EqualFold(pending.Email, email) {
+		return "", nil
+	}
+
+	return email, c.verifier.Available(r.Context(), found.ID, email)
+}
+
+// mail sends the confirmation of a new primary email of the stored profile, a failed mail is resent
+// through the verification resource
+func (c *ProfileController) mail(r *http.Request, stored *model.Profile, email string) {
+	if email == "" || strings.EqualFold(email, stored.PrimaryEmail) {
+		return
+	}
+
+	if _, err := c.verifier.Request(r.Context(), stored, email); err != nil {
+		slog.Warn("Requesting email verification failed", slog.String("profile", stored.ID.String()), slog.Any("err", err))
+	}
+}
+
+// withPending adds the address waiting for its confirmation, a failed lookup only leaves it out
+func (c *ProfileController) withPending(r *http.Request, dto *profile.ProfileDto) *profile.ProfileDto {
+	pending, err := c.verifier.Pending(r.Context(), dto.ID)
+
+	if err != nil {
+		slog.Warn("Finding pending email verification failed", slog.String("profile", dto.ID.String()), slog.Any("err", err))
+	}
+
+	if pending != nil {
+		dto.PendingEmail = pending.Email
+	}
+
+	return dto
+}
+
+// filter translates the spec and the phone parameter, conditions and sorts on private fields only match
+// profiles the viewer may read
+func (c *ProfileController) filter(r *http.Request, spec *repoCommon.Spec) (repoCommon.Filter, error) {
+	filter, err := c.profiles.Filter(spec)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if r.URL.Query().Has("phone") {
+		number, err := c.phones.Number(r.URL.Query().Get("phone"))
+
+		if err != nil {
+			return nil, fmt.Errorf("phone: %w", err)
+		}
+
+		return repoCommon.And(c.policy.Readable(auth.ViewerFrom(r.Context()), "id"), repository.WithPhone(number), filter), nil
+	}
+
+	for _, field := range spec.Fields() {
+		if !slices.Contains(repository.ProfileCardColumns, field) {
+			return repoCommon.And(c.policy.Readable(auth.ViewerFrom(r.Context()), "id"), filter), nil
+		}
+	}
+
+	return filter, nil
+}
+
+// detailed decides by the policy whether the caller may read the private fields of a profile
+func (c *ProfileController) detailed(r *http.Request) profile.Detailed {
+	var viewer = auth.ViewerFrom(r.Context())
+
+	return func(found *model.Profile) bool {
+		return c.policy.Can(viewer, service.ActionRead, found)
+	}
+}
+
+// viewerId profile id of the caller, uuid.Nil for anonymous requests
+func viewerId(r *http.Request) uuid.UUID {
+	if viewer := auth.ProfileFrom(r.Context()); viewer != nil {
+		return viewer.ID
+	}
+	return uuid.Nil
+}
+
+// etag strong entity tag of a profile version
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// ifMatch reports whether the If-Match header, when present, lists the version or *
+func ifMatch(r *http.Request, version int64) bool {
+	header := r.Header.Get("If-Match")
+
+	if header == "" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "*" || tag == etag(version) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseId(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, MsgInvalidId, err.Error())
+		return uuid.UUID{}, false
+	}
+
+	return id, true
+}
+
+// parsePage reads page (zero based) and pageSize query parameters
+func parsePage(w http.ResponseWriter, r *http.Request) (uint, uint, bool) {
+	var page, pageSize uint64 = 0, defaultPageSize
+	var err error
+
+	if value := r.URL.Query().Get("page"); value != "" {
+		if page, err = strconv.ParseUint(value, 10, 32); err != nil {
+			writeError(w, http.StatusBadRequest, MsgInvalidPage, "page: "+err.Error())
+			return 0, 0, false
+		}
+	}
+
+	if value := r.URL.Query().Get("pageSize"); value != "" {
+		if pageSize, err = strconv.ParseUint(value, 10, 32); err != nil || pageSize == 0 || pageSize > maxPageSize {
+			writeError(w, http.StatusBadRequest, MsgInvalidPage, "pageSize: must be between 1 and "+strconv.Itoa(maxPageSize))
+			return 0, 0, false
+		}
+	}
+
+	return uint(page), uint(pageSize), true
+}
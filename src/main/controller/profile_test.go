@@ -0,0 +1,548 @@
+package controller
+
+import (
+	"cabinet/src/main/auth"
+	"cabinet/src/main/mail"
+	"cabinet/src/main/model"
+	"cabinet/src/main/phone"
+	repoCommon "cabinet/src/main/repository/common"
+	"cabinet/src/main/repository/repotest"
+	"cabinet/src/main/service"
+	"cabinet/src/main/view/common"
+	"cabinet/src/main/view/profile"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+func newTestProfile(login string) *model.Profile {
+	var p = &model.Profile{Login: login, PrimaryEmail: login + "@smith.com", FistName: "John"}
+	p.ID = uuid.New()
+	return p
+}
+
+// adminToken Authorization header of a test admin, test profiles authenticate with bearer
+const adminToken = "Bearer admin"
+
+func bearer(p *model.Profile) string {
+	return "Bearer " + p.ID.String()
+}
+
+// withTestViewer authenticates test requests by the profile id in the bearer token
+func withTestViewer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token = auth.BearerToken(r)
+		var viewer = &model.Profile{}
+		var claims = &auth.Claims{}
+
+		switch id, err := uuid.Parse(token); {
+		case token == "admin":
+			viewer.ID = uuid.New()
+			claims.RealmAccess.Roles = []string{auth.AdminRole}
+		case err == nil:
+			viewer.ID = id
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithProfile(auth.WithClaims(r.Context(), claims), viewer)))
+	})
+}
+
+// testServer profile, email and phone routes over fake repositories, the mailer and sender keep the
+// verification messages, numbers default to the US
+type testServer struct {
+	*httptest.Server
+	profiles      *repotest.Profiles
+	emails        *repotest.Emails
+	verifications *repotest.EmailVerifications
+	phones        *repotest.PhoneVerifications
+	mailer        *mail.MemoryMailer
+	sender        *phone.MemorySender
+}
+
+func newTestServer(profiles ...*model.Profile) *testServer {
+	var server = &testServer{
+		profiles:      repotest.NewProfiles(profiles...),
+		emails:        repotest.NewEmails(),
+		verifications: &repotest.EmailVerifications{},
+		phones:        &repotest.PhoneVerifications{},
+		mailer:        mail.NewMemoryMailer("cabinet@example.com"),
+		sender:        phone.NewMemorySender(),
+	}
+
+	var mux = http.NewServeMux()
+	var policy = service.DefaultPolicy()
+	var cfg = service.VerificationConfig{URL: "https://cabinet.example.com/verify", TTL: time.Hour}
+	var verifier = service.NewEmailVerifier(server.verifications, server.emails, server.mailer, cfg)
+	var parser, _ = phone.NewParser("US")
+	var phones = service.NewPhoneVerifier(server.phones, parser, server.sender, service.DefaultPhoneConfig())
+
+	NewProfileController(server.profiles, common.NewCursorCodec([]byte("secret")), policy, verifier, phones).Register(mux)
+	NewEmailController(server.profiles, verifier, service.NewProfileService(server.profiles, server.emails, verifier, policy), policy).Register(mux)
+	NewPhoneController(server.profiles, phones, policy).Register(mux)
+
+	server.Server = httptest.NewServer(withTestViewer(mux))
+
+	return server
+}
+
+// doRequest sends the request with headers given as name, value pairs
+func doRequest(t *testing.T, method string, url string, body string, headers ...string) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NoError(t, err)
+
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	return resp, content
+}
+
+func TestGetProfile(t *testing.T) {
+	var stored = newTestProfile("login1")
+	var hidden = newTestProfile("login2")
+	hidden.Private = true
+	hidden.Phone = "+100000000"
+
+	var server = newTestServer(stored, hidden)
+	defer server.Close()
+
+	resp, body := doRequest(t, http.MethodGet, server.URL+"/profiles/"+stored.ID.String(), "")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result common.ResultDto[profile.ProfileDto]
+
+	assert.NoError(t, json.Unmarshal(body, &result))
+	assert.Equal(t, stored.ID, result.Result.ID)
+	assert.Equal(t, "login1", result.Result.Login)
+
+	assert.Equal(t, stored.PrimaryEmail, result.Result.PrimaryEmail)
+
+	resp, body = doRequest(t, http.MethodGet, server.URL+"/profiles/"+hidden.ID.String(), "")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, string(body), hidden.PrimaryEmail)
+	assert.NotContains(t, string(body), hidden.Phone)
+	assert.NotContains(t, string(body), "externalId")
+
+	for _, token := range []string{bearer(hidden), adminToken} {
+		resp, body = doRequest(t, http.MethodGet, server.URL+"/profiles/"+hidden.ID.String(), "", "Authorization", token)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, string(body), hidden.Phone, token)
+	}
+
+	resp, body = doRequest(t, http.MethodGet, server.URL+"/profiles/"+hidden.ID.String(), "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, string(body), hidden.Phone)
+
+	resp, body = doRequest(t, http.MethodGet, server.URL+"/profiles/"+uuid.New().String(), "")
+
+	var errorDto common.ErrorDto
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, uint16(http.StatusNotFound), errorDto.Code)
+	assert.Equal(t, MsgNotFound, errorDto.Message)
+
+	resp, body = doRequest(t, http.MethodGet, server.URL+"/profiles/not-uuid", "")
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, MsgInvalidId, errorDto.Message)
+
+	slog.Info("TestGetProfile success")
+}
+
+func TestListProfiles(t *testing.T) {
+	var server = newTestServer()
+	defer server.Close()
+
+	server.profiles.Listed = []*model.Profile{newTestProfile("login1"), newTestProfile("login2")}
+
+	resp, body := doRequest(t, http.MethodGet, server.URL+"/profiles?page=1&pageSize=1", "")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []any{uint(1), uint(1)}, server.profiles.Last("FindPage")[1:])
+
+	var paged common.PagedResult[profile.ProfileDto]
+
+	assert.NoError(t, json.Unmarshal(body, &paged))
+	assert.Equal(t, 2, len(paged.ResultDto.Entities))
+	assert.Equal(t, "login2", paged.ResultDto.Entities[1].Login)
+	assert.Equal(t, uint64(2), paged.ResultDto.Pageable.Total)
+
+	resp, _ = doRequest(t, http.MethodGet, server.URL+"/profiles", "")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []any{uint(0), uint(defaultPageSize)}, server.profiles.Last("FindPage")[1:])
+
+	// pages past the total
+	resp, _ = doRequest(t, http.MethodGet, server.URL+"/profiles?page=2&pageSize=1", "")
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodGet, server.URL+"/profiles?pageSize=1000", "")
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Len(t, server.profiles.Calls("FindPage"), 3)
+
+	slog.Info("TestListProfiles success")
+}
+
+func TestListProfilesFiltered(t *testing.T) {
+	var server = newTestServer()
+	defer server.Close()
+
+	// private fields only match profiles the viewer may read
+	var db = bun.NewDB(&sql.DB{}, pgdialect.New())
+	var listed = func() string {
+		var filter = server.profiles.Last("FindPage")[0].(repoCommon.Filter)
+		return filter(db.NewSelect().Model((*model.Profile)(nil)).Column("id")).String()
+	}
+
+	resp, _ := doRequest(t, http.MethodGet, server.URL+"/profiles?filter=company:eq:Acme&filter=tags:contains:go,sql&sort=-created", "")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, listed(), "private IS FALSE")
+	assert.Contains(t, listed(), "company")
+
+	var viewer = newTestProfile("viewer")
+
+	resp, _ = doRequest(t, http.MethodGet, server.URL+"/profiles?filter=company:eq:Acme", "", "Authorization", bearer(viewer))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, listed(), viewer.ID.String())
+
+	resp, _ = doRequest(t, http.MethodGet, server.URL+"/profiles?filter=company:eq:Acme", "", "Authorization", adminToken)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, listed(), "private IS FALSE")
+
+	resp, _ = doRequest(t, http.MethodGet, server.URL+"/profiles?filter=login:eq:john&sort=last_name", "")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, listed(), "private IS FALSE")
+
+	for _, query := range []string{
+		"filter=company",
+		"filter=primary_email:eq:user@example.com",
+		"filter=private:like:true",
+		"filter=created:gt:yesterday",
+		"sort=tags",
+		"cursor=&sort=login",
+	} {
+		resp, body := doRequest(t, http.MethodGet, server.URL+"/profiles?"+query, "")
+
+		var errorDto common.ErrorDto
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		assert.NoError(t, json.Unmarshal(body, &errorDto))
+		assert.Equal(t, MsgInvalidFilter, errorDto.Message, query)
+	}
+
+	assert.Len(t, server.profiles.Calls("FindPage"), 4)
+
+	slog.Info("TestListProfilesFiltered success")
+}
+
+func TestSearchProfiles(t *testing.T) {
+	var private = newTestProfile("admin")
+	private.Private = true
+	private.Company = "Acme"
+
+	var server = newTestServer()
+	defer server.Close()
+
+	server.profiles.Matches = []*model.ProfileMatch{{Profile: *newTestProfile("login1"), Rank: 1, Snippet: "<b>login1</b>"}}
+
+	resp, body := doRequest(t, http.MethodGet, server.URL+"/profiles/search?q=+login+&pageSize=1", "")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []any{"login", uint(0), uint(1)}, server.profiles.Last("Search"))
+
+	var paged common.PagedResult[profile.ProfileMatchDto]
+
+	assert.NoError(t, json.Unmarshal(body, &paged))
+	assert.Equal(t, 1, len(paged.ResultDto.Entities))
+	assert.Equal(t, "login1", paged.ResultDto.Entities[0].Profile.Login)
+	assert.Equal(t, "<b>login1</b>", paged.ResultDto.Entities[0].Snippet)
+	assert.Equal(t, uint64(1), paged.ResultDto.Pageable.Total)
+
+	// private profiles only show their card
+	server.profiles.Matches = []*model.ProfileMatch{{Profile: *private, Rank: 1}}
+
+	resp, body = doRequest(t, http.MethodGet, server.URL+"/profiles/search?q=adm", "")
+
+	paged = common.PagedResult[profile.ProfileMatchDto]{}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &paged))
+	assert.Equal(t, 1, len(paged.ResultDto.Entities))
+	assert.Empty(t, paged.ResultDto.Entities[0].Profile.Company)
+
+	resp, _ = doRequest(t, http.MethodGet, server.URL+"/profiles/search?q=+", "")
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Len(t, server.profiles.Calls("Search"), 2)
+
+	slog.Info("TestSearchProfiles success")
+}
+
+func TestListProfilesByCursor(t *testing.T) {
+	var server = newTestServer()
+	defer server.Close()
+
+	var next = &common.Cursor{ID: uuid.New()}
+
+	server.profiles.Listed = []*model.Profile{newTestProfile("login1"), newTestProfile("login2")}
+	server.profiles.Next = next
+
+	resp, body := doRequest(t, http.MethodGet, server.URL+"/profiles?cursor=&pageSize=2", "")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, server.profiles.Last("FindKeyset")[1])
+
+	var paged common.CursorPagedResult[profile.ProfileDto]
+
+	assert.NoError(t, json.Unmarshal(body, &paged))
+	assert.Equal(t, 2, len(paged.ResultDto.Entities))
+	assert.NotEmpty(t, paged.ResultDto.Next)
+	assert.Empty(t, paged.ResultDto.Prev)
+
+	// the signed cursor comes back to the repository
+	server.profiles.Listed = []*model.Profile{newTestProfile("login3")}
+	server.profiles.Next = nil
+
+	resp, body = doRequest(t, http.MethodGet, server.URL+"/profiles?pageSize=2&cursor="+paged.ResultDto.Next, "")
+
+	paged = common.CursorPagedResult[profile.ProfileDto]{}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, next.ID, server.profiles.Last("FindKeyset")[1].(*common.Cursor).ID)
+	assert.NoError(t, json.Unmarshal(body, &paged))
+	assert.Equal(t, 1, len(paged.ResultDto.Entities))
+	assert.Equal(t, "login3", paged.ResultDto.Entities[0].Login)
+	assert.Empty(t, paged.ResultDto.Next)
+
+	var forged = common.NewCursorCodec([]byte("forged")).Encode(&common.Cursor{ID: uuid.UUID{0}})
+
+	resp, body = doRequest(t, http.MethodGet, server.URL+"/profiles?cursor="+forged, "")
+
+	var errorDto common.ErrorDto
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, MsgInvalidCursor, errorDto.Message)
+	assert.Len(t, server.profiles.Calls("FindKeyset"), 2)
+
+	slog.Info("TestListProfilesByCursor success")
+}
+
+func TestCreateProfile(t *testing.T) {
+	var server = newTestServer()
+	defer server.Close()
+
+	// the requested address is mailed a confirmation
+	server.verifications.Pending = &model.EmailVerification{Email: "john2@doe.com", Primary: true}
+
+	resp, body := doRequest(t, http.MethodPost, server.URL+"/profiles",
+		`{"login": "login2", "primaryEmail": "john2@doe.com", "lastName": "Doe"}`, "Authorization", adminToken)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var result common.ResultDto[profile.ProfileDto]
+
+	assert.NoError(t, json.Unmarshal(body, &result))
+	assert.NotEmpty(t, result.Result.ID)
+	assert.Empty(t, result.Result.PrimaryEmail)
+	assert.Equal(t, "john2@doe.com", result.Result.PendingEmail)
+	assert.Equal(t, "/profiles/"+result.Result.ID.String(), resp.Header.Get("Location"))
+	assert.Equal(t, "Doe", server.profiles.Last("Create")[0].(model.Profile).LastName)
+	assert.Equal(t, "john2@doe.com", server.verifications.Last("Create")[0].(model.EmailVerification).Email)
+	assert.Equal(t, []any{"john2@doe.com"}, server.emails.Last("FindByEmail"))
+
+	server.profiles.Fail("Create", &repoCommon.UniqueViolationError{Field: "Login", Constraint: "profiles_login_key"})
+
+	resp, body = doRequest(t, http.MethodPost, server.URL+"/profiles",
+		`{"login": "login1", "primaryEmail": "john3@doe.com"}`, "Authorization", adminToken)
+
+	var errorDto common.ErrorDto
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, MsgAlreadyExists, errorDto.Message)
+	assert.Equal(t, []string{"Login"}, errorDto.Details)
+	assert.Len(t, server.mailer.Sent(), 1)
+
+	resp, _ = doRequest(t, http.MethodPost, server.URL+"/profiles", `{"login": `, "Authorization", adminToken)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, body = doRequest(t, http.MethodPost, server.URL+"/profiles",
+		`{"primaryEmail": "john", "company": "`+strings.Repeat("a", 101)+`"}`, "Authorization", adminToken)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, MsgValidation, errorDto.Message)
+	assert.Equal(t, []string{"login: required", "primaryEmail: email", "company: max=100"}, errorDto.Details)
+
+	// profiles of users are provisioned from their identity, only admins create others
+	resp, _ = doRequest(t, http.MethodPost, server.URL+"/profiles", `{"login": "login3"}`)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "Bearer", resp.Header.Get("WWW-Authenticate"))
+
+	resp, body = doRequest(t, http.MethodPost, server.URL+"/profiles", `{"login": "login3"}`, "Authorization", bearer(newTestProfile("user")))
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, MsgForbidden, errorDto.Message)
+	assert.Len(t, server.profiles.Calls("Create"), 2)
+
+	slog.Info("TestCreateProfile success")
+}
+
+func TestUpdateProfile(t *testing.T) {
+	var stored = newTestProfile("login1")
+	stored.Version = 2
+
+	var server = newTestServer(stored)
+	defer server.Close()
+
+	var updated = func() model.Profile {
+		return server.profiles.Last("Update")[0].(model.Profile)
+	}
+
+	resp, _ := doRequest(t, http.MethodPatch, server.URL+"/profiles/"+stored.ID.String(), `{"company": "Acme"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Acme", updated().Company)
+	assert.Equal(t, "John", updated().FistName)
+
+	resp, _ = doRequest(t, http.MethodPut, server.URL+"/profiles/"+stored.ID.String(),
+		`{"login": "login1", "primaryEmail": "new@smith.com"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "login1@smith.com", updated().PrimaryEmail) // stored once confirmed
+	assert.Empty(t, updated().Company)
+	assert.Equal(t, "new@smith.com", server.mailer.Sent()[0].To)
+
+	resp, _ = doRequest(t, http.MethodPut, server.URL+"/profiles/"+uuid.New().String(), `{"login": "login3"}`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, body := doRequest(t, http.MethodPatch, server.URL+"/profiles/"+stored.ID.String(), `{"login": "", "tags": ["go", ""]}`, "Authorization", bearer(stored))
+
+	var errorDto common.ErrorDto
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal(body, &errorDto))
+	assert.Equal(t, []string{"login: min=1", "tags[1]: required"}, errorDto.Details)
+	assert.Len(t, server.profiles.Calls("Update"), 2)
+
+	// the ETag is the version, the updated one is returned
+	resp, _ = doRequest(t, http.MethodGet, server.URL+"/profiles/"+stored.ID.String(), "")
+
+	var tag = resp.Header.Get("ETag")
+
+	assert.Equal(t, `"2"`, tag)
+
+	resp, _ = doRequest(t, http.MethodPatch, server.URL+"/profiles/"+stored.ID.String(), `{"company": "Acme"}`, "If-Match", `"1"`, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodPatch, server.URL+"/profiles/"+stored.ID.String(), `{"company": "Acme"}`, "If-Match", tag, "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"3"`, resp.Header.Get("ETag"))
+
+	// updates of others in between fail either way
+	server.profiles.Fail("Update", repoCommon.ErrConcurrentModification)
+
+	resp, _ = doRequest(t, http.MethodPut, server.URL+"/profiles/"+stored.ID.String(), `{"login": "login1"}`, "If-Match", "*", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodPut, server.URL+"/profiles/"+stored.ID.String(), `{"login": "login1"}`, "If-Match", "*", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// only the owner and admins change a profile
+	resp, _ = doRequest(t, http.MethodPatch, server.URL+"/profiles/"+stored.ID.String(), `{"company": "Admin", "private": false}`, "Authorization", adminToken)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Admin", updated().Company)
+
+	resp, _ = doRequest(t, http.MethodPatch, server.URL+"/profiles/"+stored.ID.String(), `{"company": "Evil"}`)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodPatch, server.URL+"/profiles/"+stored.ID.String(), `{"company": "Evil"}`, "Authorization", bearer(newTestProfile("other")))
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "Admin", updated().Company)
+
+	slog.Info("TestUpdateProfile success")
+}
+
+func TestDeleteProfile(t *testing.T) {
+	var stored = newTestProfile("login1")
+	var private = newTestProfile("login2")
+	private.Private = true
+
+	var server = newTestServer(stored, private)
+	defer server.Close()
+
+	resp, _ := doRequest(t, http.MethodDelete, server.URL+"/profiles/"+stored.ID.String(), "", "Authorization", bearer(private))
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// private profiles stay hidden from those who may not change them
+	resp, _ = doRequest(t, http.MethodDelete, server.URL+"/profiles/"+private.ID.String(), "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Empty(t, server.profiles.Calls("Delete"))
+
+	resp, _ = doRequest(t, http.MethodDelete, server.URL+"/profiles/"+private.ID.String(), "", "Authorization", adminToken)
+
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, []any{private.ID}, server.profiles.Last("Delete"))
+
+	resp, _ = doRequest(t, http.MethodDelete, server.URL+"/profiles/"+stored.ID.String(), "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, []any{stored.ID}, server.profiles.Last("Delete"))
+
+	// deleted meanwhile
+	server.profiles.Fail("Delete", repoCommon.ErrNotFound)
+
+	resp, _ = doRequest(t, http.MethodDelete, server.URL+"/profiles/"+stored.ID.String(), "", "Authorization", bearer(stored))
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	slog.Info("TestDeleteProfile success")
+}
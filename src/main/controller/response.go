@@ -0,0 +1,120 @@
+package controller
+
+import (
+	repoCommon "cabinet/src/main/repository/common"
+	"cabinet/src/main/service"
+	"cabinet/src/main/validation"
+	"cabinet/src/main/view/common"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// Stable error messages of ErrorDto, clients match on them
+const (
+	MsgBadRequest       = "bad_request"
+	MsgInvalidId        = "invalid_id"
+	MsgInvalidPage      = "invalid_pagination"
+	MsgInvalidCursor    = "invalid_cursor"
+	MsgInvalidFilter    = "invalid_filter"
+	MsgInvalidImage     = "invalid_image"
+	MsgInvalidToken     = "invalid_token"
+	MsgValidation       = "validation_failed"
+	MsgNotFound         = "not_found"
+	MsgAlreadyExists    = "already_exists"
+	MsgConflict         = "conflict"
+	MsgPrimaryEmail     = "primary_email"
+	MsgUnverifiedEmail  = "unverified_email"
+	MsgNoPhone          = "no_phone"
+	MsgPrecondition     = "precondition_failed"
+	MsgTooLarge         = "too_large"
+	MsgTooFrequent      = "too_frequent"
+	MsgUnsupportedMedia = "unsupported_media_type"
+	MsgCancelled        = "cancelled"
+	MsgUnauthorized     = "unauthorized"
+	MsgForbidden        = "forbidden"
+	MsgUnavailable      = "unavailable"
+	MsgInternal         = "internal_error"
+)
+
+// maxBodyBytes request body limit
+const maxBodyBytes = 1 << 20
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if body == nil {
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Writing response failed", slog.Any("err", err))
+	}
+}
+
+func writeResult[T any](w http.ResponseWriter, status int, result T) {
+	writeJSON(w, status, common.ResultDto[T]{Result: result})
+}
+
+func writeError(w http.ResponseWriter, status int, message string, details ...string) {
+	writeJSON(w, status, common.BuildError(uint16(status), message, details...))
+}
+
+// writeRepoError maps repository, validation and authorization errors to ErrorDto responses
+func writeRepoError(w http.ResponseWriter, err error) {
+	var uniqueErr *repoCommon.UniqueViolationError
+	var violations validation.Errors
+
+	switch {
+	case errors.As(err, &violations):
+		writeError(w, http.StatusBadRequest, MsgValidation, violations.Details()...)
+	case errors.Is(err, repoCommon.ErrNotFound):
+		writeError(w, http.StatusNotFound, MsgNotFound)
+	case errors.As(err, &uniqueErr):
+		writeError(w, http.StatusConflict, MsgAlreadyExists, uniqueErr.Field)
+	case errors.Is(err, repoCommon.ErrConcurrentModification):
+		writeError(w, http.StatusPreconditionFailed, MsgPrecondition)
+	case errors.Is(err, repoCommon.ErrForeignKeyViolation):
+		writeError(w, http.StatusConflict, MsgConflict)
+	case errors.Is(err, service.ErrInvalidVerification):
+		writeError(w, http.StatusBadRequest, MsgInvalidToken)
+	case errors.Is(err, service.ErrPrimaryEmail):
+		writeError(w, http.StatusConflict, MsgPrimaryEmail)
+	case errors.Is(err, service.ErrUnverifiedEmail):
+		writeError(w, http.StatusConflict, MsgUnverifiedEmail)
+	case errors.Is(err, service.ErrNoPhone):
+		writeError(w, http.StatusConflict, MsgNoPhone)
+	case errors.Is(err, service.ErrTooFrequent):
+		writeError(w, http.StatusTooManyRequests, MsgTooFrequent)
+	case errors.Is(err, service.ErrSMSDisabled):
+		writeError(w, http.StatusServiceUnavailable, MsgUnavailable)
+	case errors.Is(err, service.ErrUnauthenticated):
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, MsgUnauthorized)
+	case errors.Is(err, service.ErrForbidden):
+		writeError(w, http.StatusForbidden, MsgForbidden)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusServiceUnavailable, MsgCancelled)
+	default:
+		slog.Error("Request failed", slog.Any("err", err))
+		writeError(w, http.StatusInternalServerError, MsgInternal)
+	}
+}
+
+// decodeBody reads a JSON request body into dest and checks its validation rules
+func decodeBody(w http.ResponseWriter, r *http.Request, dest any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(dest); err != nil {
+		writeError(w, http.StatusBadRequest, MsgBadRequest, err.Error())
+		return false
+	}
+
+	if err := validation.Validate(dest); err != nil {
+		writeRepoError(w, err)
+		return false
+	}
+
+	return true
+}
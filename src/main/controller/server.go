@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"cabinet/src/main/audit"
+	"cabinet/src/main/auth"
+	"cabinet/src/main/datasource"
+	"cabinet/src/main/mail"
+	"cabinet/src/main/model"
+	"cabinet/src/main/phone"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/service"
+	"cabinet/src/main/storage"
+	"cabinet/src/main/view/common"
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CursorKeyEnv secret signing pagination cursors, shared by all instances
+const CursorKeyEnv = "CABINET_CURSOR_KEY"
+
+// jwksTimeout bounds a JWKS request made while authenticating
+const jwksTimeout = 10 * time.Second
+
+// Config REST API settings
+type Config struct {
+	CursorKey    []byte // random per process when empty, cursors then expire on restart
+	Auth         auth.Config
+	Verification service.VerificationConfig
+	Phone        phone.Config
+}
+
+func ConfigFromEnv() (Config, error) {
+	authCfg, err := auth.ConfigFromEnv()
+
+	if err != nil {
+		return Config{}, err
+	}
+
+	verificationCfg, err := service.VerificationConfigFromEnv()
+
+	if err != nil {
+		return Config{}, err
+	}
+
+	var phoneCfg = phone.ConfigFromEnv()
+
+	if _, err = phone.NewParser(phoneCfg.Region); err != nil {
+		return Config{}, err
+	}
+
+	return Config{CursorKey: []byte(os.Getenv(CursorKeyEnv)), Auth: authCfg, Verification: verificationCfg, Phone: phoneCfg}, nil
+}
+
+// TokenVerifier validates bearer tokens, see auth.Verifier
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*auth.Claims, error)
+}
+
+// ProfileResolver profile of verified claims, see service.Provisioner
+type ProfileResolver interface {
+	Resolve(ctx context.Context, claims *auth.Claims) (*model.Profile, error)
+}
+
+// NewRouter REST API over the datasource, blobs store avatars and attachment content, the mailer and
+// the sender deliver verifications, a nil sender disables phone verification
+func NewRouter(ds *datasource.Datasource, blobs storage.BlobStore, mailer mail.Mailer, sender phone.Sender, cfg Config) http.Handler {
+	var mux = http.NewServeMux()
+	var cursors = common.NewCursorCodec(cfg.CursorKey)
+	var profiles = repository.NewProfileRepo(ds)
+
+	var policy = service.DefaultPolicy()
+	var addresses = repository.NewProfileEmailRepo(ds)
+	var emails = service.NewEmailVerifier(repository.NewEmailVerificationRepo(ds), addresses, mailer, cfg.Verification)
+
+	// ConfigFromEnv rejects unknown regions, an unset one is the default
+	parser, err := phone.NewParser(cmp.Or(cfg.Phone.Region, phone.DefaultConfig().Region))
+
+	if err != nil {
+		slog.Warn("Unknown phone region, using the default", slog.Any("err", err))
+		parser, _ = phone.NewParser(phone.DefaultConfig().Region)
+	}
+
+	var phoneCfg = service.DefaultPhoneConfig()
+	phoneCfg.Secret = cfg.Verification.Secret
+
+	var phones = service.NewPhoneVerifier(repository.NewPhoneVerificationRepo(ds), parser, sender, phoneCfg)
+
+	NewProfileController(profiles, cursors, policy, emails, phones).Register(mux)
+	NewPhoneController(profiles, phones, policy).Register(mux)
+	NewEmailController(profiles, emails, service.NewProfileService(profiles, addresses, emails, policy), policy).Register(mux)
+	NewAvatarController(profiles, service.NewAvatarService(profiles, blobs, service.DefaultImageLimits()), policy).Register(mux)
+
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		health := ds.Health(r.Context())
+
+		var status = http.StatusOK
+
+		if health.Status != "up" {
+			status = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, status, health)
+	})
+
+	var verifier TokenVerifier
+
+	if cfg.Auth.Enabled() {
+		verifier = auth.NewVerifier(cfg.Auth, &http.Client{Timeout: jwksTimeout})
+	}
+
+	var provisioner = service.NewProvisioner(profiles)
+
+	return withRecovery(withLogging(withAuthentication(verifier, provisioner, withActor(mux))))
+}
+
+// NewServer HTTP server with conservative timeouts
+func NewServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func withLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var started = time.Now()
+		var recorder = &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		slog.Info("HTTP request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Duration("duration", time.Since(started)))
+	})
+}
+
+// withAuthentication puts the claims and the profile of bearer token callers in the request context,
+// profiles of new identities are provisioned. Requests without a token stay anonymous, invalid tokens
+// are rejected. A nil verifier disables it.
+func withAuthentication(verifier TokenVerifier, profiles ProfileResolver, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := auth.BearerToken(r)
+
+		if verifier == nil || token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := verifier.Verify(r.Context(), token)
+
+		if errors.Is(err, auth.ErrInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, MsgUnauthorized)
+			return
+		}
+
+		if err != nil {
+			slog.Error("Verifying token failed", slog.Any("err", err))
+			writeError(w, http.StatusServiceUnavailable, MsgUnavailable)
+			return
+		}
+
+		var ctx = auth.WithClaims(r.Context(), claims)
+
+		found, err := profiles.Resolve(ctx, claims)
+
+		if err != nil {
+			writeRepoError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithProfile(ctx, found)))
+	})
+}
+
+// withActor attributes audited changes made by the request to the viewer
+func withActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if viewer := viewerId(r); viewer != uuid.Nil {
+			r = r.WithContext(audit.WithActor(r.Context(), viewer))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				slog.Error("Handler panic", slog.Any("panic", recovered), slog.String("path", r.URL.Path))
+				writeError(w, http.StatusInternalServerError, MsgInternal)
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"cabinet/src/main/auth"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/repotest"
+	"cabinet/src/main/service"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthentication(t *testing.T) {
+	var stored = newTestProfile("login1")
+	stored.ExternalID = uuid.New()
+
+	var verifier = &fakeVerifier{subjects: map[string]string{
+		"known":   stored.ExternalID.String(),
+		"unknown": uuid.New().String(),
+	}}
+
+	var viewer uuid.UUID
+	var claims *auth.Claims
+	var repo = repotest.NewProfiles(stored)
+
+	var handler = withAuthentication(verifier, service.NewProvisioner(repo), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		viewer, claims = viewerId(r), auth.ClaimsFrom(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	var serve = func(authorization string) *httptest.ResponseRecorder {
+		var recorder = httptest.NewRecorder()
+		var request = httptest.NewRequest(http.MethodGet, "/profiles", nil)
+
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+
+		viewer, claims = uuid.Nil, nil
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve("").Code)
+	assert.Equal(t, uuid.Nil, viewer)
+	assert.Nil(t, claims)
+
+	assert.Equal(t, http.StatusNoContent, serve("Bearer known").Code)
+	assert.Equal(t, stored.ID, viewer)
+	assert.Equal(t, stored.ExternalID.String(), claims.Subject)
+
+	// first request of a new identity provisions its profile
+	assert.Equal(t, http.StatusNoContent, serve("Bearer unknown").Code)
+	assert.NotEqual(t, uuid.Nil, viewer)
+	assert.NotEqual(t, stored.ID, viewer)
+	assert.Equal(t, verifier.subjects["unknown"], repo.Last("Create")[0].(model.Profile).ExternalID.String())
+
+	recorder := serve("Bearer forged")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("WWW-Authenticate"), "invalid_token")
+
+	verifier.err = errors.New("jwks unreachable")
+	assert.Equal(t, http.StatusServiceUnavailable, serve("Bearer known").Code)
+
+	slog.Info("TestAuthentication success")
+}
+
+// fakeVerifier accepts tokens naming a known subject
+type fakeVerifier struct {
+	subjects map[string]string // token to subject
+	err      error
+}
+
+func (f *fakeVerifier) Verify(_ context.Context, token string) (*auth.Claims, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	subject, ok := f.subjects[token]
+
+	if !ok {
+		return nil, auth.ErrInvalidToken
+	}
+
+	return &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: subject}}, nil
+}
@@ -2,11 +2,202 @@ package datasource
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
 
+	_ "github.com/lib/pq"
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/extra/bundebug"
 )
 
+// Environment variables read by ConfigFromEnv
+const (
+	DSNEnv             = "CABINET_DB_DSN"
+	MaxOpenConnsEnv    = "CABINET_DB_MAX_OPEN_CONNS"
+	MaxIdleConnsEnv    = "CABINET_DB_MAX_IDLE_CONNS"
+	ConnMaxLifetimeEnv = "CABINET_DB_CONN_MAX_LIFETIME"
+	ConnMaxIdleTimeEnv = "CABINET_DB_CONN_MAX_IDLE_TIME"
+	DebugEnv           = "CABINET_DB_DEBUG"
+)
+
+// Config connection and pool settings
+type Config struct {
+	DSN             string // postgres DSN, empty uses libpq PG* environment variables
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	Debug           bool // log queries with bundebug
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxOpenConns:    25,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+	}
+}
+
+// ConfigFromEnv DefaultConfig overridden by the CABINET_DB_* environment variables
+func ConfigFromEnv() (Config, error) {
+	var cfg = DefaultConfig()
+	var err error
+
+	cfg.DSN = os.Getenv(DSNEnv)
+
+	if cfg.MaxOpenConns, err = intEnv(MaxOpenConnsEnv, cfg.MaxOpenConns); err != nil {
+		return cfg, err
+	}
+
+	if cfg.MaxIdleConns, err = intEnv(MaxIdleConnsEnv, cfg.MaxIdleConns); err != nil {
+		return cfg, err
+	}
+
+	if cfg.ConnMaxLifetime, err = durationEnv(ConnMaxLifetimeEnv, cfg.ConnMaxLifetime); err != nil {
+		return cfg, err
+	}
+
+	if cfg.ConnMaxIdleTime, err = durationEnv(ConnMaxIdleTimeEnv, cfg.ConnMaxIdleTime); err != nil {
+		return cfg, err
+	}
+
+	if value, ok := os.LookupEnv(DebugEnv); ok {
+		if cfg.Debug, err = strconv.ParseBool(value); err != nil {
+			return cfg, fmt.Errorf("%s: %w", DebugEnv, err)
+		}
+	}
+
+	return cfg, nil
+}
+
 type Datasource struct {
 	Db      *bun.DB
-	Context context.Context
+	Context context.Context // fallback context for background jobs
+}
+
+// Health database state reported by Datasource.Health
+type Health struct {
+	Status  string        `json:"status"`
+	Error   string        `json:"error,omitempty"`
+	Latency time.Duration `json:"latency"`
+	Stats   sql.DBStats   `json:"stats"`
+}
+
+// New opens a postgres pool described by cfg; ctx becomes the fallback context
+func New(ctx context.Context, cfg Config) (*Datasource, error) {
+	sqlDb, err := sql.Open("postgres", cfg.DSN)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFromDB(ctx, sqlDb, cfg), nil
+}
+
+// NewFromEnv opens a postgres pool configured by ConfigFromEnv
+func NewFromEnv(ctx context.Context) (*Datasource, error) {
+	cfg, err := ConfigFromEnv()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return New(ctx, cfg)
+}
+
+// NewFromDB wraps an opened database, the DSN of cfg is ignored
+func NewFromDB(ctx context.Context, sqlDb *sql.DB, cfg Config) *Datasource {
+	sqlDb.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDb.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDb.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDb.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	bunDb := bun.NewDB(sqlDb, pgdialect.New())
+
+	if cfg.Debug {
+		bunDb.AddQueryHook(bundebug.NewQueryHook(
+			bundebug.WithVerbose(true),
+		))
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return &Datasource{Db: bunDb, Context: ctx}
+}
+
+// ResolveContext returns ctx, or the datasource fallback context when ctx is nil
+func (d *Datasource) ResolveContext(ctx context.Context) context.Context {
+	if ctx != nil {
+		return ctx
+	}
+
+	if d.Context != nil {
+		return d.Context
+	}
+
+	return context.Background()
+}
+
+func (d *Datasource) Ping(ctx context.Context) error {
+	return d.Db.PingContext(d.ResolveContext(ctx))
+}
+
+// Health pings the database and reports pool statistics
+func (d *Datasource) Health(ctx context.Context) Health {
+	var started = time.Now()
+	var health = Health{Status: "up"}
+
+	if err := d.Ping(ctx); err != nil {
+		health.Status = "down"
+		health.Error = err.Error()
+	}
+
+	health.Latency = time.Since(started)
+	health.Stats = d.Db.Stats()
+
+	return health
+}
+
+// Close waits for running queries and closes the pool
+func (d *Datasource) Close() error {
+	return d.Db.Close()
+}
+
+func intEnv(name string, fallback int) (int, error) {
+	value, ok := os.LookupEnv(name)
+
+	if !ok {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+
+	if err != nil {
+		return fallback, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return parsed, nil
+}
+
+func durationEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(name)
+
+	if !ok {
+		return fallback, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+
+	if err != nil {
+		return fallback, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return parsed, nil
 }
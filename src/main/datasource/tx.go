@@ -0,0 +1,92 @@
+package datasource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/uptrace/bun"
+)
+
+const pqSerializationFailure = "40001"
+
+const DefaultMaxRetries = 3
+
+// retryBackoff base delay between serialization failure retries
+var retryBackoff = 20 * time.Millisecond
+
+// TxOptions transaction isolation and retry settings
+type TxOptions struct {
+	Isolation  sql.IsolationLevel
+	ReadOnly   bool
+	MaxRetries int // retries on serialization failures, 0 disables them
+}
+
+func DefaultTxOptions() *TxOptions {
+	return &TxOptions{Isolation: sql.LevelReadCommitted, MaxRetries: DefaultMaxRetries}
+}
+
+type txKey struct{}
+
+// TxFromContext returns the transaction bound to ctx by RunInTx
+func TxFromContext(ctx context.Context) (bun.Tx, bool) {
+	if ctx == nil {
+		return bun.Tx{}, false
+	}
+	tx, ok := ctx.Value(txKey{}).(bun.Tx)
+	return tx, ok
+}
+
+// IDB returns the transaction bound to ctx, or the database itself
+func (d *Datasource) IDB(ctx context.Context) bun.IDB {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return d.Db
+}
+
+// RunInTx runs fn in a transaction and commits it when fn succeeds.
+// The ctx passed to fn carries the transaction, so repositories called with it join the transaction.
+// Nested calls join the outer transaction. Serialization failures (SQLSTATE 40001) restart fn
+// up to opts.MaxRetries times, so fn must be safe to repeat.
+func (d *Datasource) RunInTx(ctx context.Context, opts *TxOptions, fn func(ctx context.Context, tx bun.Tx) error) error {
+	ctx = d.ResolveContext(ctx)
+
+	if tx, ok := TxFromContext(ctx); ok {
+		return fn(ctx, tx)
+	}
+
+	if opts == nil {
+		opts = DefaultTxOptions()
+	}
+
+	var sqlOpts = &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+
+	for attempt := 0; ; attempt++ {
+		err := d.Db.RunInTx(ctx, sqlOpts, func(ctx context.Context, tx bun.Tx) error {
+			return fn(context.WithValue(ctx, txKey{}, tx), tx)
+		})
+
+		if err == nil || !IsSerializationFailure(err) || attempt >= opts.MaxRetries {
+			return err
+		}
+
+		slog.Warn("Retrying serialization failure", slog.Int("attempt", attempt+1), slog.Any("err", err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryBackoff*time.Duration(1<<attempt) + rand.N(retryBackoff)):
+		}
+	}
+}
+
+// IsSerializationFailure reports whether err is a postgres serialization failure
+func IsSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqSerializationFailure
+}
@@ -0,0 +1,117 @@
+package datasource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+func TestRunInTx(t *testing.T) {
+	ds, mock := newTestDatasource(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE profiles").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO attachments").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := ds.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		bound, ok := TxFromContext(ctx)
+
+		assert.True(t, ok)
+		assert.Equal(t, tx, bound)
+		assert.Equal(t, bun.IDB(tx), ds.IDB(ctx))
+
+		if _, err := ds.IDB(ctx).ExecContext(ctx, "UPDATE profiles"); err != nil {
+			return err
+		}
+
+		// nested call joins the outer transaction
+		return ds.RunInTx(ctx, nil, func(ctx context.Context, nested bun.Tx) error {
+			assert.Equal(t, tx, nested)
+			_, err := nested.ExecContext(ctx, "INSERT INTO attachments")
+			return err
+		})
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, bun.IDB(ds.Db), ds.IDB(context.Background()))
+
+	var failure = errors.New("insert failed")
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err = ds.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		return failure
+	})
+
+	assert.ErrorIs(t, err, failure)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestRunInTx success")
+}
+
+func TestRunInTxRetry(t *testing.T) {
+	ds, mock := newTestDatasource(t)
+	retryBackoff = time.Millisecond
+
+	var serialization = &pq.Error{Code: "40001", Message: "could not serialize access"}
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	var attempts = 0
+
+	err := ds.RunInTx(context.Background(), &TxOptions{Isolation: sql.LevelSerializable, MaxRetries: 2},
+		func(ctx context.Context, tx bun.Tx) error {
+			attempts++
+			if attempts == 1 {
+				return serialization
+			}
+			return nil
+		})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	attempts = 0
+
+	err = ds.RunInTx(context.Background(), &TxOptions{Isolation: sql.LevelSerializable, MaxRetries: 1},
+		func(ctx context.Context, tx bun.Tx) error {
+			attempts++
+			return serialization
+		})
+
+	assert.True(t, IsSerializationFailure(err))
+	assert.Equal(t, 2, attempts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestRunInTxRetry success")
+}
+
+func newTestDatasource(t *testing.T) (*Datasource, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatalf("An error was not expected when opening a stub database connection: %s", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	return NewFromDB(context.Background(), db, DefaultConfig()), mock
+}
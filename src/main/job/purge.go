@@ -0,0 +1,112 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	PurgeRetentionEnv = "CABINET_PURGE_RETENTION"
+	PurgeIntervalEnv  = "CABINET_PURGE_INTERVAL"
+)
+
+// Purgeable storage of soft deleted rows, Purge hard deletes rows deleted before the time
+type Purgeable interface {
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// PurgeConfig how long soft deleted rows are kept and how often they are purged
+type PurgeConfig struct {
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+func DefaultPurgeConfig() PurgeConfig {
+	return PurgeConfig{
+		Retention: 30 * 24 * time.Hour,
+		Interval:  time.Hour,
+	}
+}
+
+// PurgeConfigFromEnv defaults overridden by CABINET_PURGE_* durations, e.g. 720h
+func PurgeConfigFromEnv() (PurgeConfig, error) {
+	var cfg = DefaultPurgeConfig()
+
+	for env, dest := range map[string]*time.Duration{PurgeRetentionEnv: &cfg.Retention, PurgeIntervalEnv: &cfg.Interval} {
+		value, ok := os.LookupEnv(env)
+
+		if !ok {
+			continue
+		}
+
+		parsed, err := time.ParseDuration(value)
+
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", env, err)
+		}
+
+		if parsed <= 0 {
+			return cfg, fmt.Errorf("%s: must be positive", env)
+		}
+
+		*dest = parsed
+	}
+
+	return cfg, nil
+}
+
+// Purger periodically hard deletes soft deleted rows past the retention period
+type Purger struct {
+	cfg     PurgeConfig
+	targets []Purgeable
+	now     func() time.Time
+}
+
+// NewPurger purges the targets in order, dependent rows must come before the rows they reference
+func NewPurger(cfg PurgeConfig, targets ...Purgeable) *Purger {
+	return &Purger{cfg: cfg, targets: targets, now: time.Now}
+}
+
+// PurgeOnce purges every target once and reports the number of deleted rows
+func (p *Purger) PurgeOnce(ctx context.Context) (int64, error) {
+	var before = p.now().Add(-p.cfg.Retention)
+	var purged int64
+	var errs []error
+
+	for _, target := range p.targets {
+		count, err := target.Purge(ctx, before)
+		purged += count
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return purged, errors.Join(errs...)
+}
+
+// Run purges every interval until ctx is done
+func (p *Purger) Run(ctx context.Context) {
+	var ticker = time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := p.PurgeOnce(ctx)
+
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Purging deleted rows failed", slog.Any("err", err))
+		} else if purged > 0 {
+			slog.Info("Purged deleted rows", slog.Int64("count", purged))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePurgeable struct {
+	before time.Time
+	count  int64
+	err    error
+}
+
+func (f *fakePurgeable) Purge(_ context.Context, before time.Time) (int64, error) {
+	f.before = before
+	return f.count, f.err
+}
+
+func TestPurgeOnce(t *testing.T) {
+	var now = time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	var attachments = &fakePurgeable{count: 3}
+	var profiles = &fakePurgeable{count: 1}
+
+	var purger = NewPurger(PurgeConfig{Retention: 24 * time.Hour, Interval: time.Hour}, attachments, profiles)
+	purger.now = func() time.Time { return now }
+
+	purged, err := purger.PurgeOnce(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), purged)
+	assert.Equal(t, now.Add(-24*time.Hour), attachments.before)
+	assert.Equal(t, now.Add(-24*time.Hour), profiles.before)
+
+	var failure = errors.New("purge failed")
+	attachments.err = failure
+
+	purged, err = purger.PurgeOnce(context.Background())
+
+	assert.ErrorIs(t, err, failure)
+	assert.Equal(t, int64(4), purged)
+
+	slog.Info("TestPurgeOnce success")
+}
+
+func TestPurgeConfigFromEnv(t *testing.T) {
+	t.Setenv(PurgeRetentionEnv, "168h")
+
+	cfg, err := PurgeConfigFromEnv()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 168*time.Hour, cfg.Retention)
+	assert.Equal(t, DefaultPurgeConfig().Interval, cfg.Interval)
+
+	t.Setenv(PurgeIntervalEnv, "-1m")
+
+	_, err = PurgeConfigFromEnv()
+
+	assert.Error(t, err)
+
+	slog.Info("TestPurgeConfigFromEnv success")
+}
@@ -0,0 +1,84 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var _ Mailer = (*FileMailer)(nil)
+
+// FileMailer writes every message as an .eml file into a local outbox for development,
+// nothing is delivered. Files are named <unix nanos>-<uuid>.eml so they list in sending order.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir string, from string) (*FileMailer, error) {
+	dir, err := filepath.Abs(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (f *FileMailer) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var now = time.Now().UTC()
+	var name = strings.Join([]string{
+		now.Format("20060102T150405.000000000"),
+		uuid.NewString(),
+	}, "-") + ".eml"
+
+	// written to a temporary file first, readers of the outbox never see a partial message
+	tmp, err := os.CreateTemp(f.dir, ".mail-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(format(withSender(message, f.from), now)); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(f.dir, name))
+}
+
+// format RFC 5322 message with a UTF-8 body, non ASCII subjects are Q-encoded
+func format(message Message, date time.Time) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("From: " + message.From + "\r\n")
+	buf.WriteString("To: " + message.To + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	buf.WriteString("Date: " + date.Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(message.Body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return buf.Bytes()
+}
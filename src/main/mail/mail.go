@@ -0,0 +1,89 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Environment variables read by ConfigFromEnv
+const (
+	BackendEnv = "CABINET_MAIL"
+	DirEnv     = "CABINET_MAIL_DIR"
+	FromEnv    = "CABINET_MAIL_FROM"
+)
+
+// Backends selected by CABINET_MAIL
+const (
+	BackendFile   = "file"
+	BackendMemory = "memory"
+)
+
+// Message plain text mail, From is filled by the mailer when empty
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages, Send returns once the message is accepted for delivery
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// Config mailer selection and settings
+type Config struct {
+	Backend string // file or memory
+	Dir     string // outbox of the file backend
+	From    string // sender of messages without one
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Backend: BackendFile,
+		Dir:     "data/mail",
+		From:    "cabinet@localhost",
+	}
+}
+
+// ConfigFromEnv DefaultConfig overridden by CABINET_MAIL* environment variables
+func ConfigFromEnv() Config {
+	var cfg = DefaultConfig()
+
+	for env, dest := range map[string]*string{
+		BackendEnv: &cfg.Backend,
+		DirEnv:     &cfg.Dir,
+		FromEnv:    &cfg.From,
+	} {
+		if value, ok := os.LookupEnv(env); ok {
+			*dest = value
+		}
+	}
+
+	return cfg
+}
+
+// New opens the mailer selected by cfg
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Backend {
+	case BackendFile:
+		return NewFileMailer(cfg.Dir, cfg.From)
+	case BackendMemory:
+		return NewMemoryMailer(cfg.From), nil
+	default:
+		return nil, fmt.Errorf("%s: unknown mail backend %q, expected file or memory", BackendEnv, cfg.Backend)
+	}
+}
+
+// NewFromEnv opens the mailer configured by ConfigFromEnv
+func NewFromEnv() (Mailer, error) {
+	return New(ConfigFromEnv())
+}
+
+func withSender(message Message, from string) Message {
+	if message.From == "" {
+		message.From = from
+	}
+	return message
+}
@@ -0,0 +1,71 @@
+package mail
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMailers(t *testing.T) {
+	var ctx = context.Background()
+	var dir = t.TempDir()
+
+	fileMailer, err := NewFileMailer(dir, "cabinet@example.com")
+	assert.NoError(t, err)
+
+	var memory = NewMemoryMailer("cabinet@example.com")
+
+	_, sent := memory.Last()
+	assert.False(t, sent)
+
+	for _, mailer := range []Mailer{memory, fileMailer} {
+		assert.NoError(t, mailer.Send(ctx, Message{To: "john@smith.com", Subject: "Bestätigung", Body: "line 1\nline 2"}))
+		assert.NoError(t, mailer.Send(ctx, Message{From: "other@example.com", To: "jane@smith.com", Subject: "Second"}))
+	}
+
+	last, sent := memory.Last()
+
+	assert.True(t, sent)
+	assert.Equal(t, Message{From: "other@example.com", To: "jane@smith.com", Subject: "Second"}, last)
+	assert.Equal(t, "cabinet@example.com", memory.Sent()[0].From)
+	assert.Len(t, memory.Sent(), 2)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	content, err := os.ReadFile(files[0])
+
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "From: cabinet@example.com\r\nTo: john@smith.com\r\nSubject: =?utf-8?q?Best=C3=A4tigung?=\r\n")
+	assert.Contains(t, string(content), "\r\n\r\nline 1\r\nline 2")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	assert.ErrorIs(t, memory.Send(cancelled, Message{To: "john@smith.com"}), context.Canceled)
+	assert.ErrorIs(t, fileMailer.Send(cancelled, Message{To: "john@smith.com"}), context.Canceled)
+
+	slog.Info("TestMailers success")
+}
+
+func TestNewMailer(t *testing.T) {
+	t.Setenv(BackendEnv, BackendMemory)
+	t.Setenv(FromEnv, "noreply@example.com")
+
+	mailer, err := NewFromEnv()
+
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryMailer{}, mailer)
+
+	_, err = New(Config{Backend: "smtp"})
+
+	assert.ErrorContains(t, err, "unknown mail backend")
+
+	slog.Info("TestNewMailer success")
+}
@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+var _ Mailer = (*MemoryMailer)(nil)
+
+// MemoryMailer keeps sent messages in process memory for tests
+type MemoryMailer struct {
+	mu   sync.Mutex
+	from string
+	sent []Message
+}
+
+func NewMemoryMailer(from string) *MemoryMailer {
+	return &MemoryMailer{from: from}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, withSender(message, m.from))
+
+	return nil
+}
+
+// Sent messages in sending order
+func (m *MemoryMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.sent...)
+}
+
+// Last most recent message, false when nothing was sent
+func (m *MemoryMailer) Last() (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.sent) == 0 {
+		return Message{}, false
+	}
+
+	return m.sent[len(m.sent)-1], true
+}
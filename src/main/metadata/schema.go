@@ -0,0 +1,423 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidSchema = errors.New("invalid metadata schema")
+
+// Violation keyword a value failed, Path is dotted with [i] for array elements like validation.Violation,
+// which models importing this package can not depend on
+type Violation struct {
+	Path  string
+	Rule  string
+	Param string
+}
+
+// annotations keywords accepted without effect on validation
+var annotations = []string{"$schema", "$id", "$comment", "title", "description", "default", "examples"}
+
+var types = []string{"null", "boolean", "object", "array", "number", "integer", "string"}
+
+var formats = map[string]func(value string) bool{
+	"date-time": func(value string) bool { _, err := time.Parse(time.RFC3339, value); return err == nil },
+	"date":      func(value string) bool { _, err := time.Parse(time.DateOnly, value); return err == nil },
+	"email": func(value string) bool {
+		address, err := mail.ParseAddress(value)
+		return err == nil && address.Address == value
+	},
+	"uri":  func(value string) bool { parsed, err := url.Parse(value); return err == nil && parsed.IsAbs() },
+	"uuid": func(value string) bool { _, err := uuid.Parse(value); return err == nil && len(value) == 36 },
+}
+
+// Schema compiled JSON Schema document, a subset of draft 2020-12:
+//
+//	type, enum, const
+//	properties, required, additionalProperties   objects
+//	items, minItems, maxItems, uniqueItems        arrays
+//	minLength, maxLength, pattern, format         strings, format is date-time, date, email, uri or uuid
+//	minimum, maximum, exclusiveMinimum, exclusiveMaximum   numbers
+//
+// Other keywords fail Compile instead of being ignored, annotations like title and description pass.
+type Schema struct {
+	types            []string
+	enum             []any
+	constant         any
+	hasConst         bool
+	properties       map[string]*Schema
+	required         []string
+	additional       *Schema // nil allows any additional property
+	closed           bool    // additionalProperties false
+	items            *Schema
+	minItems         *int
+	maxItems         *int
+	uniqueItems      bool
+	minLength        *int
+	maxLength        *int
+	pattern          *regexp.Regexp
+	format           string
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+}
+
+// Compile parses the JSON document, fails with ErrInvalidSchema
+func Compile(document []byte) (*Schema, error) {
+	var raw any
+
+	if err := json.Unmarshal(document, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+
+	return compile(raw, "#")
+}
+
+func compile(raw any, at string) (*Schema, error) {
+	keywords, ok := raw.(map[string]any)
+
+	if !ok {
+		return nil, invalid(at, "must be an object")
+	}
+
+	var schema = &Schema{}
+	var names = make([]string, 0, len(keywords))
+
+	for keyword := range keywords {
+		names = append(names, keyword)
+	}
+
+	// the first error is reported, in a stable order
+	sort.Strings(names)
+
+	for _, keyword := range names {
+		var value = keywords[keyword]
+		var err error
+
+		switch keyword {
+		case "type":
+			schema.types, err = compileTypes(value, at)
+		case "enum":
+			values, ok := value.([]any)
+
+			if !ok || len(values) == 0 {
+				err = invalid(at, "enum must be a non-empty array")
+			}
+
+			schema.enum = values
+		case "const":
+			schema.constant, schema.hasConst = value, true
+		case "properties":
+			schema.properties, err = compileProperties(value, at)
+		case "required":
+			schema.required, err = compileStrings(value, at+"/required")
+		case "additionalProperties":
+			if closed, ok := value.(bool); ok {
+				schema.closed = !closed
+				break
+			}
+			schema.additional, err = compile(value, at+"/additionalProperties")
+		case "items":
+			schema.items, err = compile(value, at+"/items")
+		case "minItems":
+			schema.minItems, err = compileCount(value, at, keyword)
+		case "maxItems":
+			schema.maxItems, err = compileCount(value, at, keyword)
+		case "uniqueItems":
+			schema.uniqueItems, ok = value.(bool)
+
+			if !ok {
+				err = invalid(at, "uniqueItems must be a boolean")
+			}
+		case "minLength":
+			schema.minLength, err = compileCount(value, at, keyword)
+		case "maxLength":
+			schema.maxLength, err = compileCount(value, at, keyword)
+		case "pattern":
+			pattern, ok := value.(string)
+
+			if !ok {
+				err = invalid(at, "pattern must be a string")
+				break
+			}
+
+			if schema.pattern, err = regexp.Compile(pattern); err != nil {
+				err = invalid(at, "pattern: "+err.Error())
+			}
+		case "format":
+			format, ok := value.(string)
+
+			if _, known := formats[format]; !ok || !known {
+				err = invalid(at, fmt.Sprintf("unsupported format %v", value))
+			}
+
+			schema.format = format
+		case "minimum":
+			schema.minimum, err = compileNumber(value, at, keyword)
+		case "maximum":
+			schema.maximum, err = compileNumber(value, at, keyword)
+		case "exclusiveMinimum":
+			schema.exclusiveMinimum, err = compileNumber(value, at, keyword)
+		case "exclusiveMaximum":
+			schema.exclusiveMaximum, err = compileNumber(value, at, keyword)
+		default:
+			if !slices.Contains(annotations, keyword) {
+				err = invalid(at, "unsupported keyword "+keyword)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return schema, nil
+}
+
+func compileTypes(value any, at string) ([]string, error) {
+	if name, ok := value.(string); ok {
+		value = []any{name}
+	}
+
+	names, err := compileStrings(value, at+"/type")
+
+	if err != nil || len(names) == 0 {
+		return nil, invalid(at, "type must be a type name or an array of them")
+	}
+
+	for _, name := range names {
+		if !slices.Contains(types, name) {
+			return nil, invalid(at, "unknown type "+name)
+		}
+	}
+
+	return names, nil
+}
+
+func compileProperties(value any, at string) (map[string]*Schema, error) {
+	raw, ok := value.(map[string]any)
+
+	if !ok {
+		return nil, invalid(at, "properties must be an object")
+	}
+
+	var properties = make(map[string]*Schema, len(raw))
+
+	for name, property := range raw {
+		schema, err := compile(property, at+"/properties/"+name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		properties[name] = schema
+	}
+
+	return properties, nil
+}
+
+func compileStrings(value any, at string) ([]string, error) {
+	raw, ok := value.([]any)
+
+	if !ok {
+		return nil, invalid(at, "must be an array of strings")
+	}
+
+	var values = make([]string, 0, len(raw))
+
+	for _, element := range raw {
+		text, ok := element.(string)
+
+		if !ok {
+			return nil, invalid(at, "must be an array of strings")
+		}
+
+		values = append(values, text)
+	}
+
+	return values, nil
+}
+
+func compileCount(value any, at string, keyword string) (*int, error) {
+	number, ok := value.(float64)
+
+	if !ok || number < 0 || number != math.Trunc(number) {
+		return nil, invalid(at, keyword+" must be a non-negative integer")
+	}
+
+	var count = int(number)
+
+	return &count, nil
+}
+
+func compileNumber(value any, at string, keyword string) (*float64, error) {
+	number, ok := value.(float64)
+
+	if !ok {
+		return nil, invalid(at, keyword+" must be a number")
+	}
+
+	return &number, nil
+}
+
+func invalid(at string, message string) error {
+	return fmt.Errorf("%w: %s: %s", ErrInvalidSchema, at, message)
+}
+
+// Validate checks a JSON decoded value, violations are reported below path
+func (s *Schema) Validate(value any, path string) []Violation {
+	var violations []Violation
+
+	s.validate(value, path, &violations)
+
+	return violations
+}
+
+func (s *Schema) validate(value any, path string, violations *[]Violation) {
+	var violate = func(rule string, param string) {
+		*violations = append(*violations, Violation{Path: path, Rule: rule, Param: param})
+	}
+
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(name string) bool { return isType(value, name) }) {
+		violate("type", strings.Join(s.types, "|"))
+		return
+	}
+
+	if s.enum != nil && !slices.ContainsFunc(s.enum, func(allowed any) bool { return reflect.DeepEqual(allowed, value) }) {
+		violate("enum", "")
+	}
+
+	if s.hasConst && !reflect.DeepEqual(s.constant, value) {
+		violate("const", "")
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		s.validateObject(typed, path, violations)
+	case []any:
+		s.validateArray(typed, path, violations)
+	case string:
+		var length = utf8.RuneCountInString(typed)
+
+		if s.minLength != nil && length < *s.minLength {
+			violate("minLength", strconv.Itoa(*s.minLength))
+		}
+
+		if s.maxLength != nil && length > *s.maxLength {
+			violate("maxLength", strconv.Itoa(*s.maxLength))
+		}
+
+		if s.pattern != nil && !s.pattern.MatchString(typed) {
+			violate("pattern", "")
+		}
+
+		if s.format != "" && !formats[s.format](typed) {
+			violate("format", s.format)
+		}
+	case float64:
+		for _, bound := range []struct {
+			keyword string
+			limit   *float64
+			ok      func(limit float64) bool
+		}{
+			{"minimum", s.minimum, func(limit float64) bool { return typed >= limit }},
+			{"maximum", s.maximum, func(limit float64) bool { return typed <= limit }},
+			{"exclusiveMinimum", s.exclusiveMinimum, func(limit float64) bool { return typed > limit }},
+			{"exclusiveMaximum", s.exclusiveMaximum, func(limit float64) bool { return typed < limit }},
+		} {
+			if bound.limit != nil && !bound.ok(*bound.limit) {
+				violate(bound.keyword, strconv.FormatFloat(*bound.limit, 'g', -1, 64))
+			}
+		}
+	}
+}
+
+func (s *Schema) validateObject(object map[string]any, path string, violations *[]Violation) {
+	for _, name := range s.required {
+		if _, ok := object[name]; !ok {
+			*violations = append(*violations, Violation{Path: path + "." + name, Rule: "required"})
+		}
+	}
+
+	var names = make([]string, 0, len(object))
+
+	for name := range object {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, declared := s.properties[name]
+
+		switch {
+		case declared:
+			property.validate(object[name], path+"."+name, violations)
+		case s.closed:
+			*violations = append(*violations, Violation{Path: path + "." + name, Rule: "additionalProperties"})
+		case s.additional != nil:
+			s.additional.validate(object[name], path+"."+name, violations)
+		}
+	}
+}
+
+func (s *Schema) validateArray(array []any, path string, violations *[]Violation) {
+	if s.minItems != nil && len(array) < *s.minItems {
+		*violations = append(*violations, Violation{Path: path, Rule: "minItems", Param: strconv.Itoa(*s.minItems)})
+	}
+
+	if s.maxItems != nil && len(array) > *s.maxItems {
+		*violations = append(*violations, Violation{Path: path, Rule: "maxItems", Param: strconv.Itoa(*s.maxItems)})
+	}
+
+	if s.uniqueItems {
+		for i := range array {
+			if slices.ContainsFunc(array[:i], func(other any) bool { return reflect.DeepEqual(other, array[i]) }) {
+				*violations = append(*violations, Violation{Path: path, Rule: "uniqueItems"})
+				break
+			}
+		}
+	}
+
+	if s.items == nil {
+		return
+	}
+
+	for i, element := range array {
+		s.items.validate(element, path+"["+strconv.Itoa(i)+"]", violations)
+	}
+}
+
+// isType reports whether the JSON decoded value has the JSON Schema type, integers are numbers without fraction
+func isType(value any, name string) bool {
+	switch typed := value.(type) {
+	case nil:
+		return name == "null"
+	case bool:
+		return name == "boolean"
+	case map[string]any:
+		return name == "object"
+	case []any:
+		return name == "array"
+	case string:
+		return name == "string"
+	case float64:
+		return name == "number" || (name == "integer" && typed == math.Trunc(typed) && !math.IsInf(typed, 0))
+	}
+	return false
+}
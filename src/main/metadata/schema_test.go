@@ -0,0 +1,110 @@
+package metadata
+
+import (
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const accountSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"title": "Account",
+	"type": "object",
+	"required": ["id", "plan"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "string", "format": "uuid"},
+		"plan": {"enum": ["free", "pro"]},
+		"seats": {"type": "integer", "minimum": 1, "exclusiveMaximum": 100},
+		"owner": {"type": ["string", "null"], "format": "email"},
+		"code": {"type": "string", "pattern": "^[A-Z]{3}$", "minLength": 3, "maxLength": 3},
+		"since": {"type": "string", "format": "date"},
+		"labels": {"type": "array", "items": {"type": "string"}, "maxItems": 2, "uniqueItems": true},
+		"extra": {"type": "object", "additionalProperties": {"type": "number"}},
+		"kind": {"const": "account"}
+	}
+}`
+
+func decode(t *testing.T, document string) any {
+	var value any
+	assert.NoError(t, json.Unmarshal([]byte(document), &value))
+	return value
+}
+
+func details(violations []Violation) []string {
+	var found = make([]string, 0, len(violations))
+
+	for _, violation := range violations {
+		found = append(found, violation.Path+": "+violation.Rule+"="+violation.Param)
+	}
+
+	return found
+}
+
+func TestCompile(t *testing.T) {
+	_, err := Compile([]byte(accountSchema))
+
+	assert.NoError(t, err)
+
+	for document, message := range map[string]string{
+		`[]`:                                   "#: must be an object",
+		`{"type":"text"}`:                      "#: unknown type text",
+		`{"enum":[]}`:                          "#: enum must be a non-empty array",
+		`{"properties":{"a":{"minimum":"1"}}}`: "#/properties/a: minimum must be a number",
+		`{"items":{"maxItems":-1}}`:            "#/items: maxItems must be a non-negative integer",
+		`{"pattern":"("}`:                      "#: pattern: error parsing regexp",
+		`{"format":"ipv4"}`:                    "#: unsupported format ipv4",
+		`{"$ref":"#/defs/a"}`:                  "#: unsupported keyword $ref",
+		`{"required":"id"}`:                    "#/required: must be an array of strings",
+	} {
+		_, err = Compile([]byte(document))
+
+		assert.ErrorIs(t, err, ErrInvalidSchema, document)
+		assert.ErrorContains(t, err, message, document)
+	}
+
+	_, err = Compile([]byte(`{`))
+
+	assert.ErrorIs(t, err, ErrInvalidSchema)
+
+	slog.Info("TestCompile success")
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := Compile([]byte(accountSchema))
+
+	assert.NoError(t, err)
+
+	var valid = decode(t, `{"id":"7c0d5f6e-2a4b-4c1d-9e8f-0a1b2c3d4e5f","plan":"pro","seats":99,"owner":null,`+
+		`"code":"ABC","since":"2025-01-31","labels":["a","b"],"extra":{"x":1.5},"kind":"account"}`)
+
+	assert.Empty(t, schema.Validate(valid, "account"))
+
+	var invalid = decode(t, `{"id":"7c0d5f6e","plan":"gold","seats":100,"owner":"john","code":"abcd",`+
+		`"since":"31.01.2025","labels":["a","a",1],"extra":{"x":"y"},"kind":"user","name":"x"}`)
+
+	assert.Equal(t, []string{
+		"account.code: maxLength=3",
+		"account.code: pattern=",
+		"account.extra.x: type=number",
+		"account.id: format=uuid",
+		"account.kind: const=",
+		"account.labels: maxItems=2",
+		"account.labels: uniqueItems=",
+		"account.labels[2]: type=string",
+		"account.name: additionalProperties=",
+		"account.owner: format=email",
+		"account.plan: enum=",
+		"account.seats: exclusiveMaximum=100",
+		"account.since: format=date",
+	}, details(schema.Validate(invalid, "account")))
+
+	// missing required properties, a wrong type stops the checks of the value
+	assert.Equal(t, []string{"account.id: required=", "account.plan: required=", "account.seats: type=integer"},
+		details(schema.Validate(decode(t, `{"seats":1.5}`), "account")))
+	assert.Equal(t, []string{"account: type=object"}, details(schema.Validate("account", "account")))
+
+	slog.Info("TestSchemaValidate success")
+}
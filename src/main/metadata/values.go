@@ -0,0 +1,202 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// namespacePattern top-level keys of metadata with a schema, dots would clash with filter paths
+var namespacePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,49}$`)
+
+// ValidNamespace reports whether the name may be registered, e.g. team or billing_v2
+func ValidNamespace(namespace string) bool {
+	return namespacePattern.MatchString(namespace)
+}
+
+// Values custom metadata of a model, the top-level keys are namespaces owned by teams.
+// Paths of the accessors are dotted, e.g. team.name.
+type Values map[string]any
+
+// Namespaces top-level keys in sorted order
+func (v Values) Namespaces() []string {
+	var namespaces = make([]string, 0, len(v))
+
+	for namespace := range v {
+		namespaces = append(namespaces, namespace)
+	}
+
+	sort.Strings(namespaces)
+
+	return namespaces
+}
+
+// Lookup value at the dotted path, false when a step is missing or not an object
+func (v Values) Lookup(path string) (any, bool) {
+	var current any = map[string]any(v)
+
+	for _, key := range strings.Split(path, ".") {
+		var object map[string]any
+
+		switch typed := current.(type) {
+		case map[string]any:
+			object = typed
+		case Values:
+			object = typed
+		default:
+			return nil, false
+		}
+
+		value, ok := object[key]
+
+		if !ok {
+			return nil, false
+		}
+
+		current = value
+	}
+
+	return current, true
+}
+
+// String text at the path, false when it is missing or not a string
+func (v Values) String(path string) (string, bool) {
+	value, _ := v.Lookup(path)
+	text, ok := value.(string)
+	return text, ok
+}
+
+// Bool boolean at the path, false when it is missing or not a boolean
+func (v Values) Bool(path string) (value bool, ok bool) {
+	raw, _ := v.Lookup(path)
+	value, ok = raw.(bool)
+	return value, ok
+}
+
+// Float number at the path, stored JSON numbers and Go numbers alike
+func (v Values) Float(path string) (float64, bool) {
+	value, _ := v.Lookup(path)
+
+	switch typed := value.(type) {
+	case float64:
+		return typed, true
+	case float32:
+		return float64(typed), true
+	case int:
+		return float64(typed), true
+	case int32:
+		return float64(typed), true
+	case int64:
+		return float64(typed), true
+	case json.Number:
+		number, err := typed.Float64()
+		return number, err == nil
+	}
+
+	return 0, false
+}
+
+// Int integer at the path, false for numbers with a fraction
+func (v Values) Int(path string) (int64, bool) {
+	number, ok := v.Float(path)
+
+	if !ok || number != math.Trunc(number) || math.Abs(number) > 1<<53 {
+		return 0, false
+	}
+
+	return int64(number), true
+}
+
+// Strings array of texts at the path, false when any element is not a string
+func (v Values) Strings(path string) ([]string, bool) {
+	value, _ := v.Lookup(path)
+
+	switch typed := value.(type) {
+	case []string:
+		return typed, true
+	case []any:
+		var texts = make([]string, 0, len(typed))
+
+		for _, element := range typed {
+			text, ok := element.(string)
+
+			if !ok {
+				return nil, false
+			}
+
+			texts = append(texts, text)
+		}
+
+		return texts, true
+	}
+
+	return nil, false
+}
+
+// Decode unmarshals the namespace into dest like encoding/json, a missing namespace leaves dest unchanged
+// and returns false
+func (v Values) Decode(namespace string, dest any) (bool, error) {
+	value, ok := v[namespace]
+
+	if !ok {
+		return false, nil
+	}
+
+	content, err := json.Marshal(value)
+
+	if err == nil {
+		err = json.Unmarshal(content, dest)
+	}
+
+	if err != nil {
+		return true, fmt.Errorf("metadata %s: %w", namespace, err)
+	}
+
+	return true, nil
+}
+
+// Get typed namespace of the values, see Values.Decode
+func Get[T any](values Values, namespace string) (T, bool, error) {
+	var dest T
+
+	ok, err := values.Decode(namespace, &dest)
+
+	return dest, ok, err
+}
+
+// Schemas compiled schemas by namespace
+type Schemas map[string]*Schema
+
+// Validate checks every namespace with a schema, paths start with metadata, e.g. metadata.team.name.
+// Namespaces without a schema pass.
+func (s Schemas) Validate(values Values) ([]Violation, error) {
+	if len(values) == 0 || len(s) == 0 {
+		return nil, nil
+	}
+
+	// stored values are JSON, Go values are checked the way they will be read back
+	content, err := json.Marshal(values)
+
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+
+	var decoded map[string]any
+
+	if err = json.Unmarshal(content, &decoded); err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+
+	var violations []Violation
+
+	for _, namespace := range Values(decoded).Namespaces() {
+		if schema, ok := s[namespace]; ok {
+			violations = append(violations, schema.Validate(decoded[namespace], "metadata."+namespace)...)
+		}
+	}
+
+	return violations, nil
+}
@@ -0,0 +1,118 @@
+package metadata
+
+import (
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type team struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+func TestValues(t *testing.T) {
+	var values Values
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"team":{"name":"core","roles":["lead","dev"],"size":4,"remote":true},"score":2.5}`), &values))
+
+	assert.Equal(t, []string{"score", "team"}, values.Namespaces())
+
+	name, ok := values.String("team.name")
+
+	assert.True(t, ok)
+	assert.Equal(t, "core", name)
+
+	_, ok = values.String("team.size")
+
+	assert.False(t, ok)
+
+	_, ok = values.String("team.name.first")
+
+	assert.False(t, ok)
+
+	size, ok := values.Int("team.size")
+
+	assert.True(t, ok)
+	assert.Equal(t, int64(4), size)
+
+	_, ok = values.Int("score")
+
+	assert.False(t, ok)
+
+	score, ok := values.Float("score")
+
+	assert.True(t, ok)
+	assert.Equal(t, 2.5, score)
+
+	remote, ok := values.Bool("team.remote")
+
+	assert.True(t, ok)
+	assert.True(t, remote)
+
+	roles, ok := values.Strings("team.roles")
+
+	assert.True(t, ok)
+	assert.Equal(t, []string{"lead", "dev"}, roles)
+
+	// values set in Go read the same as stored ones
+	values["team"] = Values{"size": 5}
+
+	size, ok = values.Int("team.size")
+
+	assert.True(t, ok)
+	assert.Equal(t, int64(5), size)
+
+	values["team"] = map[string]any{"name": "infra", "roles": []string{"ops"}}
+
+	decoded, ok, err := Get[team](values, "team")
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, team{Name: "infra", Roles: []string{"ops"}}, decoded)
+
+	_, ok, err = Get[team](values, "billing")
+
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = Get[team](values, "score")
+
+	assert.Error(t, err)
+	assert.True(t, ok)
+
+	assert.True(t, ValidNamespace("billing_v2"))
+	assert.False(t, ValidNamespace("team.name"))
+	assert.False(t, ValidNamespace("2fa"))
+
+	slog.Info("TestValues success")
+}
+
+func TestSchemasValidate(t *testing.T) {
+	schema, err := Compile([]byte(`{"type":"object","properties":{"size":{"type":"integer","minimum":1}}}`))
+
+	assert.NoError(t, err)
+
+	var schemas = Schemas{"team": schema}
+
+	// Go values are checked as JSON, namespaces without a schema pass
+	violations, err := schemas.Validate(Values{"team": map[string]any{"size": 0}, "notes": []int{1}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Violation{{Path: "metadata.team.size", Rule: "minimum", Param: "1"}}, violations)
+
+	violations, err = schemas.Validate(Values{"team": struct {
+		Size int `json:"size"`
+	}{Size: 3}})
+
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+
+	_, err = schemas.Validate(Values{"team": func() {}})
+
+	assert.Error(t, err)
+
+	slog.Info("TestSchemasValidate success")
+}
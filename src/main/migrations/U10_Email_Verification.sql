@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "users"."email_verifications";
+
+ALTER TABLE "users"."profiles"
+    DROP COLUMN IF EXISTS "email_verified";
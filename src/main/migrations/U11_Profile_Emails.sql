@@ -0,0 +1,15 @@
+ALTER TABLE "users"."email_verifications"
+    DROP COLUMN IF EXISTS "is_primary";
+
+ALTER TABLE "users"."profiles"
+    ADD COLUMN "email" varchar(50)[] DEFAULT array []::varchar[];
+
+UPDATE "users"."profiles" AS "profile"
+SET "email" = "address"."emails"
+FROM (SELECT "profile_id", array_agg("email" ORDER BY "created") AS "emails"
+      FROM "users"."profile_emails"
+      WHERE NOT "is_primary"
+      GROUP BY "profile_id") AS "address"
+WHERE "address"."profile_id" = "profile"."id";
+
+DROP TABLE IF EXISTS "users"."profile_emails";
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS "users"."phone_verifications";
+
+DROP INDEX IF EXISTS "users"."profiles_phone_e164_idx";
+
+ALTER TABLE "users"."profiles"
+    DROP COLUMN IF EXISTS "phone_verified",
+    DROP COLUMN IF EXISTS "phone_e164";
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "users"."attachments_metadata_idx";
+
+DROP INDEX IF EXISTS "users"."profiles_metadata_idx";
+
+DROP TABLE IF EXISTS "users"."metadata_schemas";
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "users"."attachments";
+
+DROP TABLE IF EXISTS "users"."profiles";
+
+DROP schema IF EXISTS "users";
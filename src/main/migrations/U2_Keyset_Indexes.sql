@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "users"."attachments_user_id_created_id_idx";
+
+DROP INDEX IF EXISTS "users"."attachments_created_id_idx";
+
+DROP INDEX IF EXISTS "users"."profiles_created_id_idx";
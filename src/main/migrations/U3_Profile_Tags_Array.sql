@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS "users"."profiles_tags_idx";
+
+ALTER TABLE "users"."profiles"
+    ALTER COLUMN "tags" DROP DEFAULT;
+
+ALTER TABLE "users"."profiles"
+    ALTER COLUMN "tags" TYPE varchar(50) USING "tags"::varchar(50);
+
+ALTER TABLE "users"."profiles"
+    ALTER COLUMN "tags" SET DEFAULT array[]::varchar[];
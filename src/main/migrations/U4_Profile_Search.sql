@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS "users"."profiles_login_trgm_idx";
+
+DROP INDEX IF EXISTS "users"."profiles_search_vector_idx";
+
+ALTER TABLE "users"."profiles"
+    DROP COLUMN IF EXISTS "search_vector";
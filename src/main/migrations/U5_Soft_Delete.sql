@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS "users"."attachments_deleted_at_idx";
+
+DROP INDEX IF EXISTS "users"."profiles_deleted_at_idx";
+
+ALTER TABLE "users"."attachments"
+    DROP COLUMN IF EXISTS "deleted_at";
+
+ALTER TABLE "users"."profiles"
+    DROP COLUMN IF EXISTS "deleted_at";
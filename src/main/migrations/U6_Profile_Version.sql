@@ -0,0 +1,2 @@
+ALTER TABLE "users"."profiles"
+    DROP COLUMN IF EXISTS "version";
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS "users"."profiles_external_id_key";
@@ -0,0 +1,10 @@
+-- unique placeholders, profiles without email cannot share ''
+UPDATE "users"."profiles"
+SET "primary_email" = "id"::text || '@invalid'
+WHERE "primary_email" IS NULL;
+
+ALTER TABLE "users"."profiles"
+    ALTER COLUMN "primary_email" SET NOT NULL;
+
+ALTER TABLE "users"."profiles"
+    DROP COLUMN IF EXISTS "identity_sync";
@@ -0,0 +1,19 @@
+-- existing addresses were never confirmed and stay unverified
+ALTER TABLE "users"."profiles"
+    ADD COLUMN "email_verified" timestamp;
+
+CREATE TABLE "users"."email_verifications"
+(
+    "id"         uuid        NOT NULL DEFAULT uuid_generate_v4(),
+    "created"    timestamp   NOT NULL,
+    "profile_id" uuid        NOT NULL,
+    "email"      varchar(50) NOT NULL,
+    "token_hash" varchar(64) NOT NULL,
+    "expires"    timestamp   NOT NULL,
+    "consumed"   timestamp,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "email_verifications_token_hash_key" UNIQUE ("token_hash"),
+    CONSTRAINT "email_verifications_profile_id_fkey" FOREIGN KEY ("profile_id") REFERENCES "users"."profiles" ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS "email_verifications_pending_idx" ON "users"."email_verifications" ("profile_id", "created") WHERE "consumed" IS NULL;
@@ -0,0 +1,65 @@
+CREATE TABLE "users"."profile_emails"
+(
+    "id"         uuid        NOT NULL DEFAULT uuid_generate_v4(),
+    "created"    timestamp   NOT NULL,
+    "profile_id" uuid        NOT NULL,
+    "email"      varchar(50) NOT NULL,
+    "verified"   timestamp,
+    "is_primary" boolean     NOT NULL DEFAULT false,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "profile_emails_profile_id_fkey" FOREIGN KEY ("profile_id") REFERENCES "users"."profiles" ("id") ON DELETE CASCADE
+);
+
+-- a verified address belongs to one profile whatever its case, unverified copies do not reserve it
+CREATE UNIQUE INDEX IF NOT EXISTS "profile_emails_email_key" ON "users"."profile_emails" (lower("email")) WHERE "verified" IS NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS "profile_emails_profile_email_key" ON "users"."profile_emails" ("profile_id", lower("email"));
+
+CREATE UNIQUE INDEX IF NOT EXISTS "profile_emails_primary_key" ON "users"."profile_emails" ("profile_id") WHERE "is_primary";
+
+-- primary_email was unique by case only, verified addresses differing only by case must be resolved by hand,
+-- unverified ones do not reserve the address and are copied as they are
+DO
+$$
+    DECLARE
+        collisions text;
+    BEGIN
+        SELECT string_agg("email", ', ' ORDER BY "email")
+        INTO collisions
+        FROM (SELECT lower("primary_email") AS "email"
+              FROM "users"."profiles"
+              WHERE "primary_email" IS NOT NULL
+                AND "primary_email" NOT LIKE '%@invalid'
+                AND "email_verified" IS NOT NULL
+              GROUP BY lower("primary_email")
+              HAVING count(*) > 1) AS "duplicate";
+
+        IF collisions IS NOT NULL THEN
+            RAISE EXCEPTION 'verified primary emails differing only by case: %', collisions
+                USING HINT = 'change primary_email or clear email_verified of all but one profile per address, then migrate again';
+        END IF;
+    END
+$$;
+
+-- primary addresses first so they win over secondary copies, placeholders of profiles without email are skipped
+INSERT INTO "users"."profile_emails" ("created", "profile_id", "email", "verified", "is_primary")
+SELECT "created", "id", "primary_email", "email_verified", true
+FROM "users"."profiles"
+WHERE "primary_email" IS NOT NULL
+  AND "primary_email" NOT LIKE '%@invalid';
+
+-- secondary addresses were never verified, each profile keeps its copy once, its primary address wins
+INSERT INTO "users"."profile_emails" ("created", "profile_id", "email", "is_primary")
+SELECT DISTINCT ON ("profile"."id", lower("address"."email")) "profile"."created", "profile"."id", "address"."email", false
+FROM "users"."profiles" AS "profile",
+     unnest("profile"."email") WITH ORDINALITY AS "address" ("email", "position")
+WHERE "address"."email" <> ''
+ORDER BY "profile"."id", lower("address"."email"), "address"."position"
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE "users"."profiles"
+    DROP COLUMN "email";
+
+-- verifications mailed before confirmed primary addresses only
+ALTER TABLE "users"."email_verifications"
+    ADD COLUMN "is_primary" boolean NOT NULL DEFAULT true;
@@ -0,0 +1,31 @@
+-- the typed number stays in "phone" for display, lookups and verification use the E.164 form
+ALTER TABLE "users"."profiles"
+    ADD COLUMN "phone_e164"     varchar(16),
+    ADD COLUMN "phone_verified" timestamp;
+
+-- numbers typed with a country code are normalized here, the others on their next edit with the default region
+UPDATE "users"."profiles"
+SET "phone_e164" = '+' || regexp_replace("phone", '[^0-9]', '', 'g')
+WHERE "phone" ~ '^\s*\+'
+  AND regexp_replace("phone", '[^0-9]', '', 'g') ~ '^[1-9][0-9]{7,14}$';
+
+CREATE INDEX IF NOT EXISTS "profiles_phone_e164_idx" ON "users"."profiles" ("phone_e164") WHERE "deleted_at" IS NULL;
+
+CREATE TABLE "users"."phone_verifications"
+(
+    "id"         uuid        NOT NULL DEFAULT uuid_generate_v4(),
+    "created"    timestamp   NOT NULL,
+    "profile_id" uuid        NOT NULL,
+    "phone"      varchar(16) NOT NULL,
+    "code_hash"  varchar(64) NOT NULL,
+    "expires"    timestamp   NOT NULL,
+    "attempts"   integer     NOT NULL DEFAULT 0,
+    "consumed"   timestamp,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "phone_verifications_profile_id_fkey" FOREIGN KEY ("profile_id") REFERENCES "users"."profiles" ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS "phone_verifications_pending_idx" ON "users"."phone_verifications" ("profile_id", "created") WHERE "consumed" IS NULL;
+
+-- codes texted to a number are rate limited, consumed ones included
+CREATE INDEX IF NOT EXISTS "phone_verifications_issued_idx" ON "users"."phone_verifications" ("profile_id", "phone", "created");
@@ -0,0 +1,18 @@
+-- JSON Schema documents validating the metadata namespace of the same name, see metadata.Schema
+CREATE TABLE "users"."metadata_schemas"
+(
+    "id"          uuid        NOT NULL DEFAULT uuid_generate_v4(),
+    "created"     timestamp   NOT NULL,
+    "changed"     timestamp   NOT NULL,
+    "version"     bigint      NOT NULL DEFAULT 1,
+    "namespace"   varchar(50) NOT NULL,
+    "description" text        NOT NULL DEFAULT '',
+    "document"    jsonb       NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "metadata_schemas_namespace_key" UNIQUE ("namespace")
+);
+
+-- containment filters, metadata @> '{"team":{"name":"core"}}'
+CREATE INDEX IF NOT EXISTS "profiles_metadata_idx" ON "users"."profiles" USING gin ("metadata" jsonb_path_ops);
+
+CREATE INDEX IF NOT EXISTS "attachments_metadata_idx" ON "users"."attachments" USING gin ("metadata" jsonb_path_ops);
@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS "profiles_created_id_idx" ON "users"."profiles" ("created", "id");
+
+CREATE INDEX IF NOT EXISTS "attachments_created_id_idx" ON "users"."attachments" ("created", "id");
+
+CREATE INDEX IF NOT EXISTS "attachments_user_id_created_id_idx" ON "users"."attachments" ("user_id", "created", "id");
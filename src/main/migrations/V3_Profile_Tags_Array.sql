@@ -0,0 +1,10 @@
+ALTER TABLE "users"."profiles"
+    ALTER COLUMN "tags" DROP DEFAULT;
+
+ALTER TABLE "users"."profiles"
+    ALTER COLUMN "tags" TYPE varchar(50)[] USING COALESCE(NULLIF("tags", ''), '{}')::varchar(50)[];
+
+ALTER TABLE "users"."profiles"
+    ALTER COLUMN "tags" SET DEFAULT array[]::varchar[];
+
+CREATE INDEX IF NOT EXISTS "profiles_tags_idx" ON "users"."profiles" USING gin ("tags");
@@ -0,0 +1,14 @@
+CREATE EXTENSION IF NOT EXISTS "pg_trgm";
+
+-- names of private profiles stay searchable, their biography and company do not
+ALTER TABLE "users"."profiles"
+    ADD COLUMN "search_vector" tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce("fist_name", '') || ' ' || coalesce("middle_name", '') || ' ' ||
+                                        coalesce("last_name", '')), 'A') ||
+        setweight(to_tsvector('simple', CASE WHEN "private" IS FALSE THEN coalesce("company", '') ELSE '' END), 'B') ||
+        setweight(to_tsvector('simple', CASE WHEN "private" IS FALSE THEN coalesce("biography", '') ELSE '' END), 'C')
+        ) STORED;
+
+CREATE INDEX IF NOT EXISTS "profiles_search_vector_idx" ON "users"."profiles" USING gin ("search_vector");
+
+CREATE INDEX IF NOT EXISTS "profiles_login_trgm_idx" ON "users"."profiles" USING gin ("login" gin_trgm_ops);
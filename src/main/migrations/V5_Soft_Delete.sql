@@ -0,0 +1,9 @@
+ALTER TABLE "users"."profiles"
+    ADD COLUMN "deleted_at" timestamptz;
+
+ALTER TABLE "users"."attachments"
+    ADD COLUMN "deleted_at" timestamptz;
+
+CREATE INDEX IF NOT EXISTS "profiles_deleted_at_idx" ON "users"."profiles" ("deleted_at") WHERE "deleted_at" IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS "attachments_deleted_at_idx" ON "users"."attachments" ("deleted_at") WHERE "deleted_at" IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE "users"."profiles"
+    ADD COLUMN "version" bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,16 @@
+CREATE TABLE "users"."audit_log"
+(
+    "id"          bigserial   NOT NULL,
+    "created"     timestamp   NOT NULL,
+    "actor_id"    uuid,
+    "entity_type" varchar(50) NOT NULL,
+    "entity_id"   uuid        NOT NULL,
+    "operation"   varchar(20) NOT NULL,
+    "diff"        jsonb       NOT NULL DEFAULT '{}',
+    "state"       jsonb       NOT NULL DEFAULT '{}',
+    PRIMARY KEY ("id")
+);
+
+CREATE INDEX IF NOT EXISTS "audit_log_entity_idx" ON "users"."audit_log" ("entity_type", "entity_id", "id");
+
+CREATE INDEX IF NOT EXISTS "audit_log_actor_idx" ON "users"."audit_log" ("actor_id", "created") WHERE "actor_id" IS NOT NULL;
@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS "profiles_external_id_key" ON "users"."profiles" ("external_id");
@@ -0,0 +1,10 @@
+ALTER TABLE "users"."profiles"
+    ADD COLUMN "identity_sync" jsonb;
+
+-- provisioned profiles may have no email, NULLs do not collide in the unique constraint
+ALTER TABLE "users"."profiles"
+    ALTER COLUMN "primary_email" DROP NOT NULL;
+
+UPDATE "users"."profiles"
+SET "primary_email" = NULL
+WHERE "primary_email" = '';
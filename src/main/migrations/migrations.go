@@ -0,0 +1,307 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Files migration sources: V<version>_<name>.sql applies, U<version>_<name>.sql reverts
+//
+//go:embed *.sql
+var Files embed.FS
+
+// lockID postgres advisory lock key guarding concurrent migrators
+const lockID int64 = 7_311_624_023
+
+const createTableQuery = `CREATE TABLE IF NOT EXISTS "public"."schema_migrations"
+(
+    "version"  integer      NOT NULL,
+    "name"     varchar(255) NOT NULL,
+    "checksum" varchar(64)  NOT NULL,
+    "applied"  timestamp    NOT NULL,
+    PRIMARY KEY ("version")
+)`
+
+var fileNamePattern = regexp.MustCompile(`^([VU])(\d+)_(.+)\.sql$`)
+
+var ErrChecksumMismatch = errors.New("applied migration checksum mismatch")
+var ErrNoDownMigration = errors.New("no down migration")
+
+// Migration a single versioned schema change
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 of Up
+}
+
+// AppliedMigration schema_migrations table row
+type AppliedMigration struct {
+	bun.BaseModel `bun:"table:public.schema_migrations"`
+	Version       int       `bun:"version,pk"`
+	Name          string    `bun:"name,notnull"`
+	Checksum      string    `bun:"checksum,notnull"`
+	Applied       time.Time `bun:"applied,notnull"`
+}
+
+// Status state of a known migration
+type Status struct {
+	Version  int
+	Name     string
+	Applied  *time.Time // nil when pending
+	Modified bool       // file changed after it was applied
+}
+
+type Migrator struct {
+	db         *bun.DB
+	migrations []*Migration
+}
+
+// New migrator over the embedded migration files
+func New(db *bun.DB) (*Migrator, error) {
+	return NewFromFS(db, Files)
+}
+
+// NewFromFS migrator over the migration files in the root of fsys
+func NewFromFS(db *bun.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load reads and orders migrations by version
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var byVersion = map[int]*Migration{}
+
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(match[2])
+
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+
+		if !ok {
+			migration = &Migration{Version: version, Name: match[3]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != match[3] {
+			return nil, fmt.Errorf("migration %d has different names: %s, %s", version, migration.Name, match[3])
+		}
+
+		switch match[1] {
+		case "V":
+			sum := sha256.Sum256(content)
+			migration.Up = string(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		case "U":
+			migration.Down = string(content)
+		}
+	}
+
+	var migrations = make([]*Migration, 0, len(byVersion))
+
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no V file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies all pending migrations in a single transaction
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	var applied []*Migration
+
+	err := m.locked(ctx, func(ctx context.Context, tx bun.Tx, done map[int]*AppliedMigration) error {
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			if _, err := tx.Tx.ExecContext(ctx, migration.Up); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			row := &AppliedMigration{
+				Version:  migration.Version,
+				Name:     migration.Name,
+				Checksum: migration.Checksum,
+				Applied:  time.Now().UTC(),
+			}
+
+			if _, err := tx.NewInsert().Model(row).Exec(ctx); err != nil {
+				return err
+			}
+
+			slog.Info("Migration applied", slog.Int("version", migration.Version), slog.String("name", migration.Name))
+
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// Down reverts the latest applied migration, returns nil when nothing is applied
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var reverted *Migration
+
+	err := m.locked(ctx, func(ctx context.Context, tx bun.Tx, done map[int]*AppliedMigration) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+
+			if migration.Down == "" {
+				return fmt.Errorf("%w: %d_%s", ErrNoDownMigration, migration.Version, migration.Name)
+			}
+
+			if _, err := tx.Tx.ExecContext(ctx, migration.Down); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			_, err := tx.NewDelete().Model((*AppliedMigration)(nil)).Where("version = ?", migration.Version).Exec(ctx)
+
+			if err != nil {
+				return err
+			}
+
+			slog.Info("Migration reverted", slog.Int("version", migration.Version), slog.String("name", migration.Name))
+
+			reverted = migration
+			return nil
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return reverted, nil
+}
+
+// Status lists known migrations with their applied state
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var table sql.NullString
+
+	err := m.db.NewRaw("SELECT to_regclass('public.schema_migrations')::text").Scan(ctx, &table)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*AppliedMigration
+
+	if table.Valid {
+		if err = m.db.NewSelect().Model(&rows).Scan(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var done = map[int]*AppliedMigration{}
+
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+
+	var statuses = make([]Status, 0, len(m.migrations))
+
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+
+		if row, ok := done[migration.Version]; ok {
+			status.Applied = &row.Applied
+			status.Modified = row.Checksum != migration.Checksum
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// locked runs fn in a transaction holding the advisory lock, after applied checksums are verified
+func (m *Migrator) locked(ctx context.Context, fn func(ctx context.Context, tx bun.Tx, done map[int]*AppliedMigration) error) error {
+	return m.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(?)", lockID); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, createTableQuery); err != nil {
+			return err
+		}
+
+		var rows []*AppliedMigration
+
+		if err := tx.NewSelect().Model(&rows).Scan(ctx); err != nil {
+			return err
+		}
+
+		var done = map[int]*AppliedMigration{}
+
+		for _, row := range rows {
+			done[row.Version] = row
+		}
+
+		for _, migration := range m.migrations {
+			if row, ok := done[migration.Version]; ok && row.Checksum != migration.Checksum {
+				return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, migration.Version, migration.Name)
+			}
+		}
+
+		return fn(ctx, tx, done)
+	})
+}
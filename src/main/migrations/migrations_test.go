@@ -0,0 +1,180 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+var testFS = fstest.MapFS{
+	"V2_Second.sql": {Data: []byte("CREATE TABLE second ();")},
+	"V1_First.sql":  {Data: []byte("CREATE TABLE first ();")},
+	"U1_First.sql":  {Data: []byte("DROP TABLE first;")},
+	"README.md":     {Data: []byte("not a migration")},
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(testFS)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(migrations))
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "First", migrations[0].Name)
+	assert.Equal(t, "DROP TABLE first;", migrations[0].Down)
+	assert.Equal(t, 64, len(migrations[0].Checksum))
+	assert.Equal(t, 2, migrations[1].Version)
+	assert.Empty(t, migrations[1].Down)
+
+	_, err = Load(fstest.MapFS{"U1_First.sql": {Data: []byte("DROP TABLE first;")}})
+
+	assert.Error(t, err)
+
+	embedded, err := Load(Files)
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, embedded)
+	assert.Equal(t, 1, embedded[0].Version)
+	assert.NotEmpty(t, embedded[0].Down)
+
+	slog.Info("TestLoad success")
+}
+
+func TestUp(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	var migrations, _ = Load(testFS)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(7311624023\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS "public"."schema_migrations"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT .* FROM "public"."schema_migrations"`).
+		WillReturnRows(mock.NewRows([]string{"version", "name", "checksum", "applied"}).
+			AddRow(1, "First", migrations[0].Checksum, time.Now()))
+	mock.ExpectExec(`CREATE TABLE second \(\);`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "public"."schema_migrations" .* VALUES \(2, 'Second', '` + migrations[1].Checksum + `'`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	applied, err := migrator.Up(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(applied))
+	assert.Equal(t, 2, applied[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestUp success")
+}
+
+func TestUpChecksumMismatch(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT .* FROM "public"."schema_migrations"`).
+		WillReturnRows(mock.NewRows([]string{"version", "name", "checksum", "applied"}).
+			AddRow(1, "First", "changed", time.Now()))
+	mock.ExpectRollback()
+
+	applied, err := migrator.Up(context.Background())
+
+	assert.Nil(t, applied)
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestUpChecksumMismatch success")
+}
+
+func TestDown(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	var migrations, _ = Load(testFS)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT .* FROM "public"."schema_migrations"`).
+		WillReturnRows(mock.NewRows([]string{"version", "name", "checksum", "applied"}).
+			AddRow(1, "First", migrations[0].Checksum, time.Now()).
+			AddRow(2, "Second", migrations[1].Checksum, time.Now()))
+	mock.ExpectRollback()
+
+	reverted, err := migrator.Down(context.Background())
+
+	assert.Nil(t, reverted)
+	assert.True(t, errors.Is(err, ErrNoDownMigration))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT .* FROM "public"."schema_migrations"`).
+		WillReturnRows(mock.NewRows([]string{"version", "name", "checksum", "applied"}).
+			AddRow(1, "First", migrations[0].Checksum, time.Now()))
+	mock.ExpectExec(`DROP TABLE first;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM "public"."schema_migrations" AS "applied_migration" WHERE \(version = 1\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reverted, err = migrator.Down(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reverted.Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestDown success")
+}
+
+func TestStatus(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	var migrations, _ = Load(testFS)
+
+	mock.ExpectQuery(`SELECT to_regclass`).WillReturnRows(mock.NewRows([]string{"to_regclass"}).AddRow(nil))
+
+	statuses, err := migrator.Status(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(statuses))
+	assert.Nil(t, statuses[0].Applied)
+	assert.Nil(t, statuses[1].Applied)
+
+	mock.ExpectQuery(`SELECT to_regclass`).
+		WillReturnRows(mock.NewRows([]string{"to_regclass"}).AddRow("schema_migrations"))
+	mock.ExpectQuery(`SELECT .* FROM "public"."schema_migrations"`).
+		WillReturnRows(mock.NewRows([]string{"version", "name", "checksum", "applied"}).
+			AddRow(1, "First", migrations[0].Checksum, time.Now()).
+			AddRow(2, "Second", "changed", time.Now()))
+
+	statuses, err = migrator.Status(context.Background())
+
+	assert.NoError(t, err)
+	assert.NotNil(t, statuses[0].Applied)
+	assert.False(t, statuses[0].Modified)
+	assert.True(t, statuses[1].Modified)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestStatus success")
+}
+
+func newTestMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+
+	if err != nil {
+		t.Fatalf("An error was not expected when opening a stub database connection: %s", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	migrator, err := NewFromFS(bun.NewDB(db, pgdialect.New()), testFS)
+
+	if err != nil {
+		t.Fatalf("An error was not expected when loading migrations: %s", err)
+	}
+
+	return migrator, mock
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// AuditEntry change of an entity, rows outlive the entity and have no foreign keys
+type AuditEntry struct {
+	bun.BaseModel `bun:"table:users.audit_log,alias:audit"`
+	ID            int64                      `bun:"id,pk,autoincrement"`
+	Created       time.Time                  `bun:"type:timestamp,notnull"`
+	ActorID       uuid.UUID                  `bun:"type:uuid,nullzero"` // profile acting, empty for system changes
+	EntityType    string                     `bun:"type:varchar(50),notnull"`
+	EntityID      uuid.UUID                  `bun:"type:uuid,notnull"`
+	Operation     string                     `bun:"type:varchar(20),notnull"`
+	Diff          map[string]FieldChange     `bun:"type:jsonb,notnull"` // changed columns
+	State         map[string]json.RawMessage `bun:"type:jsonb,notnull"` // stored columns after the change, base of the next diff
+}
+
+// FieldChange column value before and after a change, absent when the entity did not exist
+type FieldChange struct {
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+}
@@ -35,18 +35,43 @@ type NotModifiable struct {
 	Created time.Time `bun:"type:timestamp not null"`
 }
 
+func (i NotModifiable) GetCreated() time.Time {
+	return i.Created
+}
+
 type Modifiable struct {
 	NotModifiable
 	Changed time.Time `bun:"type:timestamp not null"`
+	Version int64     `bun:"type:bigint,notnull,default:1"` // optimistic lock, incremented by every update
+}
+
+func (m Modifiable) GetVersion() int64 {
+	return m.Version
+}
+
+func (m *Modifiable) SetVersion(version int64) {
+	m.Version = version
+}
+
+// SoftDeletable bun soft delete, NewDelete sets DeletedAt and selects skip deleted rows
+type SoftDeletable struct {
+	DeletedAt time.Time `bun:"type:timestamptz,soft_delete,nullzero"`
+}
+
+func (s SoftDeletable) IsDeleted() bool {
+	return !s.DeletedAt.IsZero()
 }
 
 var _ bun.BeforeAppendModelHook = (*NotModifiable)(nil)
 var _ bun.BeforeAppendModelHook = (*Modifiable)(nil)
 
+// BeforeAppendModel stamps inserts, a Created set by the caller's clock is kept
 func (i *NotModifiable) BeforeAppendModel(_ context.Context, query schema.Query) error {
 	switch query.(type) {
 	case *bun.InsertQuery:
-		i.Created = time.Now().UTC()
+		if i.Created.IsZero() {
+			i.Created = time.Now().UTC()
+		}
 	}
 	return nil
 }
@@ -56,8 +81,10 @@ func (m *Modifiable) BeforeAppendModel(_ context.Context, query schema.Query) er
 	case *bun.InsertQuery:
 		m.Created = time.Now().UTC()
 		m.Changed = time.Now().UTC()
+		m.Version = 1
 	case *bun.UpdateQuery:
 		m.Changed = time.Now().UTC()
+		m.Version++
 	}
 	return nil
 }
@@ -0,0 +1,124 @@
+package common
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/uptrace/bun"
+)
+
+// Operation kind of an entity change
+type Operation string
+
+const (
+	OpInsert Operation = "insert"
+	OpUpdate Operation = "update"
+	OpDelete Operation = "delete" // soft delete included
+)
+
+// Stage when a listener is notified relative to the statement
+type Stage int
+
+const (
+	BeforeChange Stage = iota
+	AfterChange
+)
+
+// Change entity change reported to listeners, Entity is nil for statements without a model value
+type Change struct {
+	Stage     Stage
+	Operation Operation
+	Model     string // bun model name, e.g. profile
+	Entity    any    // pointer to the model struct
+}
+
+// ChangeListener is notified around inserts, updates and deletes of NotModifiable entities.
+// An error fails the statement, the statement itself is not undone outside a transaction.
+type ChangeListener func(ctx context.Context, change Change) error
+
+var listeners = struct {
+	sync.RWMutex
+	byId map[int]ChangeListener
+	next int
+}{byId: map[int]ChangeListener{}}
+
+// OnChange registers the listener until the returned function is called
+func OnChange(listener ChangeListener) (remove func()) {
+	listeners.Lock()
+	defer listeners.Unlock()
+
+	var id = listeners.next
+	listeners.next++
+	listeners.byId[id] = listener
+
+	return func() {
+		listeners.Lock()
+		defer listeners.Unlock()
+		delete(listeners.byId, id)
+	}
+}
+
+var _ bun.AfterInsertHook = (*NotModifiable)(nil)
+var _ bun.BeforeUpdateHook = (*NotModifiable)(nil)
+var _ bun.AfterUpdateHook = (*NotModifiable)(nil)
+var _ bun.BeforeDeleteHook = (*NotModifiable)(nil)
+var _ bun.AfterDeleteHook = (*NotModifiable)(nil)
+
+// bun calls the hooks on a zero value of the model type, the changed entity is the query model
+
+func (i *NotModifiable) AfterInsert(ctx context.Context, query *bun.InsertQuery) error {
+	return notify(ctx, AfterChange, OpInsert, query)
+}
+
+func (i *NotModifiable) BeforeUpdate(ctx context.Context, query *bun.UpdateQuery) error {
+	return notify(ctx, BeforeChange, OpUpdate, query)
+}
+
+func (i *NotModifiable) AfterUpdate(ctx context.Context, query *bun.UpdateQuery) error {
+	return notify(ctx, AfterChange, OpUpdate, query)
+}
+
+func (i *NotModifiable) BeforeDelete(ctx context.Context, query *bun.DeleteQuery) error {
+	return notify(ctx, BeforeChange, OpDelete, query)
+}
+
+func (i *NotModifiable) AfterDelete(ctx context.Context, query *bun.DeleteQuery) error {
+	return notify(ctx, AfterChange, OpDelete, query)
+}
+
+type modelQuery interface {
+	GetModel() bun.Model
+}
+
+func notify(ctx context.Context, stage Stage, operation Operation, query modelQuery) error {
+	listeners.RLock()
+	var notified = make([]ChangeListener, 0, len(listeners.byId))
+	for _, listener := range listeners.byId {
+		notified = append(notified, listener)
+	}
+	listeners.RUnlock()
+
+	if len(notified) == 0 {
+		return nil
+	}
+
+	var change = Change{Stage: stage, Operation: operation}
+
+	if tableModel, ok := query.GetModel().(bun.TableModel); ok {
+		change.Model = tableModel.Table().ModelName
+	}
+
+	if value := reflect.ValueOf(query.GetModel().Value()); value.Kind() == reflect.Pointer && !value.IsNil() &&
+		value.Elem().Kind() == reflect.Struct {
+		change.Entity = value.Interface()
+	}
+
+	for _, listener := range notified {
+		if err := listener(ctx, change); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"cabinet/src/main/model/common"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// ProfileEmail address of a profile, unique over all profiles ignoring case. The primary address
+// is mirrored by Profile.PrimaryEmail and Profile.EmailVerified.
+type ProfileEmail struct {
+	bun.BaseModel `bun:"table:users.profile_emails,alias:profile_email"`
+	common.NotModifiable
+	ProfileID uuid.UUID `bun:"type:uuid,notnull"`
+	Email     string    `bun:"type:varchar(50),notnull" validate:"required,email"`
+	Verified  time.Time `bun:"type:timestamp,nullzero"` // when the address was confirmed, zero while unverified
+	Primary   bool      `bun:"is_primary,type:boolean,notnull"`
+}
+
+func (e *ProfileEmail) IsVerified() bool {
+	return !e.Verified.IsZero()
+}
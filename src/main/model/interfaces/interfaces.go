@@ -1,6 +1,10 @@
 package interfaces
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Identifiable interface {
 	GetId() uuid.UUID
@@ -11,3 +15,20 @@ type Nameable interface {
 	GetName() string
 	GetDescription() string
 }
+
+type Timestamped interface {
+	Identifiable
+	GetCreated() time.Time
+}
+
+type Versioned interface {
+	Identifiable
+	GetVersion() int64
+	SetVersion(version int64)
+}
+
+// Owned entity of a profile, guarded by the authorization policy
+type Owned interface {
+	GetOwnerId() uuid.UUID
+	IsPrivate() bool
+}
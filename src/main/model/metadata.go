@@ -0,0 +1,18 @@
+package model
+
+import (
+	"cabinet/src/main/model/common"
+	"encoding/json"
+
+	"github.com/uptrace/bun"
+)
+
+// MetadataSchema JSON Schema of a metadata namespace, see metadata.Schema. Profile and Attachment
+// metadata under the namespace must match it.
+type MetadataSchema struct {
+	bun.BaseModel `bun:"table:users.metadata_schemas,alias:metadata_schema"`
+	common.Modifiable
+	Namespace   string          `bun:"type:varchar(50),notnull,unique" validate:"required"` // top-level metadata key
+	Description string          `bun:"type:text,notnull,default:''"`
+	Document    json.RawMessage `bun:"type:jsonb,notnull" validate:"required"`
+}
@@ -1,7 +1,9 @@
 package model
 
 import (
+	"cabinet/src/main/metadata"
 	"cabinet/src/main/model/common"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/uptrace/bun"
@@ -11,36 +13,49 @@ import (
 type Profile struct {
 	bun.BaseModel `bun:"table:users.profiles"`
 	common.Modifiable
-	Login        string         `bun:"type:varchar(50),notnull,unique"` // Login info
-	FistName     string         `bun:"type:varchar(100),notnull,default:''"`
-	MiddleName   string         `bun:"type:varchar(100),notnull,default:''"`
-	LastName     string         `bun:"type:varchar(100),notnull,default:''"`
-	Private      bool           `bun:"type:boolean,default:true"`
-	PrimaryEmail string         `bun:"type:varchar(50),notnull,unique"`                     // Primary email, verified
-	Email        []string       `bun:"type:varchar(50)[],array,default:array[]::varchar[]"` // Additional emails
-	Phone        string         `bun:"type:varchar(50)"`
-	Tags         []string       `bun:"type:varchar(50)[],array,default:array[]::varchar[]"`
-	Biography    string         `bun:"type:text"`
-	Company      string         `bun:"type:varchar(100)"`
-	Location     string         `bun:"type:varchar(255)"`
-	ExternalID   uuid.UUID      `bun:"type:uuid"`  // Keycloak id
-	Avatar       uuid.UUID      `bun:"type:uuid"`  // S3 resource key
-	Metadata     map[string]any `bun:"type:jsonb"` // Custom metadata
-	Attachments  []*Attachment  `bun:"rel:has-many,join:id=user_id"`
+	common.SoftDeletable
+	Login         string               `bun:"type:varchar(50),notnull,unique" validate:"required"` // Login info
+	FistName      string               `bun:"type:varchar(100),notnull,default:''"`
+	MiddleName    string               `bun:"type:varchar(100),notnull,default:''"`
+	LastName      string               `bun:"type:varchar(100),notnull,default:''"`
+	Private       bool                 `bun:"type:boolean"`                                         // table default is true, bun must store an explicit false
+	PrimaryEmail  string               `bun:"type:varchar(50),nullzero,unique" validate:"email"`    // Primary email, verified
+	EmailVerified time.Time            `bun:"type:timestamp,nullzero"`                              // when PrimaryEmail was confirmed, zero while unverified
+	Phone         string               `bun:"type:varchar(50)"`                                     // as typed, shown only
+	PhoneE164     string               `bun:"phone_e164,type:varchar(16),nullzero" validate:"e164"` // Phone normalized, searched and verified
+	PhoneVerified time.Time            `bun:"type:timestamp,nullzero"`                              // when PhoneE164 was confirmed by SMS, zero while unverified
+	Tags          []string             `bun:"type:varchar(50)[],array,default:array[]::varchar[]"`
+	Biography     string               `bun:"type:text"`
+	Company       string               `bun:"type:varchar(100)"`
+	Location      string               `bun:"type:varchar(255)"`
+	ExternalID    uuid.UUID            `bun:"type:uuid"`                       // Keycloak id
+	Avatar        uuid.UUID            `bun:"type:uuid"`                       // S3 resource key
+	Metadata      metadata.Values      `bun:"type:jsonb"`                      // Custom metadata, namespaces validated by their schema
+	IdentitySync  map[string]ClaimSync `bun:"type:jsonb"`                      // identity provider claims last synced into the fields
+	Emails        []*ProfileEmail      `bun:"rel:has-many,join:id=profile_id"` // every address, the primary one included
+	Attachments   []*Attachment        `bun:"rel:has-many,join:id=user_id"`
+}
+
+// ClaimSync identity claim last seen for a profile field and the value it set.
+// A field that no longer holds Value was edited locally and is not synced anymore.
+type ClaimSync struct {
+	Claim string `json:"claim"`
+	Value string `json:"value"`
 }
 
 // Attachment Profile custom material
 type Attachment struct {
 	bun.BaseModel `bun:"table:users.attachments"`
 	common.NotModifiable
+	common.SoftDeletable
 	common.Nameable
-	Private  bool           `bun:"type:boolean,default:true"`
-	Tags     []string       `bun:"type:varchar(50)[],array,default:array[]::varchar[]"`
-	Title    string         `bun:"type:varchar(255),notnull"`
-	S3Key    uuid.UUID      `bun:"type:uuid,notnull"`
-	UserID   uuid.UUID      `bun:"type:uuid,notnull"`
-	Metadata map[string]any `bun:"type:jsonb"` // Custom metadata
-	Profile  Profile        `bun:"rel:belongs-to,join:user_id=id"`
+	Private  bool            `bun:"type:boolean"` // table default is true, bun must store an explicit false
+	Tags     []string        `bun:"type:varchar(50)[],array,default:array[]::varchar[]"`
+	Title    string          `bun:"type:varchar(255),notnull" validate:"required"`
+	S3Key    uuid.UUID       `bun:"type:uuid,notnull"`
+	UserID   uuid.UUID       `bun:"type:uuid,notnull"`
+	Metadata metadata.Values `bun:"type:jsonb"` // Custom metadata, namespaces validated by their schema
+	Profile  Profile         `bun:"rel:belongs-to,join:user_id=id"`
 }
 
 func (p *Profile) FullName() string {
@@ -54,3 +69,27 @@ func (p *Profile) GetName() string {
 func (p *Profile) GetDescription() string {
 	return ""
 }
+
+// GetOwnerId a profile owns itself
+func (p *Profile) GetOwnerId() uuid.UUID {
+	return p.ID
+}
+
+func (p *Profile) IsPrivate() bool {
+	return p.Private
+}
+
+func (a *Attachment) GetOwnerId() uuid.UUID {
+	return a.UserID
+}
+
+func (a *Attachment) IsPrivate() bool {
+	return a.Private
+}
+
+// ProfileMatch profile found by full-text search
+type ProfileMatch struct {
+	Profile `bun:",extend"`
+	Rank    float64 `bun:"rank,scanonly"`
+	Snippet string  `bun:"snippet,scanonly"` // matched words wrapped in <b></b>
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"cabinet/src/main/model/common"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// EmailVerification address of a profile waiting for its confirmation, only the hash of the mailed token is stored.
+// A primary verification makes the address the PrimaryEmail once confirmed.
+type EmailVerification struct {
+	bun.BaseModel `bun:"table:users.email_verifications,alias:verification"`
+	common.NotModifiable
+	ProfileID uuid.UUID `bun:"type:uuid,notnull"`
+	Email     string    `bun:"type:varchar(50),notnull" validate:"required,email"`
+	TokenHash string    `bun:"type:varchar(64),notnull,unique" audit:"-"` // hex HMAC-SHA256 of the token
+	Expires   time.Time `bun:"type:timestamp,notnull"`
+	Consumed  time.Time `bun:"type:timestamp,nullzero"` // confirmed, or replaced by a newer verification
+	Primary   bool      `bun:"is_primary,type:boolean,notnull"`
+}
+
+// IsPending reports whether the token may still be confirmed at the time
+func (v *EmailVerification) IsPending(at time.Time) bool {
+	return v.Consumed.IsZero() && at.Before(v.Expires)
+}
+
+// PhoneVerification code texted to the phone of a profile, only its hash is stored.
+// Every code tried counts as an attempt, the code stops working after too many.
+type PhoneVerification struct {
+	bun.BaseModel `bun:"table:users.phone_verifications,alias:phone_verification"`
+	common.NotModifiable
+	ProfileID uuid.UUID `bun:"type:uuid,notnull"`
+	Phone     string    `bun:"type:varchar(16),notnull" validate:"required,e164"`
+	CodeHash  string    `bun:"type:varchar(64),notnull" audit:"-"` // hex HMAC-SHA256 of the profile, number and code
+	Expires   time.Time `bun:"type:timestamp,notnull"`
+	Attempts  int       `bun:"type:integer,notnull"`
+	Consumed  time.Time `bun:"type:timestamp,nullzero"` // confirmed or replaced
+}
+
+// IsPending reports whether the code may still be confirmed at the time
+func (v *PhoneVerification) IsPending(at time.Time) bool {
+	return v.Consumed.IsZero() && at.Before(v.Expires)
+}
@@ -0,0 +1,51 @@
+package phone
+
+import (
+	"context"
+	"sync"
+)
+
+var _ Sender = (*MemorySender)(nil)
+
+// MemorySender keeps sent messages in process memory for tests
+type MemorySender struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (m *MemorySender) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, message)
+
+	return nil
+}
+
+// Sent messages in sending order
+func (m *MemorySender) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.sent...)
+}
+
+// Last most recent message, false when nothing was sent
+func (m *MemorySender) Last() (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.sent) == 0 {
+		return Message{}, false
+	}
+
+	return m.sent[len(m.sent)-1], true
+}
@@ -0,0 +1,83 @@
+package phone
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+// Environment variables read by ConfigFromEnv
+const (
+	RegionEnv  = "CABINET_PHONE_REGION"
+	BackendEnv = "CABINET_SMS"
+)
+
+// Backends selected by CABINET_SMS
+const (
+	BackendNone   = "none"
+	BackendLog    = "log"
+	BackendMemory = "memory"
+)
+
+var ErrInvalid = errors.New("not a valid phone number")
+
+// Config number parsing and SMS sender selection
+type Config struct {
+	Region  string // ISO 3166 region of numbers typed without a country code
+	Backend string // none, log or memory, none disables SMS verification
+}
+
+func DefaultConfig() Config {
+	return Config{Region: "US", Backend: BackendNone}
+}
+
+// ConfigFromEnv DefaultConfig overridden by CABINET_PHONE_REGION and CABINET_SMS
+func ConfigFromEnv() Config {
+	var cfg = DefaultConfig()
+
+	for env, dest := range map[string]*string{
+		RegionEnv:  &cfg.Region,
+		BackendEnv: &cfg.Backend,
+	} {
+		if value, ok := os.LookupEnv(env); ok {
+			*dest = value
+		}
+	}
+
+	return cfg
+}
+
+// Parser normalizes typed numbers to E.164, numbers without a country code belong to its region
+type Parser struct {
+	region string
+}
+
+func NewParser(region string) (*Parser, error) {
+	region = strings.ToUpper(strings.TrimSpace(region))
+
+	if !phonenumbers.GetSupportedRegions()[region] {
+		return nil, fmt.Errorf("%s: unknown region %q", RegionEnv, region)
+	}
+
+	return &Parser{region: region}, nil
+}
+
+// Region default region of the parser
+func (p *Parser) Region() string {
+	return p.region
+}
+
+// Normalize E.164 form of the typed number, e.g. +12025550143 for (202) 555-0143 in the US.
+// Numbers that cannot be dialed fail with ErrInvalid.
+func (p *Parser) Normalize(input string) (string, error) {
+	number, err := phonenumbers.Parse(input, p.region)
+
+	if err != nil || !phonenumbers.IsValidNumber(number) {
+		return "", fmt.Errorf("%w: %q", ErrInvalid, input)
+	}
+
+	return phonenumbers.Format(number, phonenumbers.E164), nil
+}
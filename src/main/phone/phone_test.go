@@ -0,0 +1,92 @@
+package phone
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	parser, err := NewParser("us")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "US", parser.Region())
+
+	for input, expected := range map[string]string{
+		"(202) 555-0143":    "+12025550143",
+		"202.555.0143":      "+12025550143",
+		"+1 202 555 0143":   "+12025550143",
+		"+44 20 7946 0958":  "+442079460958",
+		"+49 (030) 1234567": "+49301234567",
+	} {
+		normalized, err := parser.Normalize(input)
+
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, normalized, input)
+	}
+
+	for _, input := range []string{"", "call me", "555-0143", "+1 202 555 01434444"} {
+		_, err = parser.Normalize(input)
+
+		assert.True(t, errors.Is(err, ErrInvalid), input)
+	}
+
+	// the default region only applies to numbers without a country code
+	parser, _ = NewParser("GB")
+
+	normalized, err := parser.Normalize("020 7946 0958")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "+442079460958", normalized)
+
+	_, err = NewParser("XX")
+
+	assert.ErrorContains(t, err, RegionEnv)
+
+	slog.Info("TestNormalize success")
+}
+
+func TestNewSender(t *testing.T) {
+	t.Setenv(RegionEnv, "DE")
+	t.Setenv(BackendEnv, BackendMemory)
+
+	var cfg = ConfigFromEnv()
+
+	assert.Equal(t, Config{Region: "DE", Backend: BackendMemory}, cfg)
+
+	sender, err := NewSender(cfg)
+
+	assert.NoError(t, err)
+
+	var memory = sender.(*MemorySender)
+
+	_, sent := memory.Last()
+	assert.False(t, sent)
+
+	assert.NoError(t, memory.Send(context.Background(), Message{To: "+49301234567", Body: "123456"}))
+
+	last, sent := memory.Last()
+
+	assert.True(t, sent)
+	assert.Equal(t, "123456", last.Body)
+	assert.Len(t, memory.Sent(), 1)
+
+	sender, err = NewSender(DefaultConfig())
+
+	assert.NoError(t, err)
+	assert.Nil(t, sender)
+
+	_, err = NewSender(Config{Backend: "carrier-pigeon"})
+
+	assert.ErrorContains(t, err, BackendEnv)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, LogSender{}.Send(cancelled, Message{}), context.Canceled)
+
+	slog.Info("TestNewSender success")
+}
@@ -0,0 +1,47 @@
+package phone
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Message text message to an E.164 number
+type Message struct {
+	To   string
+	Body string
+}
+
+// Sender delivers text messages, Send returns once the message is accepted for delivery
+type Sender interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// NewSender opens the sender selected by cfg, nil for BackendNone
+func NewSender(cfg Config) (Sender, error) {
+	switch cfg.Backend {
+	case BackendNone, "":
+		return nil, nil
+	case BackendLog:
+		return LogSender{}, nil
+	case BackendMemory:
+		return NewMemorySender(), nil
+	default:
+		return nil, fmt.Errorf("%s: unknown sms backend %q, expected none, log or memory", BackendEnv, cfg.Backend)
+	}
+}
+
+var _ Sender = LogSender{}
+
+// LogSender writes messages to the log instead of sending them, for development
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	slog.Info("SMS", slog.String("to", message.To), slog.String("body", message.Body))
+
+	return nil
+}
@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"cabinet/src/main/datasource"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/validation"
+	viewCommon "cabinet/src/main/view/common"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// AttachmentColumns attachment columns open to filtering and sorting, storage keys and owners stay internal
+var AttachmentColumns = common.NewWhitelist((*model.Attachment)(nil),
+	"name", "title", "tags", "private", "created", "metadata")
+
+// IAttachmentRepository attachment storage used by services and controllers
+type IAttachmentRepository interface {
+	common.ISoftDeleteRepository[model.Attachment]
+	Filter(spec *common.Spec) (common.Filter, error)
+	FindByS3Key(ctx context.Context, s3Key uuid.UUID, opts ...AttachmentOption) (*model.Attachment, error)
+	ListByUserID(ctx context.Context, userID uuid.UUID, includePrivate bool, opts ...AttachmentOption) ([]*model.Attachment, error)
+}
+
+var _ IAttachmentRepository = (*AttachmentRepo)(nil)
+
+// AttachmentOption customizes attachment select queries
+type AttachmentOption func(query *bun.SelectQuery) *bun.SelectQuery
+
+// WithProfile eager loads the owner Profile of the attachment
+func WithProfile() AttachmentOption {
+	return func(query *bun.SelectQuery) *bun.SelectQuery {
+		return query.Relation("Profile")
+	}
+}
+
+type AttachmentRepo struct {
+	datasource *datasource.Datasource
+}
+
+func NewAttachmentRepo(datasource *datasource.Datasource) *AttachmentRepo {
+	return &AttachmentRepo{datasource: datasource}
+}
+
+func (a *AttachmentRepo) FindById(ctx context.Context, uuid uuid.UUID) (*model.Attachment, error) {
+	return a.findOne(ctx, "?TableAlias.id = ?", []any{uuid})
+}
+
+// Filter translates the spec over AttachmentColumns, wraps common.ErrInvalidSpec
+func (a *AttachmentRepo) Filter(spec *common.Spec) (common.Filter, error) {
+	return AttachmentColumns.Filter(spec)
+}
+
+func (a *AttachmentRepo) FindByS3Key(ctx context.Context, s3Key uuid.UUID, opts ...AttachmentOption) (*model.Attachment, error) {
+	return a.findOne(ctx, "?TableAlias.s3_key = ?", []any{s3Key}, opts...)
+}
+
+// FindPage attachments matching the filter ordered by creation time, see Filter
+func (a *AttachmentRepo) FindPage(ctx context.Context, filter common.Filter, page uint, pageSize uint) (*viewCommon.Paged[*model.Attachment], error) {
+	ctx, err := resolve(a.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	paged, err := findPage[model.Attachment](ctx, a.datasource.IDB(ctx), filter, page, pageSize)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return paged, nil
+}
+
+// FindKeyset attachments matching the filter around the cursor, nil cursor is the first page, see Filter
+func (a *AttachmentRepo) FindKeyset(ctx context.Context, filter common.Filter, cursor *viewCommon.Cursor, limit uint) (*common.KeysetPage[*model.Attachment], error) {
+	ctx, err := resolve(a.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := findKeyset[model.Attachment](ctx, a.datasource.IDB(ctx), filter, cursor, limit)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return page, nil
+}
+
+// ListByUserID lists attachments of the profile, private ones only if includePrivate is set
+func (a *AttachmentRepo) ListByUserID(ctx context.Context, userID uuid.UUID, includePrivate bool, opts ...AttachmentOption) ([]*model.Attachment, error) {
+	ctx, err := resolve(a.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var attachments = make([]*model.Attachment, 0)
+
+	query := a.datasource.IDB(ctx).NewSelect().Model(&attachments).Where("?TableAlias.user_id = ?", userID)
+
+	if !includePrivate {
+		query = query.Where("?TableAlias.private = FALSE")
+	}
+
+	for _, opt := range opts {
+		query = opt(query)
+	}
+
+	err = query.OrderExpr("?TableAlias.created ASC").Scan(ctx)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return attachments, nil
+}
+
+// Create inserts the attachment, wraps validation.ErrInvalid when it or its metadata breaks its rules
+func (a *AttachmentRepo) Create(ctx context.Context, attachment *model.Attachment) error {
+	ctx, err := resolve(a.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err = a.validate(ctx, attachment); err != nil {
+		return err
+	}
+
+	_, err = a.datasource.IDB(ctx).NewInsert().Model(attachment).Exec(ctx)
+
+	return common.TranslateError(ctx, err, nil)
+}
+
+// Update stores the attachment, wraps validation.ErrInvalid when it or its metadata breaks its rules
+func (a *AttachmentRepo) Update(ctx context.Context, attachment *model.Attachment) error {
+	ctx, err := resolve(a.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err = a.validate(ctx, attachment); err != nil {
+		return err
+	}
+
+	res, err := a.datasource.IDB(ctx).NewUpdate().Model(attachment).ExcludeColumn("created", "deleted_at").WherePK().Exec(ctx)
+
+	if err != nil {
+		return common.TranslateError(ctx, err, nil)
+	}
+
+	return checkAffected(res)
+}
+
+// Delete soft deletes the attachment
+func (a *AttachmentRepo) Delete(ctx context.Context, uuid uuid.UUID) error {
+	ctx, err := resolve(a.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	var attachment = &model.Attachment{}
+	attachment.ID = uuid
+
+	res, err := a.datasource.IDB(ctx).NewDelete().Model(attachment).WherePK().Exec(ctx)
+
+	if err != nil {
+		return common.TranslateError(ctx, err, nil)
+	}
+
+	return checkAffected(res)
+}
+
+// FindDeleted soft deleted attachments matching the filter
+func (a *AttachmentRepo) FindDeleted(ctx context.Context, filter common.Filter, page uint, pageSize uint) (*viewCommon.Paged[*model.Attachment], error) {
+	return a.FindPage(ctx, deleted(filter), page, pageSize)
+}
+
+// Restore undeletes the attachment, attachments of deleted profiles are restored with the profile
+func (a *AttachmentRepo) Restore(ctx context.Context, uuid uuid.UUID) error {
+	ctx, err := resolve(a.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	idb := a.datasource.IDB(ctx)
+	profiles := idb.NewSelect().Model((*model.Profile)(nil)).Column("id")
+
+	var attachment = &model.Attachment{}
+	attachment.ID = uuid
+
+	res, err := idb.NewUpdate().Model(attachment).
+		Column("deleted_at").
+		WherePK().
+		Where("user_id IN (?)", profiles). // ?TableAlias would resolve to the subquery alias
+		WhereDeleted().
+		Exec(ctx)
+
+	if err != nil {
+		return common.TranslateError(ctx, err, nil)
+	}
+
+	return checkAffected(res)
+}
+
+// Purge hard deletes attachments deleted before the time and returns the S3Keys of their objects
+func (a *AttachmentRepo) Purge(ctx context.Context, before time.Time) (*common.Purged, error) {
+	ctx, err := resolve(a.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []uuid.UUID
+
+	err = a.datasource.IDB(ctx).NewDelete().Model((*model.Attachment)(nil)).
+		Where("?TableAlias.deleted_at < ?", before).
+		ForceDelete().
+		Returning("s3_key").
+		Scan(ctx, &keys)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return &common.Purged{Count: int64(len(keys)), Blobs: keys}, nil
+}
+
+func (a *AttachmentRepo) findOne(ctx context.Context, query string, args []any, opts ...AttachmentOption) (*model.Attachment, error) {
+	ctx, err := resolve(a.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var attachment = model.Attachment{}
+
+	selectQuery := a.datasource.IDB(ctx).NewSelect().Model(&attachment).Where(query, args...)
+
+	for _, opt := range opts {
+		selectQuery = opt(selectQuery)
+	}
+
+	err = selectQuery.Limit(1).Scan(ctx)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return &attachment, nil
+}
+
+// validate checks the rules of the attachment, then its metadata against the registered schemas
+func (a *AttachmentRepo) validate(ctx context.Context, attachment *model.Attachment) error {
+	if err := validation.Validate(attachment); err != nil {
+		return err
+	}
+	return checkMetadata(ctx, a.datasource.IDB(ctx), attachment.Metadata)
+}
@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+)
+
+func TestFindAttachmentByS3Key(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var attachmentId = uuid.New()
+	var s3Key = uuid.New()
+
+	mock.ExpectQuery(`FROM "users"."attachments" AS "attachment" WHERE \("attachment".s3_key = '` + s3Key.String() + `'\) AND "attachment"."deleted_at" IS NULL LIMIT 1`).
+		WillReturnRows(mock.NewRows([]string{"id", "s3_key", "user_id"}).AddRow(attachmentId, s3Key, profileTestId1))
+	mock.ExpectQuery(`"profile"."login" AS "profile__login".* LEFT JOIN "users"."profiles" AS "profile" ON \("profile"."id" = "attachment"."user_id"\)`).
+		WillReturnRows(mock.NewRows([]string{"id", "s3_key", "user_id", "profile__id", "profile__login"}).
+			AddRow(attachmentId, s3Key, profileTestId1, profileTestId1, "login1"))
+	mock.ExpectQuery(`FROM "users"."attachments"`).
+		WillReturnRows(mock.NewRows([]string{"id"}))
+
+	var attachmentRepo = NewAttachmentRepo(ds)
+
+	attachment, err := attachmentRepo.FindByS3Key(context.Background(), s3Key)
+
+	assert.NoError(t, err)
+	assert.Equal(t, attachmentId, attachment.ID)
+	assert.Equal(t, profileTestId1, attachment.UserID)
+	assert.Empty(t, attachment.Profile.ID)
+
+	attachment, err = attachmentRepo.FindByS3Key(context.Background(), s3Key, WithProfile())
+
+	assert.NoError(t, err)
+	assert.Equal(t, profileTestId1, attachment.Profile.ID)
+	assert.Equal(t, "login1", attachment.Profile.Login)
+
+	attachment, err = attachmentRepo.FindByS3Key(context.Background(), uuid.New())
+
+	assert.Nil(t, attachment)
+	assert.True(t, errors.Is(err, common.ErrNotFound))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestFindAttachmentByS3Key is successful")
+}
+
+func TestListAttachmentsByUserID(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	mock.ExpectQuery(`WHERE \("attachment".user_id = '` + profileTestId1.String() + `'\) AND \("attachment".private = FALSE\) AND "attachment"."deleted_at" IS NULL ORDER BY`).
+		WillReturnRows(mock.NewRows([]string{"id", "private"}).AddRow(uuid.New(), false))
+	mock.ExpectQuery(`WHERE \("attachment".user_id = '` + profileTestId1.String() + `'\) AND "attachment"."deleted_at" IS NULL ORDER BY`).
+		WillReturnRows(mock.NewRows([]string{"id", "private"}).AddRow(uuid.New(), false).AddRow(uuid.New(), true))
+	mock.ExpectQuery(`WHERE \("attachment".user_id = '` + profileTestId2.String() + `'\) AND`).
+		WillReturnRows(mock.NewRows([]string{"id"}))
+
+	var attachmentRepo = NewAttachmentRepo(ds)
+
+	attachments, err := attachmentRepo.ListByUserID(context.Background(), profileTestId1, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(attachments))
+
+	attachments, err = attachmentRepo.ListByUserID(context.Background(), profileTestId1, true)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(attachments))
+	assert.True(t, attachments[1].Private)
+
+	attachments, err = attachmentRepo.ListByUserID(context.Background(), profileTestId2, false)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, attachments)
+	assert.Empty(t, attachments)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestListAttachmentsByUserID is successful")
+}
+
+func TestOperateAttachment(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var attachment = &model.Attachment{Title: "Title", S3Key: uuid.New(), UserID: profileTestId1}
+	attachment.Name = "Name"
+
+	mock.ExpectQuery(`INSERT INTO "users"."attachments"`).
+		WillReturnError(&pq.Error{Code: "23503", Constraint: "attachments_user_id_fkey"})
+	mock.ExpectQuery(`INSERT INTO "users"."attachments"`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId2))
+	mock.ExpectExec(`UPDATE "users"."attachments" AS "attachment" SET "name" = 'Name'`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "users"."attachments" AS "attachment" SET "deleted_at" = '.*' WHERE "attachment"."deleted_at" IS NULL AND \("attachment"."id" = '` + profileTestId2.String() + `'\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "users"."attachments"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var attachmentRepo = NewAttachmentRepo(ds)
+
+	assert.True(t, errors.Is(attachmentRepo.Create(context.Background(), attachment), common.ErrForeignKeyViolation))
+
+	assert.NoError(t, attachmentRepo.Create(context.Background(), attachment))
+	assert.Equal(t, profileTestId2, attachment.ID)
+
+	assert.NoError(t, attachmentRepo.Update(context.Background(), attachment))
+	assert.NoError(t, attachmentRepo.Delete(context.Background(), attachment.ID))
+	assert.True(t, errors.Is(attachmentRepo.Delete(context.Background(), attachment.ID), common.ErrNotFound))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestOperateAttachment is successful")
+}
+
+func TestProfileAndAttachmentInTx(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var profile = &model.Profile{Login: "login1", PrimaryEmail: "john@smith.com"}
+	profile.ID = profileTestId1
+
+	var attachment = &model.Attachment{Title: "Title", S3Key: uuid.New(), UserID: profileTestId1}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users"."profiles"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectPrimaryEmailSync(mock, "john@smith.com", false)
+	mock.ExpectQuery(`INSERT INTO "users"."attachments"`).
+		WillReturnError(&pq.Error{Code: "23503", Constraint: "attachments_user_id_fkey"})
+	mock.ExpectRollback()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users"."profiles"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectPrimaryEmailSync(mock, "john@smith.com", false)
+	mock.ExpectQuery(`INSERT INTO "users"."attachments"`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+
+	var profileRepo = NewProfileRepo(ds)
+	var attachmentRepo = NewAttachmentRepo(ds)
+
+	var update = func(ctx context.Context, _ bun.Tx) error {
+		if err := profileRepo.Update(ctx, profile); err != nil {
+			return err
+		}
+		return attachmentRepo.Create(ctx, attachment)
+	}
+
+	err := ds.RunInTx(context.Background(), nil, update)
+
+	assert.True(t, errors.Is(err, common.ErrForeignKeyViolation))
+
+	err = ds.RunInTx(context.Background(), nil, update)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestProfileAndAttachmentInTx is successful")
+}
+
+func TestFindAttachmentPage(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+	mock.MatchExpectationsInOrder(false)
+
+	mock.ExpectQuery(`FROM "users"."attachments" AS "attachment" WHERE "attachment"."deleted_at" IS NULL ORDER BY "attachment".created ASC, "attachment".id ASC LIMIT 10`).
+		WillReturnRows(mock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users"."attachments"`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+
+	paged, err := NewAttachmentRepo(ds).FindPage(context.Background(), nil, 0, 10)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, paged.Entities)
+	assert.Empty(t, paged.Entities)
+	assert.Equal(t, uint64(0), paged.Pageable.Total)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestFindAttachmentPage is successful")
+}
+
+func TestFindAttachmentsBySpec(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+	mock.MatchExpectationsInOrder(false)
+
+	var where = `WHERE \("attachment"."title" = 'Report'\) AND \("attachment"."metadata" #>> '\{"review","state"\}' = 'done'\)` +
+		` AND \("attachment"."metadata" @> '\{"source":"scan"\}'::jsonb\) AND "attachment"."deleted_at" IS NULL`
+
+	mock.ExpectQuery(`FROM "users"."attachments" AS "attachment" ` + where +
+		` ORDER BY "attachment"."title" ASC, "attachment".created ASC, "attachment".id ASC LIMIT 10`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users"."attachments" AS "attachment" ` + where).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+
+	values, _ := url.ParseQuery(`filter=title:eq:Report&filter=metadata.review.state:eq:done&filter=metadata:contains:{"source":"scan"}&sort=title`)
+
+	spec, err := common.ParseSpec(values)
+
+	assert.NoError(t, err)
+
+	var repo = NewAttachmentRepo(ds)
+	filter, err := repo.Filter(spec)
+
+	assert.NoError(t, err)
+
+	paged, err := repo.FindPage(context.Background(), filter, 0, 10)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(paged.Entities))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// storage keys and owners are not open to filtering
+	for _, invalid := range []common.Spec{
+		{Conditions: []common.Condition{{Field: "s3_key", Op: common.OpEq, Value: uuid.NewString()}}},
+		{Conditions: []common.Condition{{Field: "user_id", Op: common.OpEq, Value: uuid.NewString()}}},
+		{Orders: []common.Order{{Field: "metadata"}}},
+	} {
+		_, err = repo.Filter(&invalid)
+		assert.ErrorIs(t, err, common.ErrInvalidSpec)
+	}
+
+	slog.Info("TestFindAttachmentsBySpec is successful")
+}
+
+func TestRestoreAndPurgeAttachments(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+	mock.MatchExpectationsInOrder(false)
+
+	var attachmentId = uuid.New()
+	var before = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var s3Keys = []uuid.UUID{uuid.New(), uuid.New()}
+
+	mock.ExpectExec(`UPDATE "users"."attachments" AS "attachment" SET "deleted_at" = NULL` +
+		` WHERE \(user_id IN \(SELECT "profile"."id" FROM "users"."profiles" AS "profile" WHERE "profile"."deleted_at" IS NULL\)\)` +
+		` AND "attachment"."deleted_at" IS NOT NULL AND \("attachment"."id" = '` + attachmentId.String() + `'\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`DELETE FROM "users"."attachments" AS "attachment" WHERE \("attachment".deleted_at < '2025-01-01 00:00:00\+00:00'\) RETURNING s3_key$`).
+		WillReturnRows(mock.NewRows([]string{"s3_key"}).AddRow(s3Keys[0]).AddRow(s3Keys[1]))
+	mock.ExpectQuery(`FROM "users"."attachments" AS "attachment" WHERE \(title = 'Title'\) AND "attachment"."deleted_at" IS NOT NULL ORDER BY`).
+		WillReturnRows(mock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users"."attachments" AS "attachment" WHERE \(title = 'Title'\) AND "attachment"."deleted_at" IS NOT NULL`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+
+	var attachmentRepo = NewAttachmentRepo(ds)
+
+	assert.NoError(t, attachmentRepo.Restore(context.Background(), attachmentId))
+
+	purged, err := attachmentRepo.Purge(context.Background(), before)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &common.Purged{Count: 2, Blobs: s3Keys}, purged)
+
+	var filter = func(query *bun.SelectQuery) *bun.SelectQuery {
+		return query.Where("title = ?", "Title")
+	}
+
+	paged, err := attachmentRepo.FindDeleted(context.Background(), filter, 0, 10)
+
+	assert.NoError(t, err)
+	assert.Empty(t, paged.Entities)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestRestoreAndPurgeAttachments is successful")
+}
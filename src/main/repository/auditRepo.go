@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"cabinet/src/main/datasource"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	viewCommon "cabinet/src/main/view/common"
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// AuditRepo append-only storage of model.AuditEntry
+type AuditRepo struct {
+	datasource *datasource.Datasource
+}
+
+func NewAuditRepo(datasource *datasource.Datasource) *AuditRepo {
+	return &AuditRepo{datasource: datasource}
+}
+
+// Append stores the entry, joining the transaction of ctx
+func (a *AuditRepo) Append(ctx context.Context, entry *model.AuditEntry) error {
+	ctx, err := resolve(a.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = a.datasource.IDB(ctx).NewInsert().Model(entry).Exec(ctx)
+
+	return common.TranslateError(ctx, err, nil)
+}
+
+// Latest most recent entry of the entity, common.ErrNotFound when the entity has no history
+func (a *AuditRepo) Latest(ctx context.Context, entityType string, entityID uuid.UUID) (*model.AuditEntry, error) {
+	ctx, err := resolve(a.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entry = &model.AuditEntry{}
+
+	err = a.datasource.IDB(ctx).NewSelect().
+		Model(entry).
+		Where("?TableAlias.entity_type = ?", entityType).
+		Where("?TableAlias.entity_id = ?", entityID).
+		OrderExpr("?TableAlias.id DESC").
+		Limit(1).
+		Scan(ctx)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return entry, nil
+}
+
+// History entries of the entity, oldest first
+func (a *AuditRepo) History(ctx context.Context, entityType string, entityID uuid.UUID, page uint, pageSize uint) (*viewCommon.Paged[*model.AuditEntry], error) {
+	ctx, err := resolve(a.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var filter = func(query *bun.SelectQuery) *bun.SelectQuery {
+		return query.
+			Where("?TableAlias.entity_type = ?", entityType).
+			Where("?TableAlias.entity_id = ?", entityID)
+	}
+
+	paged, err := findPage[model.AuditEntry](ctx, a.datasource.IDB(ctx), filter, page, pageSize)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return paged, nil
+}
@@ -1,9 +1,56 @@
 package common
 
 import (
+	viewCommon "cabinet/src/main/view/common"
+	"context"
+	"time"
+
 	"github.com/google/uuid"
+	"github.com/uptrace/bun"
 )
 
+// Filter narrows a select query, nil selects everything
+type Filter func(query *bun.SelectQuery) *bun.SelectQuery
+
+// And applies every non nil filter
+func And(filters ...Filter) Filter {
+	return func(query *bun.SelectQuery) *bun.SelectQuery {
+		for _, filter := range filters {
+			if filter != nil {
+				query = filter(query)
+			}
+		}
+		return query
+	}
+}
+
 type IRepository[T any] interface {
-	FindById(uuid uuid.UUID) (*T, error)
+	FindById(ctx context.Context, uuid uuid.UUID) (*T, error)
+	FindPage(ctx context.Context, filter Filter, page uint, pageSize uint) (*viewCommon.Paged[*T], error)
+	FindKeyset(ctx context.Context, filter Filter, cursor *viewCommon.Cursor, limit uint) (*KeysetPage[*T], error)
+	Create(ctx context.Context, entity *T) error
+	Update(ctx context.Context, entity *T) error
+	Delete(ctx context.Context, uuid uuid.UUID) error
+}
+
+// ISoftDeleteRepository repository of common.SoftDeletable entities, Delete only marks rows deleted
+type ISoftDeleteRepository[T any] interface {
+	IRepository[T]
+	FindDeleted(ctx context.Context, filter Filter, page uint, pageSize uint) (*viewCommon.Paged[*T], error)
+	Restore(ctx context.Context, uuid uuid.UUID) error
+	Purge(ctx context.Context, before time.Time) (*Purged, error)
+}
+
+// Purged rows hard deleted by a purge, the blobs they referenced are left to the caller to delete
+type Purged struct {
+	Count   int64
+	Blobs   []uuid.UUID // storage keys of the purged rows
+	Avatars []uuid.UUID // avatars of purged profiles, their renditions are stored under keys derived from them
+}
+
+// KeysetPage page fetched by (created, id) position, nil cursors mark the listing ends
+type KeysetPage[T any] struct {
+	Entities []T
+	Next     *viewCommon.Cursor
+	Prev     *viewCommon.Cursor
 }
@@ -0,0 +1,77 @@
+package common
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+)
+
+var ErrNilDatasource = errors.New("datasource is nil")
+var ErrNotFound = errors.New("entity not found")
+var ErrUniqueViolation = errors.New("unique constraint violation")
+var ErrForeignKeyViolation = errors.New("foreign key constraint violation")
+var ErrConcurrentModification = errors.New("entity was modified concurrently")
+
+// UniqueViolationError reports which unique field of the entity is already taken
+type UniqueViolationError struct {
+	Field      string // model field name, e.g. Login
+	Constraint string // database constraint name
+	Err        error  // original driver error
+}
+
+func (e *UniqueViolationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("unique constraint %q violated", e.Constraint)
+	}
+	return fmt.Sprintf("%s already exists", e.Field)
+}
+
+func (e *UniqueViolationError) Is(target error) bool {
+	return target == ErrUniqueViolation
+}
+
+func (e *UniqueViolationError) Unwrap() error {
+	return e.Err
+}
+
+// TranslateError maps driver errors to repository errors.
+// uniqueFields maps database constraint names to model field names.
+// Errors of cancelled calls also match the context error.
+func TranslateError(ctx context.Context, err error, uniqueFields map[string]string) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctx != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+		return fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pqErr *pq.Error
+
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case pqUniqueViolation:
+			return &UniqueViolationError{
+				Field:      uniqueFields[pqErr.Constraint],
+				Constraint: pqErr.Constraint,
+				Err:        err,
+			}
+		case pqForeignKeyViolation:
+			return fmt.Errorf("%w: %s", ErrForeignKeyViolation, pqErr.Constraint)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,339 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/schema"
+)
+
+var ErrInvalidSpec = errors.New("invalid filter")
+
+// Operator comparison of a filter condition
+type Operator string
+
+const (
+	OpEq       Operator = "eq"
+	OpNe       Operator = "ne"
+	OpLt       Operator = "lt"
+	OpLte      Operator = "lte"
+	OpGt       Operator = "gt"
+	OpGte      Operator = "gte"
+	OpLike     Operator = "like"     // case insensitive, % and _ are wildcards
+	OpIn       Operator = "in"       // comma separated values
+	OpContains Operator = "contains" // array holds all comma separated values, jsonb contains the JSON value
+	OpOverlaps Operator = "overlaps" // array holds any of the comma separated values
+)
+
+// Condition filter on a column, jsonb paths are dotted, e.g. metadata.team.name.
+// Containment needs no path, e.g. metadata:contains:{"team":{"name":"core"}}.
+type Condition struct {
+	Field string
+	Op    Operator
+	Value string
+}
+
+// Order sort on a column
+type Order struct {
+	Field string
+	Desc  bool
+}
+
+// Spec typed filter and sort of a listing, conditions are combined with AND
+type Spec struct {
+	Conditions []Condition
+	Orders     []Order
+}
+
+// ParseSpec reads repeated filter=field:op:value parameters and sort=field,-field
+func ParseSpec(values url.Values) (*Spec, error) {
+	var spec = &Spec{}
+
+	for _, filter := range values["filter"] {
+		parts := strings.SplitN(filter, ":", 3)
+
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("%w: %q is not field:op:value", ErrInvalidSpec, filter)
+		}
+
+		spec.Conditions = append(spec.Conditions, Condition{Field: parts[0], Op: Operator(parts[1]), Value: parts[2]})
+	}
+
+	for _, sort := range values["sort"] {
+		for _, field := range strings.Split(sort, ",") {
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(strings.TrimPrefix(field, "-"), "+")
+
+			if field == "" {
+				return nil, fmt.Errorf("%w: empty sort field", ErrInvalidSpec)
+			}
+
+			spec.Orders = append(spec.Orders, Order{Field: field, Desc: desc})
+		}
+	}
+
+	return spec, nil
+}
+
+// IsEmpty spec without conditions and orders
+func (s *Spec) IsEmpty() bool {
+	return s == nil || (len(s.Conditions) == 0 && len(s.Orders) == 0)
+}
+
+// Fields columns the spec filters or sorts by, jsonb paths by their column
+func (s *Spec) Fields() []string {
+	if s == nil {
+		return nil
+	}
+
+	var fields = make([]string, 0, len(s.Conditions)+len(s.Orders))
+
+	for _, condition := range s.Conditions {
+		column, _, _ := strings.Cut(condition.Field, ".")
+		fields = append(fields, column)
+	}
+
+	for _, order := range s.Orders {
+		fields = append(fields, order.Field)
+	}
+
+	return fields
+}
+
+// ColumnKind decides the operators and the value parsing of a column
+type ColumnKind int
+
+const (
+	KindText ColumnKind = iota
+	KindBool
+	KindTime
+	KindUUID
+	KindArray
+	KindJSON
+)
+
+var kindOperators = map[ColumnKind][]Operator{
+	KindText:  {OpEq, OpNe, OpLike, OpIn},
+	KindBool:  {OpEq, OpNe},
+	KindTime:  {OpEq, OpNe, OpLt, OpLte, OpGt, OpGte},
+	KindUUID:  {OpEq, OpNe, OpIn},
+	KindArray: {OpContains, OpOverlaps},
+	KindJSON:  {OpEq, OpNe, OpLike, OpIn, OpContains}, // on a text value of a path, containment on the jsonb value
+}
+
+// Whitelist columns of a model open to filtering and sorting
+type Whitelist struct {
+	columns map[string]ColumnKind
+}
+
+// NewWhitelist whitelist of the model columns named by their SQL name, the kinds come from the bun tags.
+// Panics when a column is not a field of the model.
+func NewWhitelist(model any, columns ...string) *Whitelist {
+	table := schema.NewTables(pgdialect.New()).Get(reflect.TypeOf(model).Elem())
+	whitelist := &Whitelist{columns: make(map[string]ColumnKind, len(columns))}
+
+	for _, column := range columns {
+		field := table.LookupField(column)
+
+		if field == nil {
+			panic(fmt.Sprintf("%s has no column %s", table.TypeName, column))
+		}
+
+		whitelist.columns[column] = columnKind(field)
+	}
+
+	return whitelist
+}
+
+func columnKind(field *schema.Field) ColumnKind {
+	sqlType := strings.ToLower(field.UserSQLType)
+
+	if sqlType == "" {
+		sqlType = strings.ToLower(field.DiscoveredSQLType)
+	}
+
+	switch {
+	case field.Tag.HasOption("array") || strings.HasSuffix(sqlType, "[]"):
+		return KindArray
+	case strings.HasPrefix(sqlType, "json"):
+		return KindJSON
+	case strings.HasPrefix(sqlType, "bool"):
+		return KindBool
+	case strings.HasPrefix(sqlType, "timestamp"), strings.HasPrefix(sqlType, "date"):
+		return KindTime
+	case strings.HasPrefix(sqlType, "uuid"):
+		return KindUUID
+	default:
+		return KindText
+	}
+}
+
+// Filter validates the spec against the whitelist and translates it into a query filter
+func (w *Whitelist) Filter(spec *Spec) (Filter, error) {
+	if spec.IsEmpty() {
+		return nil, nil
+	}
+
+	var apply []Filter
+
+	for _, condition := range spec.Conditions {
+		filter, err := w.condition(condition)
+
+		if err != nil {
+			return nil, err
+		}
+
+		apply = append(apply, filter)
+	}
+
+	for _, order := range spec.Orders {
+		kind, ok := w.columns[order.Field]
+
+		if !ok || kind == KindArray || kind == KindJSON {
+			return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidSpec, order.Field)
+		}
+
+		var direction = "ASC"
+
+		if order.Desc {
+			direction = "DESC"
+		}
+
+		column := order.Field
+		apply = append(apply, func(query *bun.SelectQuery) *bun.SelectQuery {
+			return query.OrderExpr("?TableAlias.? "+direction, bun.Ident(column))
+		})
+	}
+
+	return func(query *bun.SelectQuery) *bun.SelectQuery {
+		for _, filter := range apply {
+			query = filter(query)
+		}
+		return query
+	}, nil
+}
+
+func (w *Whitelist) condition(condition Condition) (Filter, error) {
+	column, path, _ := strings.Cut(condition.Field, ".")
+	kind, ok := w.columns[column]
+
+	if !ok || (kind != KindJSON && path != "") || (kind == KindJSON && path == "" && condition.Op != OpContains) {
+		return nil, fmt.Errorf("%w: cannot filter by %q", ErrInvalidSpec, condition.Field)
+	}
+
+	if !slices.Contains(kindOperators[kind], condition.Op) {
+		return nil, fmt.Errorf("%w: operator %q is not supported by %q", ErrInvalidSpec, condition.Op, condition.Field)
+	}
+
+	// left hand side of the comparison
+	var lhs = "?TableAlias.?"
+	var lhsArgs = []any{bun.Ident(column)}
+
+	if kind == KindJSON && condition.Op == OpContains {
+		if !json.Valid([]byte(condition.Value)) {
+			return nil, fmt.Errorf("%w: %s: %q is not JSON", ErrInvalidSpec, condition.Field, condition.Value)
+		}
+
+		if path != "" {
+			lhs = "?TableAlias.? #> ?"
+			lhsArgs = append(lhsArgs, pgdialect.Array(strings.Split(path, ".")))
+		}
+
+		return where(lhs+" @> ?::jsonb", append(lhsArgs, condition.Value)...), nil
+	}
+
+	if kind == KindJSON {
+		lhs = "?TableAlias.? #>> ?"
+		lhsArgs = append(lhsArgs, pgdialect.Array(strings.Split(path, ".")))
+	}
+
+	switch condition.Op {
+	case OpIn:
+		values, err := parseValues(kind, strings.Split(condition.Value, ","))
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidSpec, condition.Field, err)
+		}
+
+		return where(lhs+" IN (?)", append(lhsArgs, bun.In(values))...), nil
+	case OpContains, OpOverlaps:
+		var operator = " @> ?"
+
+		if condition.Op == OpOverlaps {
+			operator = " && ?"
+		}
+
+		return where(lhs+operator, append(lhsArgs, pgdialect.Array(strings.Split(condition.Value, ",")))...), nil
+	}
+
+	values, err := parseValues(kind, []string{condition.Value})
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidSpec, condition.Field, err)
+	}
+
+	return where(lhs+" "+sqlOperators[condition.Op]+" ?", append(lhsArgs, values[0])...), nil
+}
+
+var sqlOperators = map[Operator]string{
+	OpEq:   "=",
+	OpNe:   "<>",
+	OpLt:   "<",
+	OpLte:  "<=",
+	OpGt:   ">",
+	OpGte:  ">=",
+	OpLike: "ILIKE",
+}
+
+func where(query string, args ...any) Filter {
+	return func(q *bun.SelectQuery) *bun.SelectQuery {
+		return q.Where(query, args...)
+	}
+}
+
+// parseValues converts query string values to the column type
+func parseValues(kind ColumnKind, raw []string) ([]any, error) {
+	var values = make([]any, 0, len(raw))
+
+	for _, value := range raw {
+		var parsed any
+		var err error
+
+		switch kind {
+		case KindBool:
+			parsed, err = strconv.ParseBool(value)
+		case KindTime:
+			parsed, err = parseTime(value)
+		case KindUUID:
+			parsed, err = uuid.Parse(value)
+		default:
+			parsed = value
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, parsed)
+	}
+
+	return values, nil
+}
+
+// parseTime accepts RFC 3339 timestamps and plain dates
+func parseTime(value string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed.UTC(), nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
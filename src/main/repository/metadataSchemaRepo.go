@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"cabinet/src/main/datasource"
+	"cabinet/src/main/metadata"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/validation"
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// metadataSchemaUniqueFields unique constraints of users.metadata_schemas
+var metadataSchemaUniqueFields = map[string]string{
+	"metadata_schemas_namespace_key": "Namespace",
+}
+
+// IMetadataSchemaRepository metadata schema registry used by services
+type IMetadataSchemaRepository interface {
+	FindByNamespace(ctx context.Context, namespace string) (*model.MetadataSchema, error)
+	List(ctx context.Context) ([]*model.MetadataSchema, error)
+	Create(ctx context.Context, schema *model.MetadataSchema) error
+	Update(ctx context.Context, schema *model.MetadataSchema) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+var _ IMetadataSchemaRepository = (*MetadataSchemaRepo)(nil)
+
+type MetadataSchemaRepo struct {
+	datasource *datasource.Datasource
+}
+
+func NewMetadataSchemaRepo(datasource *datasource.Datasource) *MetadataSchemaRepo {
+	return &MetadataSchemaRepo{datasource: datasource}
+}
+
+func (m *MetadataSchemaRepo) FindByNamespace(ctx context.Context, namespace string) (*model.MetadataSchema, error) {
+	ctx, err := resolve(m.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var schema = &model.MetadataSchema{}
+
+	err = m.datasource.IDB(ctx).NewSelect().Model(schema).Where("?TableAlias.namespace = ?", namespace).Scan(ctx)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return schema, nil
+}
+
+// List every registered schema ordered by namespace
+func (m *MetadataSchemaRepo) List(ctx context.Context) ([]*model.MetadataSchema, error) {
+	ctx, err := resolve(m.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var schemas = make([]*model.MetadataSchema, 0)
+
+	err = m.datasource.IDB(ctx).NewSelect().Model(&schemas).OrderExpr("?TableAlias.namespace ASC").Scan(ctx)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return schemas, nil
+}
+
+// Create registers the schema, wraps validation.ErrInvalid for a bad namespace and metadata.ErrInvalidSchema
+// for a document that does not compile. Values stored before are not checked again.
+func (m *MetadataSchemaRepo) Create(ctx context.Context, schema *model.MetadataSchema) error {
+	ctx, err := resolve(m.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err = checkSchema(schema); err != nil {
+		return err
+	}
+
+	_, err = m.datasource.IDB(ctx).NewInsert().Model(schema).Exec(ctx)
+
+	return common.TranslateError(ctx, err, metadataSchemaUniqueFields)
+}
+
+// Update replaces the schema when its version is still current, wraps common.ErrConcurrentModification
+// otherwise. Fails like Create for invalid schemas.
+func (m *MetadataSchemaRepo) Update(ctx context.Context, schema *model.MetadataSchema) error {
+	ctx, err := resolve(m.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err = checkSchema(schema); err != nil {
+		return err
+	}
+
+	err = updateVersioned[model.MetadataSchema](ctx, m.datasource.IDB(ctx), schema)
+
+	return common.TranslateError(ctx, err, metadataSchemaUniqueFields)
+}
+
+// Delete unregisters the schema, metadata of its namespace is no longer checked
+func (m *MetadataSchemaRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	ctx, err := resolve(m.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := m.datasource.IDB(ctx).NewDelete().Model((*model.MetadataSchema)(nil)).Where("?TableAlias.id = ?", id).Exec(ctx)
+
+	if err != nil {
+		return common.TranslateError(ctx, err, nil)
+	}
+
+	return checkAffected(res)
+}
+
+func checkSchema(schema *model.MetadataSchema) error {
+	if err := validation.Validate(schema); err != nil {
+		return err
+	}
+
+	if !metadata.ValidNamespace(schema.Namespace) {
+		return validation.Errors{{Path: "namespace", Rule: "namespace"}}
+	}
+
+	_, err := metadata.Compile(schema.Document)
+
+	return err
+}
+
+// compiledSchema stored schema compiled once per version, err when the document no longer compiles
+type compiledSchema struct {
+	id      uuid.UUID
+	version int64
+	schema  *metadata.Schema
+	err     error
+}
+
+// compiledSchemas by namespace, an entry is replaced when the stored schema changes
+var compiledSchemas = struct {
+	sync.Mutex
+	byNamespace map[string]compiledSchema
+}{byNamespace: map[string]compiledSchema{}}
+
+// compile the stored schema unless its version is compiled already, a namespace registered again gets another id
+func compile(schema *model.MetadataSchema) (*metadata.Schema, error) {
+	compiledSchemas.Lock()
+	defer compiledSchemas.Unlock()
+
+	cached, ok := compiledSchemas.byNamespace[schema.Namespace]
+
+	if !ok || cached.id != schema.ID || cached.version != schema.Version {
+		cached = compiledSchema{id: schema.ID, version: schema.Version}
+		cached.schema, cached.err = metadata.Compile(schema.Document)
+		compiledSchemas.byNamespace[schema.Namespace] = cached
+
+		if cached.err != nil {
+			slog.Error("Stored metadata schema does not compile", slog.String("namespace", schema.Namespace),
+				slog.Int64("version", schema.Version), slog.Any("err", cached.err))
+		}
+	}
+
+	return cached.schema, cached.err
+}
+
+// checkMetadata validates the values against the schemas registered for their namespaces, wraps
+// validation.ErrInvalid with a violation per failed keyword. Values of a namespace whose stored schema
+// no longer compiles fail with a schema violation, other namespaces are checked as usual.
+func checkMetadata(ctx context.Context, idb bun.IDB, values metadata.Values) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	var stored []*model.MetadataSchema
+
+	err := idb.NewSelect().Model(&stored).Where("?TableAlias.namespace IN (?)", bun.In(values.Namespaces())).Scan(ctx)
+
+	if err != nil {
+		return common.TranslateError(ctx, err, nil)
+	}
+
+	var schemas = make(metadata.Schemas, len(stored))
+	var violations = make(validation.Errors, 0)
+
+	for _, schema := range stored {
+		compiled, err := compile(schema)
+
+		if err != nil {
+			violations = append(violations, validation.Violation{Path: "metadata." + schema.Namespace, Rule: "schema"})
+			continue
+		}
+
+		schemas[schema.Namespace] = compiled
+	}
+
+	found, err := schemas.Validate(values)
+
+	if err != nil {
+		return err
+	}
+
+	for _, violation := range found {
+		violations = append(violations, validation.Violation(violation))
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return violations
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"cabinet/src/main/metadata"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/validation"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+const teamSchema = `{"type":"object","required":["name"],"properties":{"name":{"type":"string","maxLength":10}},"additionalProperties":false}`
+
+func TestCreateMetadataSchema(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	mock.ExpectQuery(`INSERT INTO "users"."metadata_schemas" .* VALUES \(DEFAULT, '.*', '.*', 1, 'team', 'Team membership', '\{"type":"object".*\}'\)`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId1))
+	mock.ExpectQuery(`INSERT INTO "users"."metadata_schemas"`).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "metadata_schemas_namespace_key"})
+
+	var repo = NewMetadataSchemaRepo(ds)
+	var schema = &model.MetadataSchema{Namespace: "team", Description: "Team membership", Document: json.RawMessage(teamSchema)}
+
+	assert.NoError(t, repo.Create(context.Background(), schema))
+	assert.Equal(t, profileTestId1, schema.ID)
+
+	var uniqueErr *common.UniqueViolationError
+
+	assert.True(t, errors.As(repo.Create(context.Background(), &model.MetadataSchema{Namespace: "team", Document: json.RawMessage(teamSchema)}), &uniqueErr))
+	assert.Equal(t, "Namespace", uniqueErr.Field)
+
+	// invalid schemas never reach the database
+	var violations validation.Errors
+
+	assert.True(t, errors.As(repo.Create(context.Background(), &model.MetadataSchema{Namespace: "Team.Name", Document: json.RawMessage(teamSchema)}), &violations))
+	assert.Equal(t, []string{"namespace: namespace"}, violations.Details())
+
+	assert.True(t, errors.As(repo.Create(context.Background(), &model.MetadataSchema{}), &violations))
+	assert.Equal(t, []string{"namespace: required", "document: required"}, violations.Details())
+
+	err := repo.Create(context.Background(), &model.MetadataSchema{Namespace: "team", Document: json.RawMessage(`{"type":"text"}`)})
+
+	assert.True(t, errors.Is(err, metadata.ErrInvalidSchema))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestCreateMetadataSchema is successful")
+}
+
+func TestFindUpdateAndDeleteMetadataSchema(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	mock.ExpectQuery(`SELECT .* FROM "users"."metadata_schemas" AS "metadata_schema" WHERE \("metadata_schema".namespace = 'team'\)`).
+		WillReturnRows(mock.NewRows([]string{"id", "version", "namespace", "document"}).AddRow(profileTestId1, 1, "team", teamSchema))
+	mock.ExpectQuery(`SELECT .* FROM "users"."metadata_schemas" AS "metadata_schema" ORDER BY "metadata_schema".namespace ASC`).
+		WillReturnRows(mock.NewRows([]string{"id", "namespace", "document"}).AddRow(profileTestId2, "billing", `{}`).AddRow(profileTestId1, "team", teamSchema))
+	mock.ExpectExec(`UPDATE "users"."metadata_schemas" AS "metadata_schema" SET .*"version" = 2, .* WHERE \("metadata_schema".version = 1\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "users"."metadata_schemas" AS "metadata_schema" WHERE \("metadata_schema".id = '` + profileTestId1.String() + `'\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "users"."metadata_schemas"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var repo = NewMetadataSchemaRepo(ds)
+
+	schema, err := repo.FindByNamespace(context.Background(), "team")
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, teamSchema, string(schema.Document))
+
+	schemas, err := repo.List(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(schemas))
+	assert.Equal(t, "billing", schemas[0].Namespace)
+
+	schema.Document = json.RawMessage(`{"type":"object"}`)
+
+	assert.NoError(t, repo.Update(context.Background(), schema))
+	assert.Equal(t, int64(2), schema.Version)
+
+	schema.Document = json.RawMessage(`{"minimum":"one"}`)
+
+	assert.True(t, errors.Is(repo.Update(context.Background(), schema), metadata.ErrInvalidSchema))
+	assert.Equal(t, int64(2), schema.Version)
+
+	assert.NoError(t, repo.Delete(context.Background(), profileTestId1))
+	assert.True(t, errors.Is(repo.Delete(context.Background(), profileTestId1), common.ErrNotFound))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestFindUpdateAndDeleteMetadataSchema is successful")
+}
+
+func TestCreateProfileWithMetadata(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	// only namespaces of the metadata are loaded, unregistered ones pass
+	mock.ExpectQuery(`SELECT .* FROM "users"."metadata_schemas" AS "metadata_schema" WHERE \("metadata_schema".namespace IN \('notes', 'team'\)\)`).
+		WillReturnRows(mock.NewRows([]string{"id", "namespace", "document"}).AddRow(profileTestId2, "team", teamSchema))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "users"."profiles" .*'\{"notes":"anything","team":\{"name":"core"\}\}'`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId1))
+	mock.ExpectExec(`UPDATE "users"."profile_emails"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT .* FROM "users"."metadata_schemas" AS "metadata_schema" WHERE \("metadata_schema".namespace IN \('team'\)\)`).
+		WillReturnRows(mock.NewRows([]string{"id", "namespace", "document"}).AddRow(profileTestId2, "team", teamSchema))
+
+	var profileRepo = NewProfileRepo(ds)
+	var profile = &model.Profile{Login: "login1", Metadata: metadata.Values{
+		"notes": "anything",
+		"team":  map[string]any{"name": "core"},
+	}}
+
+	assert.NoError(t, profileRepo.Create(context.Background(), profile))
+	assert.Equal(t, profileTestId1, profile.ID)
+
+	var violations validation.Errors
+
+	profile.Metadata = metadata.Values{"team": map[string]any{"name": "infrastructure", "lead": true}}
+
+	assert.True(t, errors.As(profileRepo.Create(context.Background(), profile), &violations))
+	assert.Equal(t, []string{"metadata.team.lead: additionalProperties", "metadata.team.name: maxLength=10"}, violations.Details())
+
+	// profiles without metadata do not query the schemas
+	assert.True(t, errors.As(profileRepo.Create(context.Background(), &model.Profile{}), &violations))
+	assert.Equal(t, []string{"login: required"}, violations.Details())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestCreateProfileWithMetadata is successful")
+}
+
+func TestCheckMetadataCompiledSchemas(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var teamId = uuid.New()
+	var legacyId = uuid.New()
+	var columns = []string{"id", "version", "namespace", "document"}
+
+	// a stored document that no longer compiles only fails the values of its namespace
+	mock.ExpectQuery(`SELECT .* FROM "users"."metadata_schemas" AS "metadata_schema" WHERE \("metadata_schema".namespace IN \('legacy', 'team'\)\)`).
+		WillReturnRows(mock.NewRows(columns).AddRow(legacyId, 1, "legacy", `{"type":"text"}`).AddRow(teamId, 1, "team", teamSchema))
+	mock.ExpectQuery(`SELECT .* FROM "users"."metadata_schemas"`).
+		WillReturnRows(mock.NewRows(columns).AddRow(teamId, 1, "team", teamSchema))
+	mock.ExpectQuery(`SELECT .* FROM "users"."metadata_schemas"`).
+		WillReturnRows(mock.NewRows(columns).AddRow(teamId, 2, "team", `{"type":"object","required":["lead"]}`))
+
+	var violations validation.Errors
+
+	err := checkMetadata(context.Background(), ds.Db, metadata.Values{"legacy": 1, "team": map[string]any{"name": "infrastructure"}})
+
+	assert.True(t, errors.As(err, &violations))
+	assert.Equal(t, []string{"metadata.legacy: schema", "metadata.team.name: maxLength=10"}, violations.Details())
+
+	// each version is compiled once, the cached one ignores the document
+	var team = &model.MetadataSchema{Namespace: "team", Document: json.RawMessage(`{}`)}
+	team.ID = teamId
+	team.Version = 1
+
+	compiled, err := compile(team)
+
+	assert.NoError(t, err)
+	assert.Len(t, compiled.Validate(map[string]any{"name": "infrastructure"}, "team"), 1)
+
+	assert.NoError(t, checkMetadata(context.Background(), ds.Db, metadata.Values{"team": map[string]any{"name": "core"}}))
+	assert.Same(t, compiled, compiledSchemas.byNamespace["team"].schema)
+
+	assert.True(t, errors.As(checkMetadata(context.Background(), ds.Db, metadata.Values{"team": map[string]any{"name": "core"}}), &violations))
+	assert.Equal(t, []string{"metadata.team.lead: required"}, violations.Details())
+	assert.NotSame(t, compiled, compiledSchemas.byNamespace["team"].schema)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestCheckMetadataCompiledSchemas is successful")
+}
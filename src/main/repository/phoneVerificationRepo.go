@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"cabinet/src/main/datasource"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// ErrTooFrequent the limits of PhoneLimits are not kept
+var ErrTooFrequent = errors.New("verification codes requested too frequently")
+
+// PhoneLimits codes issued to a number of a profile, zero values disable a limit
+type PhoneLimits struct {
+	ResendAfter time.Duration // minimum interval between codes
+	HourlyLimit int           // codes within an hour
+}
+
+// IPhoneVerificationRepository phone verification storage used by services
+type IPhoneVerificationRepository interface {
+	Create(ctx context.Context, verification *model.PhoneVerification, limits PhoneLimits) error
+	FindPending(ctx context.Context, profileID uuid.UUID, at time.Time) (*model.PhoneVerification, error)
+	Attempt(ctx context.Context, id uuid.UUID, at time.Time, maxAttempts int) (*model.PhoneVerification, error)
+	Confirm(ctx context.Context, id uuid.UUID, at time.Time) (*model.Profile, error)
+}
+
+var _ IPhoneVerificationRepository = (*PhoneVerificationRepo)(nil)
+
+type PhoneVerificationRepo struct {
+	datasource *datasource.Datasource
+}
+
+func NewPhoneVerificationRepo(datasource *datasource.Datasource) *PhoneVerificationRepo {
+	return &PhoneVerificationRepo{datasource: datasource}
+}
+
+// Create inserts the verification and consumes the pending ones of the profile, only the latest code stays valid.
+// Created and Expires come from the caller's clock. Codes beyond the limits fail with ErrTooFrequent, the limits
+// are checked holding the lock of the profile row so concurrent requests cannot both pass them.
+func (v *PhoneVerificationRepo) Create(ctx context.Context, verification *model.PhoneVerification, limits PhoneLimits) error {
+	ctx, err := resolve(v.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err = validateIssued(verification, verification.Created); err != nil {
+		return err
+	}
+
+	return v.datasource.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().Model((*model.Profile)(nil)).
+			Column("id").
+			Where("?TableAlias.id = ?", verification.ProfileID).
+			For("UPDATE").
+			Scan(ctx, new(uuid.UUID))
+
+		if err != nil {
+			return common.TranslateError(ctx, err, nil)
+		}
+
+		if err = checkLimits(ctx, tx, verification, limits); err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().Model((*model.PhoneVerification)(nil)).
+			Set("consumed = ?", verification.Created).
+			Where("?TableAlias.profile_id = ?", verification.ProfileID).
+			Where("?TableAlias.consumed IS NULL").
+			Exec(ctx)
+
+		if err != nil {
+			return common.TranslateError(ctx, err, nil)
+		}
+
+		_, err = tx.NewInsert().Model(verification).Exec(ctx)
+
+		return common.TranslateError(ctx, err, nil)
+	})
+}
+
+// FindPending latest verification of the profile still pending at the time, common.ErrNotFound when there is none
+func (v *PhoneVerificationRepo) FindPending(ctx context.Context, profileID uuid.UUID, at time.Time) (*model.PhoneVerification, error) {
+	ctx, err := resolve(v.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var verification = &model.PhoneVerification{}
+
+	err = v.datasource.IDB(ctx).NewSelect().
+		Model(verification).
+		Where("?TableAlias.profile_id = ?", profileID).
+		Where("?TableAlias.consumed IS NULL").
+		Where("?TableAlias.expires > ?", at).
+		OrderExpr("?TableAlias.created DESC").
+		Limit(1).
+		Scan(ctx)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return verification, nil
+}
+
+// checkLimits fails with ErrTooFrequent when the number of the profile got a code within ResendAfter
+// or HourlyLimit codes within the hour before the verification is created
+func checkLimits(ctx context.Context, idb bun.IDB, verification *model.PhoneVerification, limits PhoneLimits) error {
+	if limits.ResendAfter > 0 {
+		recent, err := countIssued(ctx, idb, verification, verification.Created.Add(-limits.ResendAfter))
+
+		if err != nil {
+			return err
+		}
+
+		if recent > 0 {
+			return ErrTooFrequent
+		}
+	}
+
+	if limits.HourlyLimit > 0 {
+		hourly, err := countIssued(ctx, idb, verification, verification.Created.Add(-time.Hour))
+
+		if err != nil {
+			return err
+		}
+
+		if hourly >= limits.HourlyLimit {
+			return ErrTooFrequent
+		}
+	}
+
+	return nil
+}
+
+// countIssued verifications of the profile and number of the verification created after since, consumed ones included
+func countIssued(ctx context.Context, idb bun.IDB, verification *model.PhoneVerification, since time.Time) (int, error) {
+	count, err := idb.NewSelect().
+		Model((*model.PhoneVerification)(nil)).
+		Where("?TableAlias.profile_id = ?", verification.ProfileID).
+		Where("?TableAlias.phone = ?", verification.Phone).
+		Where("?TableAlias.created > ?", since).
+		Count(ctx)
+
+	if err != nil {
+		return 0, common.TranslateError(ctx, err, nil)
+	}
+
+	return count, nil
+}
+
+// Attempt counts a try of the code and returns the verification to compare it with. Verifications no longer
+// pending or out of attempts are common.ErrNotFound, counting and checking in one statement keeps concurrent
+// tries within maxAttempts.
+func (v *PhoneVerificationRepo) Attempt(ctx context.Context, id uuid.UUID, at time.Time, maxAttempts int) (*model.PhoneVerification, error) {
+	ctx, err := resolve(v.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var verification = &model.PhoneVerification{}
+
+	err = v.datasource.IDB(ctx).NewUpdate().Model(verification).
+		Set("attempts = ?TableAlias.attempts + 1").
+		Where("?TableAlias.id = ?", id).
+		Where("?TableAlias.consumed IS NULL").
+		Where("?TableAlias.expires > ?", at).
+		Where("?TableAlias.attempts < ?", maxAttempts).
+		Returning("*").
+		Scan(ctx)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return verification, nil
+}
+
+// Confirm consumes the pending verification and marks the number of the profile verified in one transaction.
+// Verifications no longer pending and numbers changed meanwhile are common.ErrNotFound.
+func (v *PhoneVerificationRepo) Confirm(ctx context.Context, id uuid.UUID, at time.Time) (*model.Profile, error) {
+	ctx, err := resolve(v.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var profile = &model.Profile{}
+
+	err = v.datasource.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var verification = &model.PhoneVerification{}
+
+		// consuming first locks the row, a concurrent confirmation finds nothing
+		err := tx.NewUpdate().Model(verification).
+			Set("consumed = ?", at).
+			Where("?TableAlias.id = ?", id).
+			Where("?TableAlias.consumed IS NULL").
+			Where("?TableAlias.expires > ?", at).
+			Returning("*").
+			Scan(ctx)
+
+		if err != nil {
+			return common.TranslateError(ctx, err, nil)
+		}
+
+		err = tx.NewSelect().Model(profile).
+			Where("?TableAlias.id = ?", verification.ProfileID).
+			Where("?TableAlias.phone_e164 = ?", verification.Phone).
+			Scan(ctx)
+
+		if err != nil {
+			return common.TranslateError(ctx, err, nil)
+		}
+
+		profile.PhoneVerified = at
+
+		return common.TranslateError(ctx, updateProfile(ctx, tx, profile), profileUniqueFields)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/validation"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePhoneVerification(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "profile"."id" FROM "users"."profiles" AS "profile" WHERE \("profile".id = '` + profileTestId1.String() + `'\) AND "profile"."deleted_at" IS NULL FOR UPDATE$`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId1))
+	mock.ExpectExec(`UPDATE "users"."phone_verifications" AS "phone_verification" SET consumed = '2029-12-31 23:50:00\+00:00'` +
+		` WHERE \("phone_verification".profile_id = '` + profileTestId1.String() + `'\) AND \("phone_verification".consumed IS NULL\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "users"."phone_verifications" .* VALUES \(DEFAULT, '2029-12-31 23:50:00\+00:00', '` + profileTestId1.String() + `', '\+12025550143', 'hash', '2030-01-01 00:00:00\+00:00', 0, DEFAULT\)`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId2))
+	mock.ExpectCommit()
+
+	var repo = NewPhoneVerificationRepo(ds)
+	var issued = time.Date(2029, 12, 31, 23, 50, 0, 0, time.UTC)
+	var verification = &model.PhoneVerification{
+		ProfileID: profileTestId1,
+		Phone:     "+12025550143",
+		CodeHash:  "hash",
+		Expires:   issued.Add(10 * time.Minute),
+	}
+
+	var violations validation.Errors
+
+	assert.True(t, errors.As(repo.Create(context.Background(), verification, PhoneLimits{}), &violations))
+	assert.Equal(t, []string{"created: required"}, violations.Details())
+
+	// times come from the clock of the service
+	verification.Created = issued
+
+	assert.NoError(t, repo.Create(context.Background(), verification, PhoneLimits{}))
+	assert.Equal(t, profileTestId2, verification.ID)
+
+	verification.Phone = "(202) 555-0143"
+
+	assert.True(t, errors.Is(repo.Create(context.Background(), verification, PhoneLimits{}), validation.ErrInvalid))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestCreatePhoneVerification is successful")
+}
+
+func TestCreatePhoneVerificationLimits(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var count = func(since string) string {
+		return `SELECT count\(\*\) FROM "users"."phone_verifications" AS "phone_verification" WHERE \("phone_verification".profile_id = '` + profileTestId1.String() + `'\)` +
+			` AND \("phone_verification".phone = '\+12025550143'\) AND \("phone_verification".created > '` + since + `'\)$`
+	}
+
+	// the counts are taken holding the lock of the profile row
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "profile"."id" FROM "users"."profiles" AS "profile" .* FOR UPDATE$`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId1))
+	mock.ExpectQuery(count(`2025-01-01 11:59:00\+00:00`)).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "profile"."id" FROM "users"."profiles" AS "profile" .* FOR UPDATE$`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId1))
+	mock.ExpectQuery(count(`2025-01-01 11:59:00\+00:00`)).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(count(`2025-01-01 11:00:00\+00:00`)).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(5))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "profile"."id" FROM "users"."profiles" AS "profile" .* FOR UPDATE$`).
+		WillReturnRows(mock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	var repo = NewPhoneVerificationRepo(ds)
+	var limits = PhoneLimits{ResendAfter: time.Minute, HourlyLimit: 5}
+	var verification = &model.PhoneVerification{
+		ProfileID: profileTestId1,
+		Phone:     "+12025550143",
+		CodeHash:  "hash",
+		Expires:   time.Date(2025, 1, 1, 12, 10, 0, 0, time.UTC),
+	}
+
+	verification.Created = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.True(t, errors.Is(repo.Create(context.Background(), verification, limits), ErrTooFrequent))
+	assert.True(t, errors.Is(repo.Create(context.Background(), verification, limits), ErrTooFrequent))
+	assert.True(t, errors.Is(repo.Create(context.Background(), verification, limits), common.ErrNotFound))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestCreatePhoneVerificationLimits is successful")
+}
+
+func TestAttemptPhoneVerification(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var id = uuid.New()
+	var at = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT .* FROM "users"."phone_verifications" AS "phone_verification" WHERE \("phone_verification".profile_id = '` + profileTestId1.String() + `'\)` +
+		` AND \("phone_verification".consumed IS NULL\) AND \("phone_verification".expires > '2025-01-01 00:00:00\+00:00'\)` +
+		` ORDER BY "phone_verification".created DESC LIMIT 1`).
+		WillReturnRows(mock.NewRows([]string{"id", "profile_id", "phone", "attempts"}).AddRow(id, profileTestId1, "+12025550143", 2))
+	mock.ExpectQuery(`UPDATE "users"."phone_verifications" AS "phone_verification" SET attempts = "phone_verification".attempts \+ 1` +
+		` WHERE \("phone_verification".id = '` + id.String() + `'\) AND \("phone_verification".consumed IS NULL\)` +
+		` AND \("phone_verification".expires > '2025-01-01 00:00:00\+00:00'\) AND \("phone_verification".attempts < 5\) RETURNING \*`).
+		WillReturnRows(mock.NewRows([]string{"id", "code_hash", "attempts"}).AddRow(id, "hash", 3))
+	mock.ExpectQuery(`UPDATE "users"."phone_verifications"`).
+		WillReturnRows(mock.NewRows([]string{"id"}))
+
+	var repo = NewPhoneVerificationRepo(ds)
+
+	pending, err := repo.FindPending(context.Background(), profileTestId1, at)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pending.Attempts)
+
+	attempted, err := repo.Attempt(context.Background(), id, at, 5)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "hash", attempted.CodeHash)
+	assert.Equal(t, 3, attempted.Attempts)
+
+	// out of attempts
+	_, err = repo.Attempt(context.Background(), id, at, 5)
+
+	assert.True(t, errors.Is(err, common.ErrNotFound))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestAttemptPhoneVerification is successful")
+}
+
+func TestConfirmPhoneVerification(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var id = uuid.New()
+	var at = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE "users"."phone_verifications" AS "phone_verification" SET consumed = '2025-01-01 00:00:00\+00:00'` +
+		` WHERE \("phone_verification".id = '` + id.String() + `'\) AND \("phone_verification".consumed IS NULL\) AND \("phone_verification".expires > '2025-01-01 00:00:00\+00:00'\) RETURNING \*`).
+		WillReturnRows(mock.NewRows([]string{"id", "profile_id", "phone"}).AddRow(id, profileTestId1, "+12025550143"))
+	mock.ExpectQuery(`SELECT .* FROM "users"."profiles" AS "profile" WHERE \("profile".id = '` + profileTestId1.String() + `'\) AND \("profile".phone_e164 = '\+12025550143'\)`).
+		WillReturnRows(mock.NewRows([]string{"id", "login", "phone_e164", "version"}).AddRow(profileTestId1, "login1", "+12025550143", 2))
+	mock.ExpectExec(`UPDATE "users"."profiles" AS "profile" SET .*"phone_e164" = '\+12025550143', "phone_verified" = '2025-01-01 00:00:00\+00:00', .* WHERE \("profile".version = 2\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "users"."profile_emails" AS "profile_email" SET is_primary = FALSE`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	// the number changed meanwhile, the code stays pending
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE "users"."phone_verifications"`).
+		WillReturnRows(mock.NewRows([]string{"id", "profile_id", "phone"}).AddRow(id, profileTestId1, "+12025550143"))
+	mock.ExpectQuery(`SELECT .* FROM "users"."profiles"`).
+		WillReturnRows(mock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	// used and expired codes match nothing
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE "users"."phone_verifications"`).
+		WillReturnRows(mock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	var repo = NewPhoneVerificationRepo(ds)
+
+	profile, err := repo.Confirm(context.Background(), id, at)
+
+	assert.NoError(t, err)
+	assert.Equal(t, at, profile.PhoneVerified)
+	assert.Equal(t, int64(3), profile.Version)
+
+	_, err = repo.Confirm(context.Background(), id, at)
+
+	assert.True(t, errors.Is(err, common.ErrNotFound))
+
+	_, err = repo.Confirm(context.Background(), id, at)
+
+	assert.True(t, errors.Is(err, common.ErrNotFound))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestConfirmPhoneVerification is successful")
+}
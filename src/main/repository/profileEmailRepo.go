@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"cabinet/src/main/datasource"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/validation"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// profileEmailUniqueFields unique indexes of users.profile_emails
+var profileEmailUniqueFields = map[string]string{
+	"profile_emails_email_key":         "Email",
+	"profile_emails_profile_email_key": "Email",
+	"profile_emails_primary_key":       "Primary",
+}
+
+// IProfileEmailRepository profile address storage used by services. The primary address is
+// written through the PrimaryEmail of IProfileRepository, see syncPrimaryEmail.
+type IProfileEmailRepository interface {
+	FindById(ctx context.Context, id uuid.UUID) (*model.ProfileEmail, error)
+	FindByEmail(ctx context.Context, email string) (*model.ProfileEmail, error)
+	ListByProfileID(ctx context.Context, profileID uuid.UUID) ([]*model.ProfileEmail, error)
+	Create(ctx context.Context, email *model.ProfileEmail) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+var _ IProfileEmailRepository = (*ProfileEmailRepo)(nil)
+
+type ProfileEmailRepo struct {
+	datasource *datasource.Datasource
+}
+
+func NewProfileEmailRepo(datasource *datasource.Datasource) *ProfileEmailRepo {
+	return &ProfileEmailRepo{datasource: datasource}
+}
+
+func (p *ProfileEmailRepo) FindById(ctx context.Context, id uuid.UUID) (*model.ProfileEmail, error) {
+	return p.findOne(ctx, "?TableAlias.id = ?", id)
+}
+
+// FindByEmail address ignoring case of the profile owning it, a verified or primary one. Unverified
+// secondary copies of other profiles are not owners.
+func (p *ProfileEmailRepo) FindByEmail(ctx context.Context, email string) (*model.ProfileEmail, error) {
+	return p.findOne(ctx, "lower(?TableAlias.email) = lower(?) AND (?TableAlias.verified IS NOT NULL OR ?TableAlias.is_primary)", email)
+}
+
+// ListByProfileID addresses of the profile, the primary one first, then oldest first
+func (p *ProfileEmailRepo) ListByProfileID(ctx context.Context, profileID uuid.UUID) ([]*model.ProfileEmail, error) {
+	ctx, err := resolve(p.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var emails = make([]*model.ProfileEmail, 0)
+
+	err = p.datasource.IDB(ctx).NewSelect().
+		Model(&emails).
+		Where("?TableAlias.profile_id = ?", profileID).
+		Apply(orderEmails).
+		Scan(ctx)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return emails, nil
+}
+
+// Create inserts an unverified secondary address, one the profile has already fails with
+// common.UniqueViolationError. Other profiles may hold copies until one of them is verified.
+func (p *ProfileEmailRepo) Create(ctx context.Context, email *model.ProfileEmail) error {
+	ctx, err := resolve(p.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err = validation.Validate(email); err != nil {
+		return err
+	}
+
+	email.Primary = false
+	email.Verified = time.Time{}
+
+	_, err = p.datasource.IDB(ctx).NewInsert().Model(email).Exec(ctx)
+
+	return common.TranslateError(ctx, err, profileEmailUniqueFields)
+}
+
+// Delete removes a secondary address, the primary one is common.ErrNotFound like a missing address
+func (p *ProfileEmailRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	ctx, err := resolve(p.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := p.datasource.IDB(ctx).NewDelete().
+		Model((*model.ProfileEmail)(nil)).
+		Where("?TableAlias.id = ?", id).
+		Where("NOT ?TableAlias.is_primary").
+		Exec(ctx)
+
+	if err != nil {
+		return common.TranslateError(ctx, err, nil)
+	}
+
+	return checkAffected(res)
+}
+
+func (p *ProfileEmailRepo) findOne(ctx context.Context, query string, args ...any) (*model.ProfileEmail, error) {
+	ctx, err := resolve(p.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var email = &model.ProfileEmail{}
+
+	err = p.datasource.IDB(ctx).NewSelect().Model(email).Where(query, args...).Scan(ctx)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return email, nil
+}
+
+func orderEmails(query *bun.SelectQuery) *bun.SelectQuery {
+	return query.OrderExpr("?TableAlias.is_primary DESC, ?TableAlias.created ASC, ?TableAlias.id ASC")
+}
+
+// syncPrimaryEmail makes the PrimaryEmail of the profile its primary address row with the verification
+// time of EmailVerified, a previous primary address stays as a secondary one. An address verified by another
+// profile fails like the unique constraint of primary_email, verifying it releases the unverified copies.
+func syncPrimaryEmail(ctx context.Context, idb bun.IDB, profile *model.Profile) error {
+	_, err := idb.NewUpdate().Model((*model.ProfileEmail)(nil)).
+		Set("is_primary = FALSE").
+		Where("?TableAlias.profile_id = ?", profile.ID).
+		Where("?TableAlias.is_primary").
+		Where("lower(?TableAlias.email) <> lower(?)", profile.PrimaryEmail).
+		Exec(ctx)
+
+	if err != nil || profile.PrimaryEmail == "" {
+		return err
+	}
+
+	var primary = &model.ProfileEmail{
+		ProfileID: profile.ID,
+		Email:     profile.PrimaryEmail,
+		Verified:  profile.EmailVerified,
+		Primary:   true,
+	}
+
+	_, err = idb.NewInsert().Model(primary).
+		On("CONFLICT (profile_id, (lower(email))) DO UPDATE").
+		Set("email = EXCLUDED.email").
+		Set("verified = COALESCE(EXCLUDED.verified, ?TableAlias.verified)").
+		Set("is_primary = TRUE").
+		Exec(ctx)
+
+	if err != nil || profile.EmailVerified.IsZero() {
+		return err
+	}
+
+	return releaseEmail(ctx, idb, profile.ID, profile.PrimaryEmail)
+}
+
+// releaseEmail deletes the unverified secondary copies other profiles hold of an address the profile verified
+func releaseEmail(ctx context.Context, idb bun.IDB, profileID uuid.UUID, email string) error {
+	_, err := idb.NewDelete().Model((*model.ProfileEmail)(nil)).
+		Where("lower(?TableAlias.email) = lower(?)", email).
+		Where("?TableAlias.profile_id <> ?", profileID).
+		Where("?TableAlias.verified IS NULL").
+		Where("NOT ?TableAlias.is_primary").
+		Exec(ctx)
+
+	return err
+}
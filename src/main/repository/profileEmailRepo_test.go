@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/validation"
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+// expectPrimaryEmailSync statements of syncPrimaryEmail, verified addresses release the copies of other profiles
+func expectPrimaryEmailSync(mock sqlmock.Sqlmock, email string, verified bool) {
+	mock.ExpectExec(`UPDATE "users"."profile_emails" AS "profile_email" SET is_primary = FALSE`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO "users"."profile_emails" .* '` + regexp.QuoteMeta(email) + `', .* ON CONFLICT \(profile_id, \(lower\(email\)\)\) DO UPDATE`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(uuid.New()))
+
+	if verified {
+		mock.ExpectExec(`DELETE FROM "users"."profile_emails" AS "profile_email" WHERE \(lower\("profile_email".email\) = lower\('` + regexp.QuoteMeta(email) + `'\)\)`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+}
+
+// expectPrimaryEmailTaken statements of syncPrimaryEmail for an address another profile verified
+func expectPrimaryEmailTaken(mock sqlmock.Sqlmock, email string) {
+	mock.ExpectExec(`UPDATE "users"."profile_emails" AS "profile_email" SET is_primary = FALSE`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO "users"."profile_emails" .* '` + regexp.QuoteMeta(email) + `', .* ON CONFLICT`).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "profile_emails_email_key"})
+}
+
+func TestFindProfileEmails(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var emailId = uuid.New()
+
+	mock.ExpectQuery(`SELECT .* FROM "users"."profile_emails" AS "profile_email" WHERE \(lower\("profile_email".email\) = lower\('John@Smith.com'\)` +
+		` AND \("profile_email".verified IS NOT NULL OR "profile_email".is_primary\)\)`).
+		WillReturnRows(mock.NewRows([]string{"id", "profile_id", "email"}).AddRow(emailId, profileTestId1, "john@smith.com"))
+	mock.ExpectQuery(`SELECT .* FROM "users"."profile_emails" AS "profile_email" WHERE \("profile_email".id = '` + profileTestId2.String() + `'\)`).
+		WillReturnRows(mock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT .* FROM "users"."profile_emails" AS "profile_email" WHERE \("profile_email".profile_id = '` + profileTestId1.String() + `'\)` +
+		` ORDER BY "profile_email".is_primary DESC, "profile_email".created ASC, "profile_email".id ASC`).
+		WillReturnRows(mock.NewRows([]string{"id", "email", "is_primary"}).
+			AddRow(emailId, "john@smith.com", true).
+			AddRow(uuid.New(), "john@doe.com", false))
+
+	var repo = NewProfileEmailRepo(ds)
+
+	email, err := repo.FindByEmail(context.Background(), "John@Smith.com")
+
+	assert.NoError(t, err)
+	assert.Equal(t, emailId, email.ID)
+	assert.Equal(t, profileTestId1, email.ProfileID)
+
+	_, err = repo.FindById(context.Background(), profileTestId2)
+
+	assert.True(t, errors.Is(err, common.ErrNotFound))
+
+	emails, err := repo.ListByProfileID(context.Background(), profileTestId1)
+
+	assert.NoError(t, err)
+	assert.Len(t, emails, 2)
+	assert.True(t, emails[0].Primary)
+	assert.False(t, emails[1].IsVerified())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestFindProfileEmails is successful")
+}
+
+func TestOperateProfileEmail(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var emailId = uuid.New()
+
+	mock.ExpectQuery(`INSERT INTO "users"."profile_emails" .* VALUES \(DEFAULT, '.*', '` + profileTestId1.String() + `', 'john@doe.com', DEFAULT, FALSE\)`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(emailId))
+	mock.ExpectQuery(`INSERT INTO "users"."profile_emails"`).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "profile_emails_email_key"})
+	mock.ExpectExec(`DELETE FROM "users"."profile_emails" AS "profile_email" WHERE \("profile_email".id = '` + emailId.String() + `'\) AND \(NOT "profile_email".is_primary\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "users"."profile_emails"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var repo = NewProfileEmailRepo(ds)
+
+	// added addresses are secondary ones
+	var email = &model.ProfileEmail{ProfileID: profileTestId1, Email: "john@doe.com", Primary: true}
+
+	assert.NoError(t, repo.Create(context.Background(), email))
+	assert.Equal(t, emailId, email.ID)
+	assert.False(t, email.Primary)
+
+	var uniqueErr *common.UniqueViolationError
+
+	assert.True(t, errors.As(repo.Create(context.Background(), email), &uniqueErr))
+	assert.Equal(t, "Email", uniqueErr.Field)
+
+	assert.True(t, errors.Is(repo.Create(context.Background(), &model.ProfileEmail{Email: "doe"}), validation.ErrInvalid))
+
+	// the primary address is not removed
+	assert.NoError(t, repo.Delete(context.Background(), emailId))
+	assert.True(t, errors.Is(repo.Delete(context.Background(), emailId), common.ErrNotFound))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestOperateProfileEmail is successful")
+}
+
+func TestSyncPrimaryEmail(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var at = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(`UPDATE "users"."profile_emails" AS "profile_email" SET is_primary = FALSE WHERE \("profile_email".profile_id = '` + profileTestId1.String() + `'\)` +
+		` AND \("profile_email".is_primary\) AND \(lower\("profile_email".email\) <> lower\('john@doe.com'\)\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "users"."profile_emails" AS "profile_email" .* VALUES \(DEFAULT, '.*', '` + profileTestId1.String() + `', 'john@doe.com', '2025-01-01 00:00:00\+00:00', TRUE\)` +
+		` ON CONFLICT \(profile_id, \(lower\(email\)\)\) DO UPDATE SET email = EXCLUDED.email, verified = COALESCE\(EXCLUDED.verified, "profile_email".verified\), is_primary = TRUE`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(uuid.New()))
+
+	// the verified address releases the unverified secondary copies of other profiles
+	mock.ExpectExec(`DELETE FROM "users"."profile_emails" AS "profile_email" WHERE \(lower\("profile_email".email\) = lower\('john@doe.com'\)\)` +
+		` AND \("profile_email".profile_id <> '` + profileTestId1.String() + `'\) AND \("profile_email".verified IS NULL\) AND \(NOT "profile_email".is_primary\)`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	// cleared addresses only demote the primary row
+	mock.ExpectExec(`UPDATE "users"."profile_emails"`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var profile = &model.Profile{PrimaryEmail: "john@doe.com", EmailVerified: at}
+	profile.ID = profileTestId1
+
+	assert.NoError(t, syncPrimaryEmail(context.Background(), ds.Db, profile))
+
+	profile.PrimaryEmail = ""
+
+	assert.NoError(t, syncPrimaryEmail(context.Background(), ds.Db, profile))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestSyncPrimaryEmail is successful")
+}
@@ -3,27 +3,575 @@ package repository
 import (
 	"cabinet/src/main/datasource"
 	"cabinet/src/main/model"
+	"cabinet/src/main/model/interfaces"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/validation"
+	viewCommon "cabinet/src/main/view/common"
+	"context"
+	"database/sql"
 	"errors"
+	"html"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/uptrace/bun"
 )
 
+// profileUniqueFields unique constraints of users.profiles
+var profileUniqueFields = map[string]string{
+	"profiles_login_key":         "Login",
+	"profiles_primary_email_key": "PrimaryEmail",
+	"profiles_external_id_key":   "ExternalID",
+	"profile_emails_email_key":   "PrimaryEmail", // profile writes reach profile_emails only through syncPrimaryEmail
+}
+
+// ProfileColumns profile columns open to filtering and sorting, contacts stay private
+var ProfileColumns = common.NewWhitelist((*model.Profile)(nil),
+	"login", "fist_name", "middle_name", "last_name", "company", "location",
+	"tags", "private", "created", "changed", "metadata")
+
+// ProfileCardColumns columns shown on private profiles too, see view/profile.FromProfile
+var ProfileCardColumns = []string{"login", "fist_name", "middle_name", "last_name", "private"}
+
+// IProfileRepository profile storage used by services and controllers
+type IProfileRepository interface {
+	common.ISoftDeleteRepository[model.Profile]
+	Filter(spec *common.Spec) (common.Filter, error)
+	FindByLogin(ctx context.Context, login string) (*model.Profile, error)
+	FindByPrimaryEmail(ctx context.Context, email string) (*model.Profile, error)
+	FindByExternalID(ctx context.Context, externalID uuid.UUID) (*model.Profile, error)
+	Search(ctx context.Context, query string, page uint, pageSize uint) (*viewCommon.Paged[*model.ProfileMatch], error)
+}
+
+var _ IProfileRepository = (*ProfileRepo)(nil)
+
 type ProfileRepo struct {
 	datasource *datasource.Datasource
 }
 
-func (p *ProfileRepo) FindById(uuid uuid.UUID) (*model.Profile, error) {
-	if p.datasource == nil || p.datasource.Db == nil {
-		return nil, errors.New("datasource is nil")
+func NewProfileRepo(datasource *datasource.Datasource) *ProfileRepo {
+	return &ProfileRepo{datasource: datasource}
+}
+
+// FindById profile with its addresses, see model.ProfileEmail
+func (p *ProfileRepo) FindById(ctx context.Context, uuid uuid.UUID) (*model.Profile, error) {
+	return p.findOne(ctx, withEmails, "id = ?", uuid)
+}
+
+// FindPage profiles matching the filter ordered by creation time
+func (p *ProfileRepo) FindPage(ctx context.Context, filter common.Filter, page uint, pageSize uint) (*viewCommon.Paged[*model.Profile], error) {
+	ctx, err := resolve(p.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	paged, err := findPage[model.Profile](ctx, p.datasource.IDB(ctx), filter, page, pageSize)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, profileUniqueFields)
+	}
+
+	return paged, nil
+}
+
+// FindDeleted soft deleted profiles matching the filter
+func (p *ProfileRepo) FindDeleted(ctx context.Context, filter common.Filter, page uint, pageSize uint) (*viewCommon.Paged[*model.Profile], error) {
+	return p.FindPage(ctx, deleted(filter), page, pageSize)
+}
+
+// FindKeyset profiles matching the filter around the cursor, nil cursor is the first page
+func (p *ProfileRepo) FindKeyset(ctx context.Context, filter common.Filter, cursor *viewCommon.Cursor, limit uint) (*common.KeysetPage[*model.Profile], error) {
+	ctx, err := resolve(p.datasource, ctx)
+
+	if err != nil {
+		return nil, err
 	}
 
-	var profile = model.Profile{}
+	page, err := findKeyset[model.Profile](ctx, p.datasource.IDB(ctx), filter, cursor, limit)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, profileUniqueFields)
+	}
+
+	return page, nil
+}
+
+// WithPhone narrows a listing to profiles with the E.164 number, see phone.Parser
+func WithPhone(e164 string) common.Filter {
+	return func(query *bun.SelectQuery) *bun.SelectQuery {
+		return query.Where("?TableAlias.phone_e164 = ?", e164)
+	}
+}
+
+// Filter translates the spec over ProfileColumns, wraps common.ErrInvalidSpec
+func (p *ProfileRepo) Filter(spec *common.Spec) (common.Filter, error) {
+	return ProfileColumns.Filter(spec)
+}
+
+func (p *ProfileRepo) FindByLogin(ctx context.Context, login string) (*model.Profile, error) {
+	return p.findOne(ctx, nil, "login = ?", login)
+}
+
+func (p *ProfileRepo) FindByPrimaryEmail(ctx context.Context, email string) (*model.Profile, error) {
+	return p.findOne(ctx, nil, "primary_email = ?", email)
+}
+
+func (p *ProfileRepo) FindByExternalID(ctx context.Context, externalID uuid.UUID) (*model.Profile, error) {
+	return p.findOne(ctx, nil, "external_id = ?", externalID)
+}
+
+// Search ranks profiles by the full-text match of names, company and biography,
+// logins similar to the query are matched as well to tolerate typos
+func (p *ProfileRepo) Search(ctx context.Context, query string, page uint, pageSize uint) (*viewCommon.Paged[*model.ProfileMatch], error) {
+	ctx, err := resolve(p.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var pageable = viewCommon.Pagination{Page: page, PageSize: pageSize}
+	var matches = make([]*model.ProfileMatch, 0, pageSize)
+
+	query = strings.TrimSpace(query)
+
+	if query == "" {
+		return viewCommon.NewPaged(matches, pageable), nil
+	}
+
+	total, err := p.datasource.IDB(ctx).NewSelect().
+		Model(&matches).
+		ColumnExpr("?TableColumns").
+		ColumnExpr("ts_rank(?TableAlias.search_vector, websearch_to_tsquery('simple', ?0)) + similarity(?TableAlias.login, ?0) AS rank", query).
+		ColumnExpr("ts_headline('simple', "+searchDocument+", websearch_to_tsquery('simple', ?0), ?1) AS snippet", query, headlineOptions).
+		Where("?TableAlias.search_vector @@ websearch_to_tsquery('simple', ?0) OR ?TableAlias.login % ?0", query).
+		OrderExpr("rank DESC, ?TableAlias.created ASC, ?TableAlias.id ASC").
+		Limit(int(pageSize)).
+		Offset(pageable.Offset()).
+		ScanAndCount(ctx)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, profileUniqueFields)
+	}
+
+	for _, match := range matches {
+		match.Snippet = highlight(match.Snippet)
+	}
+
+	pageable.Total = uint64(total)
+
+	return viewCommon.NewPaged(matches, pageable), nil
+}
+
+// searchDocument text of the search_vector column, private profiles expose their names only
+const searchDocument = "concat_ws(' ', ?TableAlias.fist_name, ?TableAlias.middle_name, ?TableAlias.last_name, " +
+	"CASE WHEN ?TableAlias.private IS FALSE THEN concat_ws(' ', ?TableAlias.company, ?TableAlias.biography) END)"
+
+// headlineOptions marks matches with control characters, highlight escapes the text before turning them into tags
+const headlineOptions = "StartSel=\x02, StopSel=\x03, MaxWords=20, MinWords=5, MaxFragments=2, FragmentDelimiter=\" ... \""
+
+var snippetMarkers = strings.NewReplacer("\x02", "<b>", "\x03", "</b>")
+
+// highlight HTML escaped snippet with matches wrapped in <b></b>
+func highlight(snippet string) string {
+	return snippetMarkers.Replace(html.EscapeString(snippet))
+}
+
+// Create inserts the profile with its primary address, wraps validation.ErrInvalid when it or its metadata
+// breaks its rules
+func (p *ProfileRepo) Create(ctx context.Context, profile *model.Profile) error {
+	ctx, err := resolve(p.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err = p.validate(ctx, profile); err != nil {
+		return err
+	}
+
+	err = p.datasource.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(profile).Exec(ctx); err != nil {
+			return err
+		}
+		return syncPrimaryEmail(ctx, tx, profile)
+	})
+
+	return common.TranslateError(ctx, err, profileUniqueFields)
+}
+
+// Update stores the profile and its primary address when its version is still current, wraps
+// common.ErrConcurrentModification otherwise and validation.ErrInvalid when it or its metadata breaks its rules
+func (p *ProfileRepo) Update(ctx context.Context, profile *model.Profile) error {
+	ctx, err := resolve(p.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err = p.validate(ctx, profile); err != nil {
+		return err
+	}
+
+	err = p.datasource.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return updateProfile(ctx, tx, profile)
+	})
+
+	return common.TranslateError(ctx, err, profileUniqueFields)
+}
+
+// Delete soft deletes the profile together with its attachments
+func (p *ProfileRepo) Delete(ctx context.Context, uuid uuid.UUID) error {
+	ctx, err := resolve(p.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return p.datasource.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var profile = &model.Profile{}
+		profile.ID = uuid
+
+		res, err := tx.NewDelete().Model(profile).WherePK().Exec(ctx)
+
+		if err != nil {
+			return common.TranslateError(ctx, err, profileUniqueFields)
+		}
+
+		if err = checkAffected(res); err != nil {
+			return err
+		}
+
+		// the shared deletion time lets Restore bring back exactly these attachments
+		_, err = tx.NewUpdate().Model((*model.Attachment)(nil)).
+			Set("deleted_at = ?", profile.DeletedAt).
+			Where("?TableAlias.user_id = ?", uuid).
+			Exec(ctx)
+
+		return common.TranslateError(ctx, err, nil)
+	})
+}
+
+// Restore undeletes the profile and the attachments deleted with it
+func (p *ProfileRepo) Restore(ctx context.Context, uuid uuid.UUID) error {
+	ctx, err := resolve(p.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return p.datasource.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		deletedAt := tx.NewSelect().Model((*model.Profile)(nil)).
+			Column("deleted_at").
+			Where("?TableAlias.id = ?", uuid).
+			WhereDeleted()
+
+		_, err := tx.NewUpdate().Model((*model.Attachment)(nil)).
+			Set("deleted_at = NULL").
+			Where("?TableAlias.user_id = ?", uuid).
+			Where("deleted_at = (?)", deletedAt). // ?TableAlias would resolve to the subquery alias
+			WhereDeleted().
+			Exec(ctx)
+
+		if err != nil {
+			return common.TranslateError(ctx, err, nil)
+		}
+
+		var profile = &model.Profile{}
+		profile.ID = uuid
+
+		res, err := tx.NewUpdate().Model(profile).
+			Column("deleted_at").
+			WherePK().
+			WhereDeleted().
+			Exec(ctx)
+
+		if err != nil {
+			return common.TranslateError(ctx, err, profileUniqueFields)
+		}
+
+		return checkAffected(res)
+	})
+}
+
+// Purge hard deletes profiles deleted before the time, with all their attachments, and returns the S3Keys
+// of the attachment objects and the avatars of the profiles
+func (p *ProfileRepo) Purge(ctx context.Context, before time.Time) (*common.Purged, error) {
+	ctx, err := resolve(p.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var purged = &common.Purged{}
+
+	err = p.datasource.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		expired := tx.NewSelect().Model((*model.Profile)(nil)).
+			Column("id").
+			Where("?TableAlias.deleted_at < ?", before).
+			WhereDeleted()
+
+		err := tx.NewDelete().Model((*model.Attachment)(nil)).
+			Where("user_id IN (?)", expired). // ?TableAlias would resolve to the subquery alias
+			ForceDelete().
+			Returning("s3_key").
+			Scan(ctx, &purged.Blobs)
+
+		if err != nil {
+			return err
+		}
+
+		var ids, avatars []uuid.UUID
+
+		err = tx.NewDelete().Model((*model.Profile)(nil)).
+			Where("?TableAlias.deleted_at < ?", before).
+			ForceDelete().
+			Returning("id, avatar").
+			Scan(ctx, &ids, &avatars)
+
+		purged.Count = int64(len(ids))
+
+		for _, avatar := range avatars {
+			if avatar != uuid.Nil {
+				purged.Avatars = append(purged.Avatars, avatar)
+			}
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return purged, nil
+}
 
-	err := p.datasource.Db.NewSelect().Model(&profile).Where("id = ?", uuid).Scan(p.datasource.Context)
+// findOne profile matching the query, apply may load relations
+func (p *ProfileRepo) findOne(ctx context.Context, apply common.Filter, query string, args ...any) (*model.Profile, error) {
+	ctx, err := resolve(p.datasource, ctx)
 
 	if err != nil {
 		return nil, err
 	}
 
+	var profile = model.Profile{}
+
+	err = p.datasource.IDB(ctx).NewSelect().Model(&profile).Where(query, args...).Apply(apply).Scan(ctx)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, profileUniqueFields)
+	}
+
 	return &profile, nil
 }
+
+// withEmails loads the addresses of the profile
+func withEmails(query *bun.SelectQuery) *bun.SelectQuery {
+	return query.Relation("Emails", orderEmails)
+}
+
+// updateProfile updateVersioned and syncPrimaryEmail in the transaction, the version is kept when either fails
+func updateProfile(ctx context.Context, tx bun.Tx, profile *model.Profile) error {
+	var expected = profile.Version
+
+	err := updateVersioned[model.Profile](ctx, tx, profile)
+
+	if err == nil {
+		err = syncPrimaryEmail(ctx, tx, profile)
+	}
+
+	if err != nil {
+		profile.SetVersion(expected)
+	}
+
+	return err
+}
+
+// validate checks the rules of the profile, then its metadata against the registered schemas
+func (p *ProfileRepo) validate(ctx context.Context, profile *model.Profile) error {
+	if err := validation.Validate(profile); err != nil {
+		return err
+	}
+	return checkMetadata(ctx, p.datasource.IDB(ctx), profile.Metadata)
+}
+
+// resolve validates the datasource and falls back to its context when ctx is nil
+func resolve(ds *datasource.Datasource, ctx context.Context) (context.Context, error) {
+	if ds == nil || ds.Db == nil {
+		return nil, common.ErrNilDatasource
+	}
+	return ds.ResolveContext(ctx), nil
+}
+
+// findPage selects a LIMIT/OFFSET page and counts all rows matching the filter
+func findPage[T any](ctx context.Context, idb bun.IDB, filter common.Filter, page uint, pageSize uint) (*viewCommon.Paged[*T], error) {
+	var pageable = viewCommon.Pagination{Page: page, PageSize: pageSize}
+	var entities = make([]*T, 0, pageSize)
+
+	query := idb.NewSelect().Model(&entities)
+
+	if filter != nil {
+		query = filter(query)
+	}
+
+	query = query.
+		OrderExpr("?TableAlias.created ASC, ?TableAlias.id ASC").
+		Limit(int(pageSize)).
+		Offset(pageable.Offset())
+
+	if err := query.Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	// Count reuses the query, ScanAndCount clones it and the clone loses WhereDeleted
+	total, err := query.Count(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pageable.Total = uint64(total)
+
+	return viewCommon.NewPaged(entities, pageable), nil
+}
+
+// findKeyset selects up to limit rows after, or before, the (created, id) cursor position
+func findKeyset[T any, PT interface {
+	*T
+	interfaces.Timestamped
+}](ctx context.Context, idb bun.IDB, filter common.Filter, cursor *viewCommon.Cursor, limit uint) (*common.KeysetPage[PT], error) {
+	var entities = make([]PT, 0, limit+1)
+	var backward = cursor != nil && cursor.Backward
+
+	query := idb.NewSelect().Model(&entities)
+
+	if filter != nil {
+		query = filter(query)
+	}
+
+	switch {
+	case cursor == nil:
+	case backward:
+		query = query.Where("(?TableAlias.created, ?TableAlias.id) < (?, ?)", cursor.Created, cursor.ID)
+	default:
+		query = query.Where("(?TableAlias.created, ?TableAlias.id) > (?, ?)", cursor.Created, cursor.ID)
+	}
+
+	if backward {
+		query = query.OrderExpr("?TableAlias.created DESC, ?TableAlias.id DESC")
+	} else {
+		query = query.OrderExpr("?TableAlias.created ASC, ?TableAlias.id ASC")
+	}
+
+	// one extra row tells whether the listing continues
+	if err := query.Limit(int(limit) + 1).Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	var more = uint(len(entities)) > limit
+
+	if more {
+		entities = entities[:limit]
+	}
+
+	if backward {
+		slices.Reverse(entities)
+	}
+
+	var page = &common.KeysetPage[PT]{Entities: entities}
+
+	if len(entities) == 0 {
+		return page, nil
+	}
+
+	first := &viewCommon.Cursor{Created: entities[0].GetCreated(), ID: entities[0].GetId(), Backward: true}
+	last := &viewCommon.Cursor{Created: entities[len(entities)-1].GetCreated(), ID: entities[len(entities)-1].GetId()}
+
+	if more || backward {
+		page.Next = last
+	}
+
+	if (more && backward) || (cursor != nil && !backward) {
+		page.Prev = first
+	}
+
+	return page, nil
+}
+
+// updateVersioned updates the entity conditioned on its version, the BeforeAppendModel hook of
+// common.Modifiable increments the version, deleted_at of common.SoftDeletable entities is kept.
+// A failed update keeps the version the caller expected.
+func updateVersioned[T any, PT interface {
+	*T
+	interfaces.Versioned
+}](ctx context.Context, idb bun.IDB, entity PT) error {
+	var expected = entity.GetVersion()
+	var excluded = []string{"created"}
+
+	if _, ok := any(entity).(interface{ IsDeleted() bool }); ok {
+		excluded = append(excluded, "deleted_at")
+	}
+
+	res, err := idb.NewUpdate().
+		Model(entity).
+		ExcludeColumn(excluded...).
+		WherePK().
+		Where("?TableAlias.version = ?", expected).
+		Exec(ctx)
+
+	if err == nil {
+		err = checkAffected(res)
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	entity.SetVersion(expected)
+
+	if !errors.Is(err, common.ErrNotFound) {
+		return err
+	}
+
+	exists, err := idb.NewSelect().Model((PT)(nil)).Where("?TableAlias.id = ?", entity.GetId()).Exists(ctx)
+
+	switch {
+	case err != nil:
+		return err
+	case exists:
+		return common.ErrConcurrentModification
+	default:
+		return common.ErrNotFound
+	}
+}
+
+// deleted selects soft deleted rows only
+func deleted(filter common.Filter) common.Filter {
+	return func(query *bun.SelectQuery) *bun.SelectQuery {
+		query = query.WhereDeleted()
+
+		if filter != nil {
+			query = filter(query)
+		}
+
+		return query
+	}
+}
+
+// checkAffected reports ErrNotFound when a statement did not touch any row
+func checkAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return common.ErrNotFound
+	}
+
+	return nil
+}
@@ -2,19 +2,22 @@ package repository
 
 import (
 	"cabinet/src/main/datasource"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/validation"
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/uptrace/bun"
-	"github.com/uptrace/bun/dialect/pgdialect"
-	"github.com/uptrace/bun/extra/bundebug"
 )
 
 var dataSource *datasource.Datasource
@@ -25,21 +28,30 @@ var testMock sqlmock.Sqlmock
 
 var findReqFormat = "SELECT \"profile\".\"id\", \"profile\".\"created\"," +
 	" \"profile\".\"changed\"," +
+	" \"profile\".\"version\"," +
+	" \"profile\".\"deleted_at\"," +
 	" \"profile\".\"login\"," +
 	" \"profile\".\"fist_name\"," +
 	" \"profile\".\"middle_name\"," +
 	" \"profile\".\"last_name\"," +
 	" \"profile\".\"private\"," +
 	" \"profile\".\"primary_email\"," +
-	" \"profile\".\"email\"," +
+	" \"profile\".\"email_verified\"," +
 	" \"profile\".\"phone\"," +
+	" \"profile\".\"phone_e164\"," +
+	" \"profile\".\"phone_verified\"," +
 	" \"profile\".\"tags\"," +
 	" \"profile\".\"biography\"," +
 	" \"profile\".\"company\"," +
 	" \"profile\".\"location\"," +
 	" \"profile\".\"external_id\"," +
 	" \"profile\".\"avatar\"," +
-	" \"profile\".\"metadata\" FROM \"users\".\"profiles\" AS \"profile\" WHERE (id = '%s')"
+	" \"profile\".\"metadata\", \"profile\".\"identity_sync\" FROM \"users\".\"profiles\" AS \"profile\" WHERE (%s = '%s') AND \"profile\".\"deleted_at\" IS NULL"
+
+var listEmailsReqFormat = "SELECT \"profile_email\".\"id\", \"profile_email\".\"created\", \"profile_email\".\"profile_id\"," +
+	" \"profile_email\".\"email\", \"profile_email\".\"verified\", \"profile_email\".\"is_primary\"" +
+	" FROM \"users\".\"profile_emails\" AS \"profile_email\" WHERE (\"profile_email\".\"profile_id\" IN ('%s'))" +
+	" ORDER BY \"profile_email\".is_primary DESC, \"profile_email\".created ASC, \"profile_email\".id ASC"
 
 func TestMain(m *testing.M) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
@@ -54,13 +66,10 @@ func TestMain(m *testing.M) {
 
 	defer db.Close()
 
-	var bunDb = bun.NewDB(db, pgdialect.New())
-
-	bunDb.AddQueryHook(bundebug.NewQueryHook(
-		bundebug.WithVerbose(true),
-	))
+	var cfg = datasource.DefaultConfig()
+	cfg.Debug = true
 
-	dataSource = &datasource.Datasource{Db: bunDb, Context: context.Background()}
+	dataSource = datasource.NewFromDB(context.Background(), db, cfg)
 
 	m.Run()
 }
@@ -69,30 +78,512 @@ func TestFindProfileById(t *testing.T) {
 	var rows = testMock.NewRows([]string{"id", "biography"})
 	rows.AddRow(profileTestId1, profileBio)
 
-	testMock.ExpectQuery(fmt.Sprintf(findReqFormat, profileTestId1)).WillReturnRows(rows)
-	testMock.ExpectQuery(fmt.Sprintf(findReqFormat, profileTestId2)).WillReturnRows(testMock.NewRows([]string{"id"}))
+	testMock.ExpectQuery(fmt.Sprintf(findReqFormat, "id", profileTestId1)).WillReturnRows(rows)
+	testMock.ExpectQuery(fmt.Sprintf(listEmailsReqFormat, profileTestId1)).
+		WillReturnRows(testMock.NewRows([]string{"id", "profile_id", "email", "is_primary"}).AddRow(uuid.New(), profileTestId1, "john@smith.com", true))
+	testMock.ExpectQuery(fmt.Sprintf(findReqFormat, "id", profileTestId2)).WillReturnRows(testMock.NewRows([]string{"id"}))
 
 	var profileRepo = &ProfileRepo{datasource: nil}
 
-	var profile, err = profileRepo.FindById(profileTestId1)
+	var profile, err = profileRepo.FindById(context.Background(), profileTestId1)
 	assert.Nil(t, profile)
 	assert.Error(t, err)
 	slog.Error("An error was not expected when finding profile", slog.Any("err", err.Error()))
 
 	profileRepo = &ProfileRepo{datasource: dataSource}
 
-	profile, err = profileRepo.FindById(profileTestId1)
+	profile, err = profileRepo.FindById(context.Background(), profileTestId1)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, profile)
 	assert.Equal(t, profileTestId1, profile.ID)
 	assert.Equal(t, profileBio, profile.Biography)
+	assert.Len(t, profile.Emails, 1)
+	assert.True(t, profile.Emails[0].Primary)
 
-	profile, err = profileRepo.FindById(profileTestId2)
+	profile, err = profileRepo.FindById(context.Background(), profileTestId2)
 	assert.Nil(t, profile)
 	assert.Error(t, err)
-	assert.True(t, errors.Is(err, sql.ErrNoRows))
+	assert.True(t, errors.Is(err, common.ErrNotFound))
 	slog.Error("An error was not expected when finding profile", slog.Any("err", err.Error()))
 
 	slog.Info("TestFindProfileById is successful")
 }
+
+func TestFindProfileByUniqueKeys(t *testing.T) {
+	var externalId = uuid.New()
+
+	testMock.ExpectQuery(fmt.Sprintf(findReqFormat, "login", "login1")).
+		WillReturnRows(testMock.NewRows([]string{"id", "login"}).AddRow(profileTestId1, "login1"))
+	testMock.ExpectQuery(fmt.Sprintf(findReqFormat, "primary_email", "john@smith.com")).
+		WillReturnRows(testMock.NewRows([]string{"id", "primary_email"}).AddRow(profileTestId1, "john@smith.com"))
+	testMock.ExpectQuery(fmt.Sprintf(findReqFormat, "external_id", externalId)).
+		WillReturnRows(testMock.NewRows([]string{"id"}))
+
+	var profileRepo = NewProfileRepo(dataSource)
+
+	profile, err := profileRepo.FindByLogin(context.Background(), "login1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, profileTestId1, profile.ID)
+	assert.Equal(t, "login1", profile.Login)
+
+	profile, err = profileRepo.FindByPrimaryEmail(context.Background(), "john@smith.com")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "john@smith.com", profile.PrimaryEmail)
+
+	profile, err = profileRepo.FindByExternalID(context.Background(), externalId)
+
+	assert.Nil(t, profile)
+	assert.True(t, errors.Is(err, common.ErrNotFound))
+
+	assert.NoError(t, testMock.ExpectationsWereMet())
+
+	slog.Info("TestFindProfileByUniqueKeys is successful")
+}
+
+func TestCreateProfile(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "users"."profiles"`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId1))
+	expectPrimaryEmailSync(mock, "john@smith.com", false)
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "users"."profiles"`).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "profiles_login_key"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "users"."profiles"`).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "profiles_primary_email_key"})
+	mock.ExpectRollback()
+
+	// another profile verified the address
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "users"."profiles"`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId2))
+	expectPrimaryEmailTaken(mock, "john@smith.com")
+	mock.ExpectRollback()
+
+	var profileRepo = NewProfileRepo(ds)
+	var profile = &model.Profile{Login: "login1", PrimaryEmail: "john@smith.com"}
+
+	err := profileRepo.Create(context.Background(), profile)
+
+	assert.NoError(t, err)
+	assert.Equal(t, profileTestId1, profile.ID)
+	assert.False(t, profile.Created.IsZero())
+
+	var uniqueErr *common.UniqueViolationError
+
+	err = profileRepo.Create(context.Background(), profile)
+
+	assert.True(t, errors.Is(err, common.ErrUniqueViolation))
+	assert.True(t, errors.As(err, &uniqueErr))
+	assert.Equal(t, "Login", uniqueErr.Field)
+
+	err = profileRepo.Create(context.Background(), profile)
+
+	assert.True(t, errors.As(err, &uniqueErr))
+	assert.Equal(t, "PrimaryEmail", uniqueErr.Field)
+
+	err = profileRepo.Create(context.Background(), profile)
+
+	assert.True(t, errors.As(err, &uniqueErr))
+	assert.Equal(t, "PrimaryEmail", uniqueErr.Field)
+	assert.Equal(t, "profile_emails_email_key", uniqueErr.Constraint)
+
+	// invalid profiles never reach the database
+	var violations validation.Errors
+
+	err = profileRepo.Create(context.Background(), &model.Profile{PrimaryEmail: "john"})
+
+	assert.True(t, errors.Is(err, validation.ErrInvalid))
+	assert.True(t, errors.As(err, &violations))
+	assert.Equal(t, []string{"login: required", "primary_email: email"}, violations.Details())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestCreateProfile is successful")
+}
+
+func TestUpdateProfile(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users"."profiles" AS "profile" SET .*"version" = 4, .* WHERE \("profile".version = 3\) AND "profile"."deleted_at" IS NULL AND \("profile"."id" = '` + profileTestId1.String() + `'\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectPrimaryEmailSync(mock, "john@smith.com", false)
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users"."profiles" .* WHERE \("profile".version = 4\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT .* FROM "users"."profiles" AS "profile" WHERE \("profile".id = '` + profileTestId1.String() + `'\) AND "profile"."deleted_at" IS NULL\)`).
+		WillReturnRows(mock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users"."profiles"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WillReturnRows(mock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users"."profiles"`).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "profiles_primary_email_key"})
+	mock.ExpectRollback()
+
+	// another profile verified the address, the version is kept
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users"."profiles"`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectPrimaryEmailTaken(mock, "john@smith.com")
+	mock.ExpectRollback()
+
+	var profileRepo = NewProfileRepo(ds)
+	var profile = &model.Profile{Login: "login1", PrimaryEmail: "john@smith.com"}
+	profile.ID = profileTestId1
+	profile.Version = 3
+
+	assert.NoError(t, profileRepo.Update(context.Background(), profile))
+	assert.False(t, profile.Changed.IsZero())
+	assert.Equal(t, int64(4), profile.Version)
+
+	assert.True(t, errors.Is(profileRepo.Update(context.Background(), profile), common.ErrConcurrentModification))
+	assert.Equal(t, int64(4), profile.Version)
+
+	assert.True(t, errors.Is(profileRepo.Update(context.Background(), profile), common.ErrNotFound))
+
+	var uniqueErr *common.UniqueViolationError
+
+	assert.True(t, errors.As(profileRepo.Update(context.Background(), profile), &uniqueErr))
+	assert.Equal(t, "PrimaryEmail", uniqueErr.Field)
+	assert.Equal(t, int64(4), profile.Version)
+
+	assert.True(t, errors.As(profileRepo.Update(context.Background(), profile), &uniqueErr))
+	assert.Equal(t, "profile_emails_email_key", uniqueErr.Constraint)
+	assert.Equal(t, int64(4), profile.Version)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestUpdateProfile is successful")
+}
+
+func TestDeleteProfile(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users"."profiles" AS "profile" SET "deleted_at" = '(.*)' WHERE "profile"."deleted_at" IS NULL AND \("profile"."id" = '` + profileTestId1.String() + `'\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "users"."attachments" AS "attachment" SET deleted_at = '.*' WHERE \("attachment".user_id = '` + profileTestId1.String() + `'\) AND "attachment"."deleted_at" IS NULL`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users"."profiles"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	var profileRepo = NewProfileRepo(ds)
+
+	assert.NoError(t, profileRepo.Delete(context.Background(), profileTestId1))
+	assert.True(t, errors.Is(profileRepo.Delete(context.Background(), profileTestId2), common.ErrNotFound))
+
+	assert.True(t, errors.Is(NewProfileRepo(nil).Delete(context.Background(), profileTestId1), common.ErrNilDatasource))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestDeleteProfile is successful")
+}
+
+func TestRestoreProfile(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users"."attachments" AS "attachment" SET deleted_at = NULL WHERE \("attachment".user_id = '` + profileTestId1.String() + `'\)` +
+		` AND \(deleted_at = \(SELECT "profile"."deleted_at" FROM "users"."profiles" AS "profile" WHERE \("profile".id = '` + profileTestId1.String() + `'\) AND "profile"."deleted_at" IS NOT NULL\)\)` +
+		` AND "attachment"."deleted_at" IS NOT NULL`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE "users"."profiles" AS "profile" SET "deleted_at" = NULL WHERE "profile"."deleted_at" IS NOT NULL AND \("profile"."id" = '` + profileTestId1.String() + `'\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users"."attachments"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE "users"."profiles"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	var profileRepo = NewProfileRepo(ds)
+
+	assert.NoError(t, profileRepo.Restore(context.Background(), profileTestId1))
+	assert.True(t, errors.Is(profileRepo.Restore(context.Background(), profileTestId2), common.ErrNotFound))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestRestoreProfile is successful")
+}
+
+func TestFindDeletedAndPurgeProfiles(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var before = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var s3Key, avatar = uuid.New(), uuid.New()
+
+	mock.ExpectQuery(`FROM "users"."profiles" AS "profile" WHERE "profile"."deleted_at" IS NOT NULL ORDER BY`).
+		WillReturnRows(mock.NewRows([]string{"id", "deleted_at"}).AddRow(profileTestId1, before))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users"."profiles" AS "profile" WHERE "profile"."deleted_at" IS NOT NULL`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`DELETE FROM "users"."attachments" AS "attachment" WHERE \(user_id IN \(SELECT "profile"."id" FROM "users"."profiles" AS "profile"` +
+		` WHERE \("profile".deleted_at < '2025-01-01 00:00:00\+00:00'\) AND "profile"."deleted_at" IS NOT NULL\)\) RETURNING s3_key$`).
+		WillReturnRows(mock.NewRows([]string{"s3_key"}).AddRow(s3Key))
+	mock.ExpectQuery(`DELETE FROM "users"."profiles" AS "profile" WHERE \("profile".deleted_at < '2025-01-01 00:00:00\+00:00'\) RETURNING id, avatar$`).
+		WillReturnRows(mock.NewRows([]string{"id", "avatar"}).AddRow(profileTestId1, avatar).AddRow(profileTestId2, nil))
+	mock.ExpectCommit()
+
+	var profileRepo = NewProfileRepo(ds)
+
+	paged, err := profileRepo.FindDeleted(context.Background(), nil, 0, 10)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(paged.Entities))
+	assert.True(t, paged.Entities[0].IsDeleted())
+	assert.Equal(t, uint64(1), paged.Pageable.Total)
+
+	purged, err := profileRepo.Purge(context.Background(), before)
+
+	assert.NoError(t, err)
+	// the objects of the purged attachments and avatars are left to the caller
+	assert.Equal(t, &common.Purged{Count: 2, Blobs: []uuid.UUID{s3Key}, Avatars: []uuid.UUID{avatar}}, purged)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestFindDeletedAndPurgeProfiles is successful")
+}
+
+func newRegexpDatasource(t *testing.T) (*datasource.Datasource, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+
+	if err != nil {
+		t.Fatalf("An error was not expected when opening a stub database connection: %s", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	return datasource.NewFromDB(context.Background(), db, datasource.DefaultConfig()), mock
+}
+
+func TestProfileRepoContextCancellation(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	mock.ExpectQuery(`FROM "users"."profiles"`).
+		WillDelayFor(time.Second).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId1))
+	mock.ExpectQuery(`FROM "users"."profiles"`).
+		WillDelayFor(time.Second).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId1))
+	mock.ExpectQuery(`FROM "users"."profiles"`).
+		WillDelayFor(time.Second).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId1))
+
+	var profileRepo = NewProfileRepo(ds)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var started = time.Now()
+	profile, err := profileRepo.FindById(ctx, profileTestId1)
+
+	assert.Nil(t, profile)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, time.Since(started), time.Second)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	profile, err = profileRepo.FindByLogin(ctx, "login1")
+
+	assert.Nil(t, profile)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	// nil context falls back to the datasource context
+	background, stop := context.WithCancel(context.Background())
+	ds.Context = background
+	stop()
+
+	//nolint:staticcheck // background job fallback
+	profile, err = profileRepo.FindById(nil, profileTestId1)
+
+	assert.Nil(t, profile)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	slog.Info("TestProfileRepoContextCancellation is successful")
+}
+
+func TestFindProfilePage(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+	mock.MatchExpectationsInOrder(false)
+
+	mock.ExpectQuery(`FROM "users"."profiles" AS "profile" WHERE \(company = 'Acme'\) AND "profile"."deleted_at" IS NULL ORDER BY "profile".created ASC, "profile".id ASC LIMIT 2 OFFSET 2`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId1))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users"."profiles" AS "profile" WHERE \(company = 'Acme'\) AND "profile"."deleted_at" IS NULL`).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(3))
+
+	var filter = func(query *bun.SelectQuery) *bun.SelectQuery {
+		return query.Where("company = ?", "Acme")
+	}
+
+	paged, err := NewProfileRepo(ds).FindPage(context.Background(), filter, 1, 2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(paged.Entities))
+	assert.Equal(t, profileTestId1, paged.Entities[0].ID)
+	assert.Equal(t, uint64(3), paged.Pageable.Total)
+	assert.Equal(t, uint(1), paged.Pageable.Page)
+	assert.Equal(t, uint(2), paged.Pageable.PageSize)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestFindProfilePage is successful")
+}
+
+func TestFindProfileBySpec(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+	mock.MatchExpectationsInOrder(false)
+
+	var where = `WHERE \("profile"."company" = 'Acme'\) AND \("profile"."tags" @> '\{"go","sql"\}'\)` +
+		` AND \("profile"."created" >= '2025-01-01 00:00:00\+00:00'\) AND \("profile"."private" = FALSE\)` +
+		` AND \("profile"."metadata" #>> '\{"team","name"\}' IN \('core', 'infra'\)\)` +
+		` AND \("profile"."metadata" @> '\{"billing":\{"plan":"pro"\}\}'::jsonb\)` +
+		` AND \("profile"."metadata" #> '\{"team","roles"\}' @> '\["lead"\]'::jsonb\) AND "profile"."deleted_at" IS NULL`
+
+	mock.ExpectQuery(`FROM "users"."profiles" AS "profile" ` + where +
+		` ORDER BY "profile"."changed" DESC, "profile"."login" ASC, "profile".created ASC, "profile".id ASC LIMIT 10`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId1))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users"."profiles" AS "profile" ` + where).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+
+	values, _ := url.ParseQuery("filter=company:eq:Acme&filter=tags:contains:go,sql&filter=created:gte:2025-01-01" +
+		"&filter=private:eq:false&filter=metadata.team.name:in:core,infra" +
+		`&filter=metadata:contains:{"billing":{"plan":"pro"}}&filter=metadata.team.roles:contains:["lead"]&sort=-changed,login`)
+
+	spec, err := common.ParseSpec(values)
+
+	assert.NoError(t, err)
+
+	var repo = NewProfileRepo(ds)
+	filter, err := repo.Filter(spec)
+
+	assert.NoError(t, err)
+
+	paged, err := repo.FindPage(context.Background(), filter, 0, 10)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(paged.Entities))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	for _, invalid := range []common.Spec{
+		{Conditions: []common.Condition{{Field: "phone", Op: common.OpEq, Value: "1"}}},
+		{Conditions: []common.Condition{{Field: "tags", Op: common.OpEq, Value: "go"}}},
+		{Conditions: []common.Condition{{Field: "metadata", Op: common.OpEq, Value: "x"}}},
+		{Conditions: []common.Condition{{Field: "metadata", Op: common.OpContains, Value: "notjson"}}},
+		{Conditions: []common.Condition{{Field: "tags.x", Op: common.OpContains, Value: "go"}}},
+		{Conditions: []common.Condition{{Field: "changed", Op: common.OpLt, Value: "soon"}}},
+		{Orders: []common.Order{{Field: "metadata"}}},
+	} {
+		_, err = repo.Filter(&invalid)
+		assert.ErrorIs(t, err, common.ErrInvalidSpec)
+	}
+
+	_, err = common.ParseSpec(url.Values{"filter": {"company:eq"}})
+	assert.ErrorIs(t, err, common.ErrInvalidSpec)
+
+	slog.Info("TestFindProfileBySpec is successful")
+}
+
+func TestSearchProfiles(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+	mock.MatchExpectationsInOrder(false)
+
+	var where = `WHERE \("profile".search_vector @@ websearch_to_tsquery\('simple', 'O''Neil'\) OR "profile".login % 'O''Neil'\) AND "profile"."deleted_at" IS NULL`
+
+	mock.ExpectQuery(`ts_rank\("profile".search_vector, websearch_to_tsquery\('simple', 'O''Neil'\)\) \+ similarity\("profile".login, 'O''Neil'\) AS rank, ` +
+		`ts_headline\('simple', concat_ws\(.*CASE WHEN "profile".private IS FALSE .*\) AS snippet ` +
+		`FROM "users"."profiles" AS "profile" ` + where + ` ORDER BY rank DESC, "profile".created ASC, "profile".id ASC LIMIT 10`).
+		WillReturnRows(mock.NewRows([]string{"id", "login", "rank", "snippet"}).
+			AddRow(profileTestId1, "oneil", 0.75, "Pat \x02O'Neil\x03 <script>"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users"."profiles" AS "profile" ` + where).
+		WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+
+	var repo = NewProfileRepo(ds)
+
+	paged, err := repo.Search(context.Background(), " O'Neil ", 0, 10)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(paged.Entities))
+	assert.Equal(t, profileTestId1, paged.Entities[0].ID)
+	assert.Equal(t, 0.75, paged.Entities[0].Rank)
+	assert.Equal(t, "Pat <b>O&#39;Neil</b> &lt;script&gt;", paged.Entities[0].Snippet)
+	assert.Equal(t, uint64(1), paged.Pageable.Total)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	paged, err = repo.Search(context.Background(), "  ", 0, 10)
+
+	assert.NoError(t, err)
+	assert.Empty(t, paged.Entities)
+
+	slog.Info("TestSearchProfiles is successful")
+}
+
+func TestFindProfileKeyset(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var created = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	var ids = []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	var columns = []string{"id", "created"}
+
+	mock.ExpectQuery(`FROM "users"."profiles" AS "profile" WHERE "profile"."deleted_at" IS NULL ORDER BY "profile".created ASC, "profile".id ASC LIMIT 3`).
+		WillReturnRows(mock.NewRows(columns).
+			AddRow(ids[0], created).
+			AddRow(ids[1], created.Add(time.Second)).
+			AddRow(ids[2], created.Add(2*time.Second)))
+
+	var profileRepo = NewProfileRepo(ds)
+
+	page, err := profileRepo.FindKeyset(context.Background(), nil, nil, 2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(page.Entities))
+	assert.Nil(t, page.Prev)
+	assert.Equal(t, ids[1], page.Next.ID)
+	assert.False(t, page.Next.Backward)
+
+	mock.ExpectQuery(`WHERE \(\("profile".created, "profile".id\) > \('2025-01-02 03:04:06\+00:00', '` + ids[1].String() + `'\)\) AND "profile"."deleted_at" IS NULL ORDER BY "profile".created ASC, "profile".id ASC LIMIT 3`).
+		WillReturnRows(mock.NewRows(columns).AddRow(ids[2], created.Add(2*time.Second)))
+
+	page, err = profileRepo.FindKeyset(context.Background(), nil, page.Next, 2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(page.Entities))
+	assert.Nil(t, page.Next)
+	assert.Equal(t, ids[2], page.Prev.ID)
+	assert.True(t, page.Prev.Backward)
+
+	mock.ExpectQuery(`WHERE \(\("profile".created, "profile".id\) < \('2025-01-02 03:04:07\+00:00', '` + ids[2].String() + `'\)\) AND "profile"."deleted_at" IS NULL ORDER BY "profile".created DESC, "profile".id DESC LIMIT 3`).
+		WillReturnRows(mock.NewRows(columns).
+			AddRow(ids[1], created.Add(time.Second)).
+			AddRow(ids[0], created))
+
+	page, err = profileRepo.FindKeyset(context.Background(), nil, page.Prev, 2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{ids[0], ids[1]}, []uuid.UUID{page.Entities[0].ID, page.Entities[1].ID})
+	assert.Nil(t, page.Prev)
+	assert.Equal(t, ids[1], page.Next.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestFindProfileKeyset is successful")
+}
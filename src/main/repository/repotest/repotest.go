@@ -0,0 +1,486 @@
+// Package repotest fake repositories for tests of services and controllers. The fakes record their calls
+// and return canned values, they enforce none of the rules of the repositories, see the sqlmock tests of
+// package repository for those.
+package repotest
+
+import (
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/repository/common"
+	viewCommon "cabinet/src/main/view/common"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Call of a fake method, entities are recorded as copies of their value when called
+type Call struct {
+	Method string
+	Args   []any
+}
+
+// Recorder calls of a fake and the errors queued for them, safe for the requests of a test server
+type Recorder struct {
+	mu     sync.Mutex
+	calls  []Call
+	errors map[string][]error
+}
+
+// Fail queues errors returned by the next calls of the method, one per call
+func (r *Recorder) Fail(method string, errs ...error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.errors == nil {
+		r.errors = map[string][]error{}
+	}
+
+	r.errors[method] = append(r.errors[method], errs...)
+}
+
+// Calls of the method in order
+func (r *Recorder) Calls(method string) []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var calls []Call
+
+	for _, call := range r.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Last arguments of the method, nil when it was not called
+func (r *Recorder) Last(method string) []any {
+	var calls = r.Calls(method)
+
+	if len(calls) == 0 {
+		return nil
+	}
+
+	return calls[len(calls)-1].Args
+}
+
+// record the call, returns the error queued for it
+func (r *Recorder) record(method string, args ...any) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+
+	if queued := r.errors[method]; len(queued) > 0 {
+		r.errors[method] = queued[1:]
+		return queued[0]
+	}
+
+	return nil
+}
+
+// find copy of the first entity matching, common.ErrNotFound when none does
+func find[T any](entities []*T, match func(entity *T) bool) (*T, error) {
+	for _, entity := range entities {
+		if match(entity) {
+			var found = *entity
+			return &found, nil
+		}
+	}
+	return nil, common.ErrNotFound
+}
+
+var _ repository.IProfileRepository = (*Profiles)(nil)
+
+// Profiles IProfileRepository finding the canned profiles. Create assigns an id and Update bumps the version
+// like the database does, writes change nothing else.
+type Profiles struct {
+	Recorder
+	Profiles []*model.Profile      // found by id, login, primary email and external id
+	Listed   []*model.Profile      // entities of every page of FindPage, FindKeyset and FindDeleted
+	Next     *viewCommon.Cursor    // next cursor of FindKeyset
+	Matches  []*model.ProfileMatch // entities of every page of Search
+	Purged   common.Purged
+}
+
+func NewProfiles(profiles ...*model.Profile) *Profiles {
+	return &Profiles{Profiles: profiles}
+}
+
+func (f *Profiles) FindById(_ context.Context, id uuid.UUID) (*model.Profile, error) {
+	if err := f.record("FindById", id); err != nil {
+		return nil, err
+	}
+
+	return find(f.Profiles, func(p *model.Profile) bool { return p.ID == id })
+}
+
+func (f *Profiles) FindByLogin(_ context.Context, login string) (*model.Profile, error) {
+	if err := f.record("FindByLogin", login); err != nil {
+		return nil, err
+	}
+
+	return find(f.Profiles, func(p *model.Profile) bool { return p.Login == login })
+}
+
+func (f *Profiles) FindByPrimaryEmail(_ context.Context, email string) (*model.Profile, error) {
+	if err := f.record("FindByPrimaryEmail", email); err != nil {
+		return nil, err
+	}
+
+	return find(f.Profiles, func(p *model.Profile) bool { return p.PrimaryEmail == email })
+}
+
+func (f *Profiles) FindByExternalID(_ context.Context, externalID uuid.UUID) (*model.Profile, error) {
+	if err := f.record("FindByExternalID", externalID); err != nil {
+		return nil, err
+	}
+
+	return find(f.Profiles, func(p *model.Profile) bool { return p.ExternalID == externalID })
+}
+
+// Filter the filter of repository.ProfileColumns
+func (f *Profiles) Filter(spec *common.Spec) (common.Filter, error) {
+	if err := f.record("Filter", spec); err != nil {
+		return nil, err
+	}
+
+	return repository.ProfileColumns.Filter(spec)
+}
+
+func (f *Profiles) FindPage(_ context.Context, filter common.Filter, page uint, pageSize uint) (*viewCommon.Paged[*model.Profile], error) {
+	if err := f.record("FindPage", filter, page, pageSize); err != nil {
+		return nil, err
+	}
+
+	return paged(f.Listed, page, pageSize), nil
+}
+
+func (f *Profiles) FindKeyset(_ context.Context, filter common.Filter, cursor *viewCommon.Cursor, limit uint) (*common.KeysetPage[*model.Profile], error) {
+	if err := f.record("FindKeyset", filter, cursor, limit); err != nil {
+		return nil, err
+	}
+
+	return &common.KeysetPage[*model.Profile]{Entities: f.Listed, Next: f.Next}, nil
+}
+
+func (f *Profiles) FindDeleted(_ context.Context, filter common.Filter, page uint, pageSize uint) (*viewCommon.Paged[*model.Profile], error) {
+	if err := f.record("FindDeleted", filter, page, pageSize); err != nil {
+		return nil, err
+	}
+
+	return paged(f.Listed, page, pageSize), nil
+}
+
+func (f *Profiles) Search(_ context.Context, query string, page uint, pageSize uint) (*viewCommon.Paged[*model.ProfileMatch], error) {
+	if err := f.record("Search", query, page, pageSize); err != nil {
+		return nil, err
+	}
+
+	return paged(f.Matches, page, pageSize), nil
+}
+
+func (f *Profiles) Create(_ context.Context, profile *model.Profile) error {
+	if err := f.record("Create", *profile); err != nil {
+		return err
+	}
+
+	profile.ID = uuid.New()
+	profile.Version = 1
+
+	return nil
+}
+
+func (f *Profiles) Update(_ context.Context, profile *model.Profile) error {
+	if err := f.record("Update", *profile); err != nil {
+		return err
+	}
+
+	profile.Version++
+
+	return nil
+}
+
+func (f *Profiles) Delete(_ context.Context, id uuid.UUID) error {
+	return f.record("Delete", id)
+}
+
+func (f *Profiles) Restore(_ context.Context, id uuid.UUID) error {
+	return f.record("Restore", id)
+}
+
+func (f *Profiles) Purge(_ context.Context, before time.Time) (*common.Purged, error) {
+	if err := f.record("Purge", before); err != nil {
+		return nil, err
+	}
+
+	var purged = f.Purged
+
+	return &purged, nil
+}
+
+// paged every entity as the requested page, the total counts the entities
+func paged[T any](entities []T, page uint, pageSize uint) *viewCommon.Paged[T] {
+	return viewCommon.NewPaged(entities, viewCommon.Pagination{Page: page, PageSize: pageSize, Total: uint64(len(entities))})
+}
+
+var _ repository.IProfileEmailRepository = (*Emails)(nil)
+
+// Emails IProfileEmailRepository finding the canned addresses, Create assigns an id
+type Emails struct {
+	Recorder
+	Emails []*model.ProfileEmail // found by id and address, listed by profile
+}
+
+func NewEmails(emails ...*model.ProfileEmail) *Emails {
+	return &Emails{Emails: emails}
+}
+
+func (f *Emails) FindById(_ context.Context, id uuid.UUID) (*model.ProfileEmail, error) {
+	if err := f.record("FindById", id); err != nil {
+		return nil, err
+	}
+
+	return find(f.Emails, func(e *model.ProfileEmail) bool { return e.ID == id })
+}
+
+func (f *Emails) FindByEmail(_ context.Context, email string) (*model.ProfileEmail, error) {
+	if err := f.record("FindByEmail", email); err != nil {
+		return nil, err
+	}
+
+	return find(f.Emails, func(e *model.ProfileEmail) bool { return e.Email == email })
+}
+
+func (f *Emails) ListByProfileID(_ context.Context, profileID uuid.UUID) ([]*model.ProfileEmail, error) {
+	if err := f.record("ListByProfileID", profileID); err != nil {
+		return nil, err
+	}
+
+	var emails = make([]*model.ProfileEmail, 0)
+
+	for _, email := range f.Emails {
+		if email.ProfileID == profileID {
+			var found = *email
+			emails = append(emails, &found)
+		}
+	}
+
+	return emails, nil
+}
+
+func (f *Emails) Create(_ context.Context, email *model.ProfileEmail) error {
+	if err := f.record("Create", *email); err != nil {
+		return err
+	}
+
+	email.ID = uuid.New()
+
+	return nil
+}
+
+func (f *Emails) Delete(_ context.Context, id uuid.UUID) error {
+	return f.record("Delete", id)
+}
+
+var _ repository.IEmailVerificationRepository = (*EmailVerifications)(nil)
+
+// EmailVerifications IEmailVerificationRepository returning the canned pending verification and confirmed profile
+type EmailVerifications struct {
+	Recorder
+	Pending   *model.EmailVerification // returned by FindPending, nil is common.ErrNotFound
+	Confirmed *model.Profile           // returned by Confirm, nil is common.ErrNotFound
+}
+
+func (f *EmailVerifications) Create(_ context.Context, verification *model.EmailVerification) error {
+	if err := f.record("Create", *verification); err != nil {
+		return err
+	}
+
+	verification.ID = uuid.New()
+
+	return nil
+}
+
+func (f *EmailVerifications) FindPending(_ context.Context, profileID uuid.UUID, at time.Time) (*model.EmailVerification, error) {
+	if err := f.record("FindPending", profileID, at); err != nil {
+		return nil, err
+	}
+
+	return canned(f.Pending)
+}
+
+func (f *EmailVerifications) Confirm(_ context.Context, tokenHash string, at time.Time) (*model.Profile, error) {
+	if err := f.record("Confirm", tokenHash, at); err != nil {
+		return nil, err
+	}
+
+	return canned(f.Confirmed)
+}
+
+var _ repository.IPhoneVerificationRepository = (*PhoneVerifications)(nil)
+
+// PhoneVerifications IPhoneVerificationRepository returning the canned pending verification and confirmed profile
+type PhoneVerifications struct {
+	Recorder
+	Pending   *model.PhoneVerification // returned by FindPending and Attempt, nil is common.ErrNotFound
+	Confirmed *model.Profile           // returned by Confirm, nil is common.ErrNotFound
+}
+
+func (f *PhoneVerifications) Create(_ context.Context, verification *model.PhoneVerification, limits repository.PhoneLimits) error {
+	if err := f.record("Create", *verification, limits); err != nil {
+		return err
+	}
+
+	verification.ID = uuid.New()
+
+	return nil
+}
+
+func (f *PhoneVerifications) FindPending(_ context.Context, profileID uuid.UUID, at time.Time) (*model.PhoneVerification, error) {
+	if err := f.record("FindPending", profileID, at); err != nil {
+		return nil, err
+	}
+
+	return canned(f.Pending)
+}
+
+func (f *PhoneVerifications) Attempt(_ context.Context, id uuid.UUID, at time.Time, maxAttempts int) (*model.PhoneVerification, error) {
+	if err := f.record("Attempt", id, at, maxAttempts); err != nil {
+		return nil, err
+	}
+
+	return canned(f.Pending)
+}
+
+func (f *PhoneVerifications) Confirm(_ context.Context, id uuid.UUID, at time.Time) (*model.Profile, error) {
+	if err := f.record("Confirm", id, at); err != nil {
+		return nil, err
+	}
+
+	return canned(f.Confirmed)
+}
+
+// canned copy of the canned entity, common.ErrNotFound when it is nil
+func canned[T any](entity *T) (*T, error) {
+	if entity == nil {
+		return nil, common.ErrNotFound
+	}
+
+	var found = *entity
+	return &found, nil
+}
+
+var _ repository.IAttachmentRepository = (*Attachments)(nil)
+
+// Attachments IAttachmentRepository finding the canned attachments, Create assigns an id
+type Attachments struct {
+	Recorder
+	Attachments []*model.Attachment // found by id and s3 key, listed by user and by every page
+	Purged      common.Purged
+}
+
+func NewAttachments(attachments ...*model.Attachment) *Attachments {
+	return &Attachments{Attachments: attachments}
+}
+
+func (f *Attachments) FindById(_ context.Context, id uuid.UUID) (*model.Attachment, error) {
+	if err := f.record("FindById", id); err != nil {
+		return nil, err
+	}
+
+	return find(f.Attachments, func(a *model.Attachment) bool { return a.ID == id })
+}
+
+func (f *Attachments) FindByS3Key(_ context.Context, s3Key uuid.UUID, _ ...repository.AttachmentOption) (*model.Attachment, error) {
+	if err := f.record("FindByS3Key", s3Key); err != nil {
+		return nil, err
+	}
+
+	return find(f.Attachments, func(a *model.Attachment) bool { return a.S3Key == s3Key })
+}
+
+func (f *Attachments) ListByUserID(_ context.Context, userID uuid.UUID, includePrivate bool, _ ...repository.AttachmentOption) ([]*model.Attachment, error) {
+	if err := f.record("ListByUserID", userID, includePrivate); err != nil {
+		return nil, err
+	}
+
+	var attachments = make([]*model.Attachment, 0)
+
+	for _, attachment := range f.Attachments {
+		if attachment.UserID == userID {
+			var found = *attachment
+			attachments = append(attachments, &found)
+		}
+	}
+
+	return attachments, nil
+}
+
+// Filter the filter of repository.AttachmentColumns
+func (f *Attachments) Filter(spec *common.Spec) (common.Filter, error) {
+	if err := f.record("Filter", spec); err != nil {
+		return nil, err
+	}
+
+	return repository.AttachmentColumns.Filter(spec)
+}
+
+func (f *Attachments) FindPage(_ context.Context, filter common.Filter, page uint, pageSize uint) (*viewCommon.Paged[*model.Attachment], error) {
+	if err := f.record("FindPage", filter, page, pageSize); err != nil {
+		return nil, err
+	}
+
+	return paged(f.Attachments, page, pageSize), nil
+}
+
+func (f *Attachments) FindKeyset(_ context.Context, filter common.Filter, cursor *viewCommon.Cursor, limit uint) (*common.KeysetPage[*model.Attachment], error) {
+	if err := f.record("FindKeyset", filter, cursor, limit); err != nil {
+		return nil, err
+	}
+
+	return &common.KeysetPage[*model.Attachment]{Entities: f.Attachments}, nil
+}
+
+func (f *Attachments) FindDeleted(_ context.Context, filter common.Filter, page uint, pageSize uint) (*viewCommon.Paged[*model.Attachment], error) {
+	if err := f.record("FindDeleted", filter, page, pageSize); err != nil {
+		return nil, err
+	}
+
+	return paged(f.Attachments, page, pageSize), nil
+}
+
+func (f *Attachments) Create(_ context.Context, attachment *model.Attachment) error {
+	if err := f.record("Create", *attachment); err != nil {
+		return err
+	}
+
+	attachment.ID = uuid.New()
+
+	return nil
+}
+
+func (f *Attachments) Update(_ context.Context, attachment *model.Attachment) error {
+	return f.record("Update", *attachment)
+}
+
+func (f *Attachments) Delete(_ context.Context, id uuid.UUID) error {
+	return f.record("Delete", id)
+}
+
+func (f *Attachments) Restore(_ context.Context, id uuid.UUID) error {
+	return f.record("Restore", id)
+}
+
+func (f *Attachments) Purge(_ context.Context, before time.Time) (*common.Purged, error) {
+	if err := f.record("Purge", before); err != nil {
+		return nil, err
+	}
+
+	var purged = f.Purged
+
+	return &purged, nil
+}
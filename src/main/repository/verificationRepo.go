@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"cabinet/src/main/datasource"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/validation"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// verificationUniqueFields unique constraints of users.email_verifications
+var verificationUniqueFields = map[string]string{
+	"email_verifications_token_hash_key": "TokenHash",
+}
+
+// IEmailVerificationRepository email verification storage used by services
+type IEmailVerificationRepository interface {
+	Create(ctx context.Context, verification *model.EmailVerification) error
+	FindPending(ctx context.Context, profileID uuid.UUID, at time.Time) (*model.EmailVerification, error)
+	Confirm(ctx context.Context, tokenHash string, at time.Time) (*model.Profile, error)
+}
+
+var _ IEmailVerificationRepository = (*EmailVerificationRepo)(nil)
+
+type EmailVerificationRepo struct {
+	datasource *datasource.Datasource
+}
+
+func NewEmailVerificationRepo(datasource *datasource.Datasource) *EmailVerificationRepo {
+	return &EmailVerificationRepo{datasource: datasource}
+}
+
+// Create inserts the verification and consumes the pending ones of the same address, or of the primary address
+// for primary verifications, only the latest mail stays valid. Created and Expires come from the caller's clock.
+func (v *EmailVerificationRepo) Create(ctx context.Context, verification *model.EmailVerification) error {
+	ctx, err := resolve(v.datasource, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err = validateIssued(verification, verification.Created); err != nil {
+		return err
+	}
+
+	return v.datasource.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		query := tx.NewUpdate().Model((*model.EmailVerification)(nil)).
+			Set("consumed = ?", verification.Created).
+			Where("?TableAlias.profile_id = ?", verification.ProfileID).
+			Where("?TableAlias.consumed IS NULL")
+
+		if verification.Primary {
+			query = query.Where("?TableAlias.is_primary")
+		} else {
+			query = query.Where("NOT ?TableAlias.is_primary").Where("lower(?TableAlias.email) = lower(?)", verification.Email)
+		}
+
+		_, err := query.Exec(ctx)
+
+		if err != nil {
+			return common.TranslateError(ctx, err, nil)
+		}
+
+		_, err = tx.NewInsert().Model(verification).Exec(ctx)
+
+		return common.TranslateError(ctx, err, verificationUniqueFields)
+	})
+}
+
+// FindPending latest primary verification of the profile still pending at the time, common.ErrNotFound when there is none
+func (v *EmailVerificationRepo) FindPending(ctx context.Context, profileID uuid.UUID, at time.Time) (*model.EmailVerification, error) {
+	ctx, err := resolve(v.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var verification = &model.EmailVerification{}
+
+	err = v.datasource.IDB(ctx).NewSelect().
+		Model(verification).
+		Where("?TableAlias.profile_id = ?", profileID).
+		Where("?TableAlias.is_primary").
+		Where("?TableAlias.consumed IS NULL").
+		Where("?TableAlias.expires > ?", at).
+		OrderExpr("?TableAlias.created DESC").
+		Limit(1).
+		Scan(ctx)
+
+	if err != nil {
+		return nil, common.TranslateError(ctx, err, nil)
+	}
+
+	return verification, nil
+}
+
+// Confirm consumes the pending verification of the token hash and marks its address verified, a primary
+// verification makes it the PrimaryEmail of the profile, in one transaction. Unknown, used and expired tokens
+// and removed addresses are common.ErrNotFound, an address taken meanwhile fails with common.UniqueViolationError,
+// both leave the token pending.
+func (v *EmailVerificationRepo) Confirm(ctx context.Context, tokenHash string, at time.Time) (*model.Profile, error) {
+	ctx, err := resolve(v.datasource, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var profile = &model.Profile{}
+
+	err = v.datasource.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var verification = &model.EmailVerification{}
+
+		// consuming first locks the row, a concurrent confirmation of the same token finds nothing
+		err := tx.NewUpdate().Model(verification).
+			Set("consumed = ?", at).
+			Where("?TableAlias.token_hash = ?", tokenHash).
+			Where("?TableAlias.consumed IS NULL").
+			Where("?TableAlias.expires > ?", at).
+			Returning("*").
+			Scan(ctx)
+
+		if err != nil {
+			return common.TranslateError(ctx, err, nil)
+		}
+
+		if !verification.Primary {
+			res, err := tx.NewUpdate().Model((*model.ProfileEmail)(nil)).
+				Set("verified = ?", at).
+				Where("?TableAlias.profile_id = ?", verification.ProfileID).
+				Where("lower(?TableAlias.email) = lower(?)", verification.Email).
+				Exec(ctx)
+
+			if err != nil {
+				return common.TranslateError(ctx, err, profileEmailUniqueFields)
+			}
+
+			if err = checkAffected(res); err != nil {
+				return err
+			}
+
+			if err = releaseEmail(ctx, tx, verification.ProfileID, verification.Email); err != nil {
+				return common.TranslateError(ctx, err, nil)
+			}
+		}
+
+		err = tx.NewSelect().Model(profile).Where("?TableAlias.id = ?", verification.ProfileID).Scan(ctx)
+
+		if err != nil || !verification.Primary {
+			return common.TranslateError(ctx, err, profileUniqueFields)
+		}
+
+		profile.PrimaryEmail = verification.Email
+		profile.EmailVerified = at
+
+		if err = validation.Validate(profile); err != nil {
+			return err
+		}
+
+		return common.TranslateError(ctx, updateProfile(ctx, tx, profile), profileUniqueFields)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// validateIssued checks the rules of a verification, its Created comes from the clock of the issuing service
+func validateIssued(verification any, created time.Time) error {
+	if err := validation.Validate(verification); err != nil {
+		return err
+	}
+
+	if created.IsZero() {
+		return validation.Errors{{Path: "created", Rule: "required"}}
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/validation"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateEmailVerification(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users"."email_verifications" AS "verification" SET consumed = '2029-12-31 23:00:00\+00:00'` +
+		` WHERE \("verification".profile_id = '` + profileTestId1.String() + `'\) AND \("verification".consumed IS NULL\) AND \("verification".is_primary\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "users"."email_verifications" .* VALUES \(DEFAULT, '2029-12-31 23:00:00\+00:00', '` + profileTestId1.String() + `', 'john@smith.com', 'hash', '2030-01-01 00:00:00\+00:00', DEFAULT, TRUE\)`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(profileTestId2))
+	mock.ExpectCommit()
+
+	// secondary verifications only replace the ones of the same address
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users"."email_verifications" AS "verification" SET consumed = '.*'` +
+		` WHERE \("verification".profile_id = '` + profileTestId1.String() + `'\) AND \("verification".consumed IS NULL\)` +
+		` AND \(NOT "verification".is_primary\) AND \(lower\("verification".email\) = lower\('john@doe.com'\)\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO "users"."email_verifications" .* 'john@doe.com', 'hash2', .*, FALSE\)`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+
+	var repo = NewEmailVerificationRepo(ds)
+	var issued = time.Date(2029, 12, 31, 23, 0, 0, 0, time.UTC)
+	var verification = &model.EmailVerification{
+		ProfileID: profileTestId1,
+		Email:     "john@smith.com",
+		TokenHash: "hash",
+		Expires:   issued.Add(time.Hour),
+		Primary:   true,
+	}
+
+	// times come from the clock of the service
+	verification.Created = issued
+
+	assert.NoError(t, repo.Create(context.Background(), verification))
+	assert.Equal(t, profileTestId2, verification.ID)
+
+	var secondary = &model.EmailVerification{
+		ProfileID: profileTestId1,
+		Email:     "john@doe.com",
+		TokenHash: "hash2",
+		Expires:   issued.Add(time.Hour),
+	}
+
+	secondary.Created = issued
+
+	assert.NoError(t, repo.Create(context.Background(), secondary))
+
+	var violations validation.Errors
+
+	secondary.Created = time.Time{}
+
+	assert.True(t, errors.As(repo.Create(context.Background(), secondary), &violations))
+	assert.Equal(t, []string{"created: required"}, violations.Details())
+
+	verification.Email = "john"
+
+	assert.True(t, errors.Is(repo.Create(context.Background(), verification), validation.ErrInvalid))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestCreateEmailVerification is successful")
+}
+
+func TestConfirmEmailVerification(t *testing.T) {
+	ds, mock := newRegexpDatasource(t)
+
+	var at = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE "users"."email_verifications" AS "verification" SET consumed = '2025-01-01 00:00:00\+00:00'` +
+		` WHERE \("verification".token_hash = 'hash'\) AND \("verification".consumed IS NULL\) AND \("verification".expires > '2025-01-01 00:00:00\+00:00'\) RETURNING \*`).
+		WillReturnRows(mock.NewRows([]string{"id", "profile_id", "email", "is_primary"}).AddRow(uuid.New(), profileTestId1, "new@smith.com", true))
+	mock.ExpectQuery(`SELECT .* FROM "users"."profiles" AS "profile" WHERE \("profile".id = '` + profileTestId1.String() + `'\)`).
+		WillReturnRows(mock.NewRows([]string{"id", "login", "primary_email", "version"}).AddRow(profileTestId1, "login1", "old@smith.com", 2))
+	mock.ExpectExec(`UPDATE "users"."profiles" AS "profile" SET .*"primary_email" = 'new@smith.com', "email_verified" = '2025-01-01 00:00:00\+00:00', .* WHERE \("profile".version = 2\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectPrimaryEmailSync(mock, "new@smith.com", true)
+	mock.ExpectCommit()
+
+	// secondary addresses are marked verified, the profile is unchanged
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE "users"."email_verifications"`).
+		WillReturnRows(mock.NewRows([]string{"id", "profile_id", "email", "is_primary"}).AddRow(uuid.New(), profileTestId1, "john@doe.com", false))
+	mock.ExpectExec(`UPDATE "users"."profile_emails" AS "profile_email" SET verified = '2025-01-01 00:00:00\+00:00'` +
+		` WHERE \("profile_email".profile_id = '` + profileTestId1.String() + `'\) AND \(lower\("profile_email".email\) = lower\('john@doe.com'\)\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "users"."profile_emails" AS "profile_email" WHERE \(lower\("profile_email".email\) = lower\('john@doe.com'\)\)` +
+		` AND \("profile_email".profile_id <> '` + profileTestId1.String() + `'\) AND \("profile_email".verified IS NULL\) AND \(NOT "profile_email".is_primary\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT .* FROM "users"."profiles"`).
+		WillReturnRows(mock.NewRows([]string{"id", "login", "primary_email", "version"}).AddRow(profileTestId1, "login1", "new@smith.com", 3))
+	mock.ExpectCommit()
+
+	// the address was removed meanwhile
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE "users"."email_verifications"`).
+		WillReturnRows(mock.NewRows([]string{"id", "profile_id", "email", "is_primary"}).AddRow(uuid.New(), profileTestId1, "john@doe.com", false))
+	mock.ExpectExec(`UPDATE "users"."profile_emails"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	// unknown, used and expired tokens match nothing
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE "users"."email_verifications"`).
+		WillReturnRows(mock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	// the address was taken meanwhile, the token stays pending
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE "users"."email_verifications"`).
+		WillReturnRows(mock.NewRows([]string{"id", "profile_id", "email", "is_primary"}).AddRow(uuid.New(), profileTestId1, "new@smith.com", true))
+	mock.ExpectQuery(`SELECT .* FROM "users"."profiles"`).
+		WillReturnRows(mock.NewRows([]string{"id", "login", "version"}).AddRow(profileTestId1, "login1", 3))
+	mock.ExpectExec(`UPDATE "users"."profiles"`).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "profiles_primary_email_key"})
+	mock.ExpectRollback()
+
+	var repo = NewEmailVerificationRepo(ds)
+
+	profile, err := repo.Confirm(context.Background(), "hash", at)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "new@smith.com", profile.PrimaryEmail)
+	assert.Equal(t, at, profile.EmailVerified)
+	assert.Equal(t, int64(3), profile.Version)
+
+	profile, err = repo.Confirm(context.Background(), "secondary", at)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "new@smith.com", profile.PrimaryEmail)
+	assert.Equal(t, int64(3), profile.Version)
+
+	_, err = repo.Confirm(context.Background(), "removed", at)
+
+	assert.True(t, errors.Is(err, common.ErrNotFound))
+
+	_, err = repo.Confirm(context.Background(), "used", at)
+
+	assert.True(t, errors.Is(err, common.ErrNotFound))
+
+	var uniqueErr *common.UniqueViolationError
+
+	_, err = repo.Confirm(context.Background(), "hash", at)
+
+	assert.True(t, errors.As(err, &uniqueErr))
+	assert.Equal(t, "PrimaryEmail", uniqueErr.Field)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	slog.Info("TestConfirmEmailVerification is successful")
+}
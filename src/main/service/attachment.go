@@ -0,0 +1,126 @@
+package service
+
+import (
+	"cabinet/src/main/auth"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/storage"
+	"context"
+	"io"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// cleanupTimeout bounds the removal of an orphaned object after a failed insert
+const cleanupTimeout = 30 * time.Second
+
+// AttachmentService keeps attachment rows and their stored objects consistent.
+// Every method acts for the viewer of ctx, see auth.ViewerFrom, as the policy allows.
+type AttachmentService struct {
+	attachments repository.IAttachmentRepository
+	blobs       storage.BlobStore
+	policy      Policy
+}
+
+func NewAttachmentService(attachments repository.IAttachmentRepository, blobs storage.BlobStore, policy Policy) *AttachmentService {
+	return &AttachmentService{attachments: attachments, blobs: blobs, policy: policy}
+}
+
+// Upload streams the content to the blob store under a new S3Key, then inserts the attachment.
+// The object is deleted again when the insert fails, so no row ever points to a missing object.
+func (s *AttachmentService) Upload(ctx context.Context, attachment *model.Attachment, content io.Reader, size int64, contentType string) (*storage.ObjectInfo, error) {
+	if err := Authorize(s.policy, auth.ViewerFrom(ctx), ActionCreate, attachment); err != nil {
+		return nil, err
+	}
+
+	if attachment.S3Key == uuid.Nil {
+		attachment.S3Key = uuid.New()
+	}
+
+	info, err := s.blobs.Put(ctx, attachment.S3Key, content, size, contentType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.attachments.Create(ctx, attachment); err != nil {
+		discard(ctx, s.blobs, attachment.S3Key)
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// List attachments of the profile, private ones only when the viewer may read them
+func (s *AttachmentService) List(ctx context.Context, userID uuid.UUID) ([]*model.Attachment, error) {
+	var private = &model.Attachment{UserID: userID, Private: true}
+
+	return s.attachments.ListByUserID(ctx, userID, s.policy.Can(auth.ViewerFrom(ctx), ActionRead, private))
+}
+
+// Open attachment and its content, the caller closes the content
+func (s *AttachmentService) Open(ctx context.Context, id uuid.UUID) (*model.Attachment, io.ReadCloser, *storage.ObjectInfo, error) {
+	attachment, err := s.find(ctx, id, ActionRead)
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	content, info, err := s.blobs.Get(ctx, attachment.S3Key)
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return attachment, content, info, nil
+}
+
+// Presign download URL of the attachment content valid for expiry
+func (s *AttachmentService) Presign(ctx context.Context, id uuid.UUID, expiry time.Duration) (*url.URL, error) {
+	attachment, err := s.find(ctx, id, ActionRead)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.blobs.Presign(ctx, attachment.S3Key, expiry)
+}
+
+// Delete soft deletes the attachment, its content is kept for a restore
+func (s *AttachmentService) Delete(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.find(ctx, id, ActionDelete); err != nil {
+		return err
+	}
+
+	return s.attachments.Delete(ctx, id)
+}
+
+// find attachment the viewer may perform the action on
+func (s *AttachmentService) find(ctx context.Context, id uuid.UUID, action Action) (*model.Attachment, error) {
+	attachment, err := s.attachments.FindById(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = Authorize(s.policy, auth.ViewerFrom(ctx), action, attachment); err != nil {
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// discard removes objects no row refers to, even when the request ctx is already cancelled
+func discard(ctx context.Context, blobs storage.BlobStore, keys ...uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	for _, key := range keys {
+		if err := blobs.Delete(ctx, key); err != nil {
+			slog.Error("Removing orphaned object failed", slog.String("key", key.String()), slog.Any("err", err))
+		}
+	}
+}
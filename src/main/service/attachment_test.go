@@ -0,0 +1,154 @@
+package service
+
+import (
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/repository/repotest"
+	"cabinet/src/main/storage"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttachmentUpload(t *testing.T) {
+	var owner = uuid.New()
+	var ctx = viewerContext(owner, false)
+	var repo = repotest.NewAttachments()
+	var blobs = storage.NewMemoryStore()
+	var service = NewAttachmentService(repo, blobs, DefaultPolicy())
+
+	var attachment = &model.Attachment{Title: "Report", UserID: owner}
+	info, err := service.Upload(ctx, attachment, strings.NewReader("content"), 7, "text/plain")
+
+	assert.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, attachment.S3Key)
+	assert.Equal(t, attachment.S3Key, info.Key)
+	assert.Equal(t, []uuid.UUID{attachment.S3Key}, blobs.Keys())
+	assert.Equal(t, attachment.S3Key, repo.Last("Create")[0].(model.Attachment).S3Key)
+
+	repo.Attachments = append(repo.Attachments, attachment)
+
+	opened, content, info, err := service.Open(ctx, attachment.ID)
+
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(content)
+	_ = content.Close()
+	assert.Equal(t, "content", string(data))
+	assert.Equal(t, "Report", opened.Title)
+	assert.Equal(t, "text/plain", info.ContentType)
+
+	presigned, err := service.Presign(ctx, attachment.ID, time.Minute)
+
+	assert.NoError(t, err)
+	assert.Equal(t, attachment.S3Key.String(), presigned.Opaque)
+
+	_, _, _, err = service.Open(ctx, uuid.New())
+	assert.ErrorIs(t, err, common.ErrNotFound)
+
+	slog.Info("TestAttachmentUpload success")
+}
+
+func TestAttachmentPolicy(t *testing.T) {
+	var owner = uuid.New()
+	var repo = repotest.NewAttachments()
+	var blobs = storage.NewMemoryStore()
+	var service = NewAttachmentService(repo, blobs, DefaultPolicy())
+
+	var private = &model.Attachment{Title: "Private", UserID: owner, Private: true}
+	var public = &model.Attachment{Title: "Public", UserID: owner}
+
+	for _, attachment := range []*model.Attachment{private, public} {
+		_, err := service.Upload(viewerContext(owner, false), attachment, strings.NewReader("content"), 7, "")
+		assert.NoError(t, err)
+	}
+
+	repo.Attachments = []*model.Attachment{private, public}
+
+	// nobody uploads for someone else, the rejected content is never stored
+	_, err := service.Upload(viewerContext(uuid.New(), false), &model.Attachment{UserID: owner}, strings.NewReader("x"), 1, "")
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = service.Upload(context.Background(), &model.Attachment{UserID: owner}, strings.NewReader("x"), 1, "")
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	assert.Len(t, blobs.Keys(), 2)
+	assert.Len(t, repo.Calls("Create"), 2)
+
+	// private attachments are listed to those who may read them
+	for name, tc := range map[string]struct {
+		ctx     context.Context
+		private bool
+		open    error
+	}{
+		"anonymous": {context.Background(), false, common.ErrNotFound},
+		"other":     {viewerContext(uuid.New(), false), false, common.ErrNotFound},
+		"owner":     {viewerContext(owner, false), true, nil},
+		"admin":     {viewerContext(uuid.New(), true), true, nil},
+	} {
+		_, err := service.List(tc.ctx, owner)
+		assert.NoError(t, err, name)
+		assert.Equal(t, []any{owner, tc.private}, repo.Last("ListByUserID"), name)
+
+		_, err = service.Presign(tc.ctx, private.ID, time.Minute)
+		assert.ErrorIs(t, err, tc.open, name)
+
+		_, err = service.Presign(tc.ctx, public.ID, time.Minute)
+		assert.NoError(t, err, name)
+	}
+
+	assert.ErrorIs(t, service.Delete(viewerContext(uuid.New(), false), public.ID), ErrForbidden)
+	assert.ErrorIs(t, service.Delete(viewerContext(uuid.New(), false), private.ID), common.ErrNotFound)
+	assert.NoError(t, service.Delete(viewerContext(uuid.New(), true), private.ID))
+	assert.NoError(t, service.Delete(viewerContext(owner, false), public.ID))
+	assert.Equal(t, []any{public.ID}, repo.Last("Delete"))
+	assert.Len(t, repo.Calls("Delete"), 2)
+
+	slog.Info("TestAttachmentPolicy success")
+}
+
+func TestAttachmentUploadCompensation(t *testing.T) {
+	var repo = repotest.NewAttachments()
+	var blobs = storage.NewMemoryStore()
+	var service = NewAttachmentService(repo, blobs, DefaultPolicy())
+	var owner = uuid.New()
+
+	repo.Fail("Create", common.ErrForeignKeyViolation)
+
+	// the object is removed even though the request was cancelled by then
+	ctx, cancel := context.WithCancel(viewerContext(owner, false))
+
+	var attachment = &model.Attachment{Title: "Report", UserID: owner}
+	_, err := service.Upload(ctx, attachment, cancelAtEOF{reader: strings.NewReader("content"), cancel: cancel}, -1, "")
+
+	assert.ErrorIs(t, err, common.ErrForeignKeyViolation)
+	assert.Empty(t, blobs.Keys())
+
+	// a failed upload never reaches the database
+	_, err = service.Upload(viewerContext(owner, false), &model.Attachment{UserID: owner}, strings.NewReader("short"), 10, "")
+
+	assert.ErrorIs(t, err, storage.ErrSizeMismatch)
+	assert.Len(t, repo.Calls("Create"), 1)
+
+	slog.Info("TestAttachmentUploadCompensation success")
+}
+
+// cancelAtEOF cancels the request once the upload body is consumed
+type cancelAtEOF struct {
+	reader io.Reader
+	cancel context.CancelFunc
+}
+
+func (c cancelAtEOF) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+
+	if err == io.EOF {
+		c.cancel()
+	}
+
+	return n, err
+}
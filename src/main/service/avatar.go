@@ -0,0 +1,166 @@
+package service
+
+import (
+	"bytes"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/storage"
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// AvatarSizes square thumbnail renditions stored for every avatar, ascending
+var AvatarSizes = []int{64, 128, 512}
+
+// OriginalSize rendition of the upload itself, re-encoded without metadata
+const OriginalSize = 0
+
+// AvatarService lifecycle of Profile.Avatar and its stored renditions
+type AvatarService struct {
+	profiles repository.IProfileRepository
+	blobs    storage.BlobStore
+	limits   ImageLimits
+}
+
+func NewAvatarService(profiles repository.IProfileRepository, blobs storage.BlobStore, limits ImageLimits) *AvatarService {
+	return &AvatarService{profiles: profiles, blobs: blobs, limits: limits}
+}
+
+// RenditionKey blob key of an avatar rendition, the original is stored under the avatar id
+func RenditionKey(avatar uuid.UUID, size int) uuid.UUID {
+	if size == OriginalSize {
+		return avatar
+	}
+	return uuid.NewSHA1(avatar, []byte(strconv.Itoa(size)))
+}
+
+// RenditionFor smallest thumbnail covering the requested size, the original beyond the largest
+func RenditionFor(size int) int {
+	if size <= 0 {
+		return OriginalSize
+	}
+
+	for _, rendition := range AvatarSizes {
+		if rendition >= size {
+			return rendition
+		}
+	}
+
+	return OriginalSize
+}
+
+// Replace validates the upload, stores its renditions under a new avatar id and points the profile to it.
+// The renditions are removed again when the profile update fails, the previous ones once it succeeds.
+func (s *AvatarService) Replace(ctx context.Context, profile *model.Profile, content io.Reader, contentType string) error {
+	renditions, err := s.render(content, contentType)
+
+	if err != nil {
+		return err
+	}
+
+	var avatar = uuid.New()
+	var stored = make([]uuid.UUID, 0, len(renditions))
+
+	for size, rendition := range renditions {
+		var key = RenditionKey(avatar, size)
+
+		if _, err = s.blobs.Put(ctx, key, bytes.NewReader(rendition.data), int64(len(rendition.data)), rendition.contentType); err != nil {
+			discard(ctx, s.blobs, stored...)
+			return err
+		}
+
+		stored = append(stored, key)
+	}
+
+	var previous = profile.Avatar
+	profile.Avatar = avatar
+
+	if err = s.profiles.Update(ctx, profile); err != nil {
+		profile.Avatar = previous
+		discard(ctx, s.blobs, stored...)
+		return err
+	}
+
+	if previous != uuid.Nil {
+		discard(ctx, s.blobs, renditionKeys(previous)...)
+	}
+
+	return nil
+}
+
+// Remove clears the avatar of the profile and deletes its renditions
+func (s *AvatarService) Remove(ctx context.Context, profile *model.Profile) error {
+	var previous = profile.Avatar
+
+	if previous == uuid.Nil {
+		return nil
+	}
+
+	profile.Avatar = uuid.Nil
+
+	if err := s.profiles.Update(ctx, profile); err != nil {
+		profile.Avatar = previous
+		return err
+	}
+
+	discard(ctx, s.blobs, renditionKeys(previous)...)
+
+	return nil
+}
+
+// Open rendition of the profile avatar chosen by RenditionFor, storage.ErrNotFound without an avatar
+func (s *AvatarService) Open(ctx context.Context, profileID uuid.UUID, size int) (io.ReadCloser, *storage.ObjectInfo, error) {
+	profile, err := s.profiles.FindById(ctx, profileID)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if profile.Avatar == uuid.Nil {
+		return nil, nil, storage.ErrNotFound
+	}
+
+	return s.blobs.Get(ctx, RenditionKey(profile.Avatar, RenditionFor(size)))
+}
+
+// render validates the upload and encodes the original and the thumbnails keyed by size
+func (s *AvatarService) render(content io.Reader, contentType string) (map[int]*encodedImage, error) {
+	data, sourceType, err := readImage(content, contentType, s.limits)
+
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := decodeImage(data, sourceType, s.limits)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var renditions = make(map[int]*encodedImage, len(AvatarSizes)+1)
+
+	if renditions[OriginalSize], err = encodeImage(decoded, sourceType); err != nil {
+		return nil, err
+	}
+
+	for _, size := range AvatarSizes {
+		if renditions[size], err = encodeImage(thumbnail(decoded, size), sourceType); err != nil {
+			return nil, err
+		}
+	}
+
+	return renditions, nil
+}
+
+func renditionKeys(avatar uuid.UUID) []uuid.UUID {
+	var keys = []uuid.UUID{RenditionKey(avatar, OriginalSize)}
+
+	for _, size := range AvatarSizes {
+		keys = append(keys, RenditionKey(avatar, size))
+	}
+
+	return keys
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"bytes"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/repository/repotest"
+	"cabinet/src/main/storage"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newImage(width int, height int) *image.NRGBA {
+	var img = image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buffer bytes.Buffer
+	assert.NoError(t, png.Encode(&buffer, img))
+	return buffer.Bytes()
+}
+
+func newAvatarProfile() *model.Profile {
+	var profile = &model.Profile{Login: "avatar"}
+	profile.ID = uuid.New()
+	return profile
+}
+
+func openRendition(t *testing.T, service *AvatarService, id uuid.UUID, size int) (image.Image, *storage.ObjectInfo) {
+	content, info, err := service.Open(context.Background(), id, size)
+	assert.NoError(t, err)
+
+	defer content.Close()
+
+	decoded, _, err := image.Decode(content)
+	assert.NoError(t, err)
+
+	return decoded, info
+}
+
+func TestAvatarRenditions(t *testing.T) {
+	var ctx = context.Background()
+	var profile = newAvatarProfile()
+	var blobs = storage.NewMemoryStore()
+	var service = NewAvatarService(repotest.NewProfiles(profile), blobs, DefaultImageLimits())
+
+	assert.NoError(t, service.Replace(ctx, profile, bytes.NewReader(encodePNG(t, newImage(200, 100))), "image/png"))
+	assert.NotEqual(t, uuid.Nil, profile.Avatar)
+	assert.ElementsMatch(t, renditionKeys(profile.Avatar), blobs.Keys())
+
+	for requested, side := range map[int]int{1: 64, 64: 64, 100: 128, 512: 512} {
+		decoded, info := openRendition(t, service, profile.ID, requested)
+		assert.Equal(t, image.Rect(0, 0, side, side), decoded.Bounds())
+		assert.Equal(t, ContentTypePNG, info.ContentType)
+	}
+
+	original, _ := openRendition(t, service, profile.ID, 2048)
+	assert.Equal(t, image.Rect(0, 0, 200, 100), original.Bounds())
+
+	// a new avatar replaces every rendition of the previous one
+	var previous = profile.Avatar
+	assert.NoError(t, service.Replace(ctx, profile, bytes.NewReader(encodePNG(t, newImage(64, 64))), ""))
+	assert.NotEqual(t, previous, profile.Avatar)
+	assert.ElementsMatch(t, renditionKeys(profile.Avatar), blobs.Keys())
+
+	assert.NoError(t, service.Remove(ctx, profile))
+	assert.Equal(t, uuid.Nil, profile.Avatar)
+	assert.Empty(t, blobs.Keys())
+
+	_, _, err := service.Open(ctx, profile.ID, 64)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	slog.Info("TestAvatarRenditions success")
+}
+
+func TestAvatarValidation(t *testing.T) {
+	var ctx = context.Background()
+	var profile = newAvatarProfile()
+	var repo = repotest.NewProfiles(profile)
+	var blobs = storage.NewMemoryStore()
+	var service = NewAvatarService(repo, blobs, ImageLimits{MaxBytes: 64 << 10, MinSide: 64, MaxSide: 1024})
+
+	var valid = encodePNG(t, newImage(64, 64))
+	var gifData bytes.Buffer
+	assert.NoError(t, gif.Encode(&gifData, newImage(64, 64), nil))
+
+	for name, tc := range map[string]struct {
+		content     []byte
+		contentType string
+		err         error
+	}{
+		"gif":           {gifData.Bytes(), "", ErrUnsupportedImage},
+		"text":          {[]byte(strings.Repeat("text ", 20)), "", ErrUnsupportedImage},
+		"mismatch":      {valid, "image/jpeg", ErrUnsupportedImage},
+		"too small":     {encodePNG(t, newImage(32, 128)), "image/png", ErrInvalidImage},
+		"too wide":      {encodePNG(t, image.NewGray(image.Rect(0, 0, 2048, 64))), "image/png", ErrImageTooLarge},
+		"too many byte": {append(valid, make([]byte, 64<<10)...), "image/png", ErrImageTooLarge},
+		"truncated":     {valid[:len(valid)/2], "image/png", ErrInvalidImage},
+	} {
+		err := service.Replace(ctx, profile, bytes.NewReader(tc.content), tc.contentType)
+		assert.ErrorIs(t, err, tc.err, name)
+	}
+
+	// stored renditions are removed when the profile update fails
+	repo.Fail("Update", common.ErrConcurrentModification)
+
+	err := service.Replace(ctx, profile, bytes.NewReader(valid), "image/png; charset=binary")
+
+	assert.ErrorIs(t, err, common.ErrConcurrentModification)
+	assert.Equal(t, uuid.Nil, profile.Avatar)
+	assert.Empty(t, blobs.Keys())
+
+	slog.Info("TestAvatarValidation success")
+}
+
+func TestAvatarStripsExif(t *testing.T) {
+	var encoded bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&encoded, newImage(80, 64), nil))
+
+	// APP1 Exif segment with orientation 6, the camera was rotated 90 degrees clockwise
+	var tiff = []byte{'I', 'I', 0x2A, 0, 8, 0, 0, 0, 1, 0, 0x12, 0x01, 3, 0, 1, 0, 0, 0, 6, 0, 0, 0, 0, 0, 0, 0}
+	var segment = append([]byte("Exif\x00\x00"), tiff...)
+	var app1 = append([]byte{0xFF, 0xE1, 0, 0}, segment...)
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+
+	var data = append(append(append([]byte{}, encoded.Bytes()[:2]...), app1...), encoded.Bytes()[2:]...)
+
+	assert.Equal(t, 6, jpegOrientation(data))
+	assert.Equal(t, 1, jpegOrientation(encoded.Bytes()))
+
+	var profile = newAvatarProfile()
+	var blobs = storage.NewMemoryStore()
+	var service = NewAvatarService(repotest.NewProfiles(profile), blobs, DefaultImageLimits())
+
+	assert.NoError(t, service.Replace(context.Background(), profile, bytes.NewReader(data), "image/jpeg"))
+
+	content, info, err := blobs.Get(context.Background(), RenditionKey(profile.Avatar, OriginalSize))
+	assert.NoError(t, err)
+
+	stored, _ := io.ReadAll(content)
+	_ = content.Close()
+
+	assert.Equal(t, ContentTypeJPEG, info.ContentType)
+	assert.NotContains(t, string(stored), "Exif")
+
+	decoded, err := jpeg.Decode(bytes.NewReader(stored))
+
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 64, 80), decoded.Bounds())
+
+	slog.Info("TestAvatarStripsExif success")
+}
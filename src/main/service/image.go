@@ -0,0 +1,244 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Image content types accepted for upload
+const (
+	ContentTypePNG  = "image/png"
+	ContentTypeJPEG = "image/jpeg"
+	ContentTypeWebP = "image/webp"
+)
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported image type")
+	ErrInvalidImage     = errors.New("invalid image")
+	ErrImageTooLarge    = errors.New("image too large")
+)
+
+// ImageLimits accepted upload size and dimensions
+type ImageLimits struct {
+	MaxBytes int64
+	MinSide  int
+	MaxSide  int
+}
+
+func DefaultImageLimits() ImageLimits {
+	return ImageLimits{MaxBytes: 5 << 20, MinSide: 64, MaxSide: 4096}
+}
+
+// encodedImage re-encoded rendition
+type encodedImage struct {
+	data        []byte
+	contentType string
+}
+
+// readImage reads at most limits.MaxBytes and validates the sniffed type against the declared one
+func readImage(content io.Reader, contentType string, limits ImageLimits) ([]byte, string, error) {
+	data, err := io.ReadAll(io.LimitReader(content, limits.MaxBytes+1))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if int64(len(data)) > limits.MaxBytes {
+		return nil, "", fmt.Errorf("%w: more than %d bytes", ErrImageTooLarge, limits.MaxBytes)
+	}
+
+	sniffed := http.DetectContentType(data)
+
+	switch sniffed {
+	case ContentTypePNG, ContentTypeJPEG, ContentTypeWebP:
+	default:
+		return nil, "", fmt.Errorf("%w: %s, expected png, jpeg or webp", ErrUnsupportedImage, sniffed)
+	}
+
+	if contentType != "" {
+		declared, _, err := mime.ParseMediaType(contentType)
+
+		if err != nil || declared != sniffed {
+			return nil, "", fmt.Errorf("%w: declared %s, content is %s", ErrUnsupportedImage, contentType, sniffed)
+		}
+	}
+
+	return data, sniffed, nil
+}
+
+// decodeImage checks the dimensions before decoding and applies the JPEG EXIF orientation,
+// the decoded pixels carry no metadata
+func decodeImage(data []byte, contentType string, limits ImageLimits) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	if config.Width < limits.MinSide || config.Height < limits.MinSide {
+		return nil, fmt.Errorf("%w: %dx%d is smaller than %dx%d", ErrInvalidImage, config.Width, config.Height, limits.MinSide, limits.MinSide)
+	}
+
+	if config.Width > limits.MaxSide || config.Height > limits.MaxSide {
+		return nil, fmt.Errorf("%w: %dx%d is larger than %dx%d", ErrImageTooLarge, config.Width, config.Height, limits.MaxSide, limits.MaxSide)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	if contentType == ContentTypeJPEG {
+		decoded = orient(decoded, jpegOrientation(data))
+	}
+
+	return decoded, nil
+}
+
+// encodeImage JPEG stays JPEG, PNG and WebP become PNG to keep transparency
+func encodeImage(img image.Image, sourceType string) (*encodedImage, error) {
+	var buffer bytes.Buffer
+	var err error
+	var contentType = ContentTypePNG
+
+	if sourceType == ContentTypeJPEG {
+		contentType = ContentTypeJPEG
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 90})
+	} else {
+		err = png.Encode(&buffer, img)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &encodedImage{data: buffer.Bytes(), contentType: contentType}, nil
+}
+
+// thumbnail center square of the image scaled to size x size
+func thumbnail(img image.Image, size int) image.Image {
+	var bounds = img.Bounds()
+	var side = min(bounds.Dx(), bounds.Dy())
+	var origin = image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+	var square = image.Rectangle{Min: origin, Max: origin.Add(image.Pt(side, side))}
+
+	var scaled = image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, square, draw.Src, nil)
+
+	return scaled
+}
+
+// jpegOrientation EXIF orientation tag of a JPEG, 1 when absent
+func jpegOrientation(data []byte) int {
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			break
+		}
+
+		segment := data[i+4 : i+2+length]
+
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+// tiffOrientation orientation (0x0112) entry of the first IFD
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+
+	if offset+2 > len(tiff) {
+		return 1
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+
+	for entry := offset + 2; entry+12 <= len(tiff) && count > 0; entry, count = entry+12, count-1 {
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+
+	return 1
+}
+
+// orient transforms the pixels so the image displays upright without the EXIF tag
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	var bounds = img.Bounds()
+	var w, h = bounds.Dx(), bounds.Dy()
+	var dst *image.NRGBA
+
+	if orientation >= 5 {
+		dst = image.NewNRGBA(image.Rect(0, 0, h, w))
+	} else {
+		dst = image.NewNRGBA(image.Rect(0, 0, w, h))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+
+			dst.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return dst
+}
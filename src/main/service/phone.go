@@ -0,0 +1,203 @@
+package service
+
+import (
+	"cabinet/src/main/model"
+	"cabinet/src/main/phone"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/validation"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// codeDigits length of a texted verification code
+const codeDigits = 6
+
+var (
+	ErrSMSDisabled = errors.New("sms verification is disabled")
+	ErrNoPhone     = errors.New("profile has no phone number")
+	ErrTooFrequent = repository.ErrTooFrequent
+)
+
+// PhoneConfig SMS verification settings
+type PhoneConfig struct {
+	TTL         time.Duration // validity of a code
+	MaxAttempts int           // codes tried before the code stops working
+	ResendAfter time.Duration // minimum interval between codes to a number of a profile, 0 disables
+	HourlyLimit int           // codes to a number of a profile within an hour, 0 disables
+	Secret      []byte        // keys the stored code hashes, see VerificationConfig.Secret
+}
+
+func DefaultPhoneConfig() PhoneConfig {
+	return PhoneConfig{TTL: 10 * time.Minute, MaxAttempts: 5, ResendAfter: time.Minute, HourlyLimit: 5}
+}
+
+// PhoneVerifier normalizes the phone of profiles to E.164 and confirms numbers by texted codes.
+// Codes are stored as HMAC-SHA256 hashes bound to the profile and number, they are single use and expire.
+type PhoneVerifier struct {
+	verifications repository.IPhoneVerificationRepository
+	parser        *phone.Parser
+	sender        phone.Sender
+	cfg           PhoneConfig
+	now           func() time.Time
+}
+
+// NewPhoneVerifier a nil sender disables Request and Confirm, numbers are normalized anyway
+func NewPhoneVerifier(verifications repository.IPhoneVerificationRepository, parser *phone.Parser, sender phone.Sender, cfg PhoneConfig) *PhoneVerifier {
+	cfg.Secret = newSecret(cfg.Secret)
+
+	return &PhoneVerifier{verifications: verifications, parser: parser, sender: sender, cfg: cfg, now: time.Now}
+}
+
+// Enabled reports whether numbers can be verified
+func (v *PhoneVerifier) Enabled() bool {
+	return v.sender != nil
+}
+
+// Number E.164 form of a typed number, wraps phone.ErrInvalid
+func (v *PhoneVerifier) Number(input string) (string, error) {
+	return v.parser.Normalize(input)
+}
+
+// Apply normalizes the typed Phone of the profile into PhoneE164, a changed number is no longer verified.
+// Numbers that cannot be dialed fail with validation.Errors on the phone field.
+func (v *PhoneVerifier) Apply(profile *model.Profile) error {
+	var number string
+
+	if strings.TrimSpace(profile.Phone) != "" {
+		normalized, err := v.parser.Normalize(profile.Phone)
+
+		if err != nil {
+			return validation.Errors{{Path: "phone", Rule: "phone"}}
+		}
+
+		number = normalized
+	}
+
+	if number != profile.PhoneE164 {
+		profile.PhoneE164 = number
+		profile.PhoneVerified = time.Time{}
+	}
+
+	return nil
+}
+
+// Request texts a code confirming the number of the profile, earlier codes stop working.
+// Returns nil when the number is verified already, ErrTooFrequent when the resend interval
+// or the hourly limit of the profile and number is not kept.
+func (v *PhoneVerifier) Request(ctx context.Context, profile *model.Profile) (*model.PhoneVerification, error) {
+	switch {
+	case !v.Enabled():
+		return nil, ErrSMSDisabled
+	case profile.PhoneE164 == "":
+		return nil, ErrNoPhone
+	case !profile.PhoneVerified.IsZero():
+		return nil, nil
+	}
+
+	var now = v.now().UTC()
+
+	code, err := newCode()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var verification = &model.PhoneVerification{
+		ProfileID: profile.ID,
+		Phone:     profile.PhoneE164,
+		CodeHash:  v.hashCode(profile, profile.PhoneE164, code),
+		Expires:   now.Add(v.cfg.TTL),
+	}
+
+	verification.Created = now
+
+	var limits = repository.PhoneLimits{ResendAfter: v.cfg.ResendAfter, HourlyLimit: v.cfg.HourlyLimit}
+
+	if err = v.verifications.Create(ctx, verification, limits); err != nil {
+		return nil, err
+	}
+
+	var message = phone.Message{
+		To:   profile.PhoneE164,
+		Body: "Your verification code is " + code + ", it expires in " + v.cfg.TTL.String() + ".",
+	}
+
+	if err = v.sender.Send(ctx, message); err != nil {
+		return nil, fmt.Errorf("sending verification sms: %w", err)
+	}
+
+	return verification, nil
+}
+
+// Confirm marks the number of the profile verified when the code matches its pending verification. Every code
+// counts as an attempt, wrong, missing, used or expired codes, codes out of attempts and changed numbers fail
+// with ErrInvalidVerification.
+func (v *PhoneVerifier) Confirm(ctx context.Context, profile *model.Profile, code string) (*model.Profile, error) {
+	if !v.Enabled() {
+		return nil, ErrSMSDisabled
+	}
+
+	var at = v.now().UTC()
+
+	verification, err := v.verifications.FindPending(ctx, profile.ID, at)
+
+	if errors.Is(err, common.ErrNotFound) || (err == nil && verification.Phone != profile.PhoneE164) {
+		return nil, ErrInvalidVerification
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the attempt is counted before the code is compared, concurrent tries cannot exceed MaxAttempts
+	verification, err = v.verifications.Attempt(ctx, verification.ID, at, v.cfg.MaxAttempts)
+
+	if errors.Is(err, common.ErrNotFound) {
+		return nil, ErrInvalidVerification
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var expected = v.hashCode(profile, verification.Phone, strings.TrimSpace(code))
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(verification.CodeHash)) != 1 {
+		return nil, ErrInvalidVerification
+	}
+
+	confirmed, err := v.verifications.Confirm(ctx, verification.ID, at)
+
+	if errors.Is(err, common.ErrNotFound) {
+		return nil, ErrInvalidVerification
+	}
+
+	return confirmed, err
+}
+
+// newCode random numeric code, only its hash is stored
+func newCode() (string, error) {
+	var limit = big.NewInt(1)
+
+	limit.Exp(big.NewInt(10), big.NewInt(codeDigits), nil)
+
+	n, err := rand.Int(rand.Reader, limit)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", codeDigits, n), nil
+}
+
+// hashCode binds the short code to the profile and number, a code of one profile is worthless for another
+func (v *PhoneVerifier) hashCode(profile *model.Profile, number string, code string) string {
+	return hashToken(v.cfg.Secret, profile.ID.String()+":"+number+":"+code)
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"cabinet/src/main/model"
+	"cabinet/src/main/phone"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/repository/repotest"
+	"cabinet/src/main/validation"
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var codePattern = regexp.MustCompile(`\b[0-9]{6}\b`)
+
+func TestPhoneVerifier(t *testing.T) {
+	var ctx = context.Background()
+	var profile = &model.Profile{Login: "jsmith", Phone: "(202) 555-0143"}
+	profile.ID = uuid.New()
+
+	var verifications = &repotest.PhoneVerifications{}
+	var sender = phone.NewMemorySender()
+	var parser, _ = phone.NewParser("US")
+	var verifier = NewPhoneVerifier(verifications, parser, sender, PhoneConfig{TTL: time.Minute, MaxAttempts: 2})
+
+	// unverified numbers can not be texted
+	_, err := verifier.Request(ctx, profile)
+
+	assert.ErrorIs(t, err, ErrNoPhone)
+
+	assert.NoError(t, verifier.Apply(profile))
+	assert.Equal(t, "+12025550143", profile.PhoneE164)
+
+	var issued = time.Now().UTC().Truncate(time.Second)
+
+	verifier.now = func() time.Time { return issued }
+
+	verification, err := verifier.Request(ctx, profile)
+
+	// stored times come from the clock of the verifier
+	assert.NoError(t, err)
+	assert.Equal(t, "+12025550143", verification.Phone)
+	assert.Equal(t, issued, verification.Created)
+	assert.Equal(t, issued.Add(time.Minute), verifications.Last("Create")[0].(model.PhoneVerification).Expires)
+
+	// only the hash is stored, bound to the profile and number
+	message, _ := sender.Last()
+	var code = codePattern.FindString(message.Body)
+
+	assert.Equal(t, "+12025550143", message.To)
+	assert.Len(t, code, codeDigits)
+	assert.Equal(t, verifier.hashCode(profile, "+12025550143", code), verification.CodeHash)
+	assert.NotEqual(t, verifier.hashCode(&model.Profile{}, "+12025550143", code), verification.CodeHash)
+
+	// codes count as attempts, missing codes fail
+	_, err = verifier.Confirm(ctx, profile, code)
+
+	assert.ErrorIs(t, err, ErrInvalidVerification)
+	assert.Equal(t, []any{profile.ID, issued}, verifications.Last("FindPending"))
+
+	verifications.Pending = verification
+
+	_, err = verifier.Confirm(ctx, profile, "x"+code)
+
+	assert.ErrorIs(t, err, ErrInvalidVerification)
+	assert.Equal(t, []any{verification.ID, issued, 2}, verifications.Last("Attempt"))
+
+	// codes of a previous number fail without an attempt
+	var moved = *profile
+	moved.PhoneE164 = "+442079460958"
+
+	_, err = verifier.Confirm(ctx, &moved, code)
+
+	assert.ErrorIs(t, err, ErrInvalidVerification)
+	assert.Len(t, verifications.Calls("Attempt"), 1)
+
+	// codes used meanwhile fail
+	_, err = verifier.Confirm(ctx, profile, code)
+
+	assert.ErrorIs(t, err, ErrInvalidVerification)
+	assert.Equal(t, []any{verification.ID, issued}, verifications.Last("Confirm"))
+	assert.Len(t, verifications.Calls("Attempt"), 2)
+
+	// codes out of attempts are not compared
+	verifications.Fail("Attempt", common.ErrNotFound)
+
+	_, err = verifier.Confirm(ctx, profile, code)
+
+	assert.ErrorIs(t, err, ErrInvalidVerification)
+	assert.Len(t, verifications.Calls("Confirm"), 1)
+
+	var verified = *profile
+	verified.PhoneVerified = issued
+	verifications.Confirmed = &verified
+	confirmed, err := verifier.Confirm(ctx, profile, " "+code+" ")
+
+	assert.NoError(t, err)
+	assert.False(t, confirmed.PhoneVerified.IsZero())
+	assert.Len(t, verifications.Calls("Attempt"), 4)
+
+	// verified numbers are not texted again, the same number typed differently stays verified
+	verification, err = verifier.Request(ctx, confirmed)
+
+	assert.NoError(t, err)
+	assert.Nil(t, verification)
+	assert.Len(t, sender.Sent(), 1)
+
+	confirmed.Phone = "+1 202 555 0143"
+
+	assert.NoError(t, verifier.Apply(confirmed))
+	assert.False(t, confirmed.PhoneVerified.IsZero())
+
+	confirmed.Phone = "+44 20 7946 0958"
+
+	assert.NoError(t, verifier.Apply(confirmed))
+	assert.Equal(t, "+442079460958", confirmed.PhoneE164)
+	assert.True(t, confirmed.PhoneVerified.IsZero())
+
+	confirmed.Phone = "call me"
+
+	var violations validation.Errors
+
+	assert.True(t, errors.As(verifier.Apply(confirmed), &violations))
+	assert.Equal(t, []string{"phone: phone"}, violations.Details())
+	assert.Equal(t, "+442079460958", confirmed.PhoneE164)
+
+	confirmed.Phone = " "
+
+	assert.NoError(t, verifier.Apply(confirmed))
+	assert.Empty(t, confirmed.PhoneE164)
+
+	number, err := verifier.Number("202-555-0143")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "+12025550143", number)
+
+	// without a sender numbers are normalized but not verified
+	var disabled = NewPhoneVerifier(verifications, parser, nil, DefaultPhoneConfig())
+
+	assert.False(t, disabled.Enabled())
+
+	_, err = disabled.Request(ctx, profile)
+
+	assert.ErrorIs(t, err, ErrSMSDisabled)
+
+	_, err = disabled.Confirm(ctx, profile, code)
+
+	assert.ErrorIs(t, err, ErrSMSDisabled)
+
+	slog.Info("TestPhoneVerifier success")
+}
+
+func TestPhoneVerifierThrottle(t *testing.T) {
+	var ctx = context.Background()
+	var profile = &model.Profile{Login: "jsmith", PhoneE164: "+12025550143"}
+	profile.ID = uuid.New()
+
+	var verifications = &repotest.PhoneVerifications{}
+	var sender = phone.NewMemorySender()
+	var parser, _ = phone.NewParser("US")
+	var verifier = NewPhoneVerifier(verifications, parser, sender, DefaultPhoneConfig())
+	var issued = time.Now().UTC().Truncate(time.Second)
+
+	verifier.now = func() time.Time { return issued }
+
+	_, err := verifier.Request(ctx, profile)
+
+	assert.NoError(t, err)
+
+	// the limits are checked by the repository while it stores the code
+	assert.Equal(t, repository.PhoneLimits{ResendAfter: time.Minute, HourlyLimit: 5}, verifications.Last("Create")[1])
+
+	verifications.Fail("Create", repository.ErrTooFrequent)
+
+	_, err = verifier.Request(ctx, profile)
+
+	assert.ErrorIs(t, err, ErrTooFrequent)
+	assert.Len(t, sender.Sent(), 1)
+
+	slog.Info("TestPhoneVerifierThrottle success")
+}
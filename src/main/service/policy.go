@@ -0,0 +1,83 @@
+package service
+
+import (
+	"cabinet/src/main/auth"
+	"cabinet/src/main/model/interfaces"
+	"cabinet/src/main/repository/common"
+	"errors"
+
+	"github.com/uptrace/bun"
+)
+
+// Action operation on an owned entity decided by a Policy
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionRead   Action = "read"
+	ActionWrite  Action = "write"
+	ActionDelete Action = "delete"
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+// Policy decides what a viewer may do with profiles and attachments
+type Policy interface {
+	// Can reports whether the viewer may perform the action on the entity
+	Can(viewer auth.Viewer, action Action, entity interfaces.Owned) bool
+	// Readable narrows a listing to the rows the viewer may read, ownerColumn holds the owner profile id
+	Readable(viewer auth.Viewer, ownerColumn string) common.Filter
+}
+
+// OwnerPolicy admins and owners may do anything, others may only read public entities.
+// New entities have no owner yet, so only admins create profiles.
+type OwnerPolicy struct{}
+
+var _ Policy = OwnerPolicy{}
+
+func DefaultPolicy() Policy {
+	return OwnerPolicy{}
+}
+
+func (OwnerPolicy) Can(viewer auth.Viewer, action Action, entity interfaces.Owned) bool {
+	switch {
+	case viewer.Admin:
+		return true
+	case !viewer.IsAnonymous() && entity.GetOwnerId() == viewer.ID:
+		return true
+	default:
+		return action == ActionRead && !entity.IsPrivate()
+	}
+}
+
+func (OwnerPolicy) Readable(viewer auth.Viewer, ownerColumn string) common.Filter {
+	if viewer.Admin {
+		return nil
+	}
+
+	return func(query *bun.SelectQuery) *bun.SelectQuery {
+		if viewer.IsAnonymous() {
+			return query.Where("?TableAlias.private IS FALSE")
+		}
+		return query.Where("(?TableAlias.private IS FALSE OR ?TableAlias.? = ?)", bun.Ident(ownerColumn), viewer.ID)
+	}
+}
+
+// Authorize nil when the policy allows the action. Stored entities the viewer may not read are
+// reported as common.ErrNotFound so private entities stay hidden, denied changes as
+// ErrUnauthenticated to anonymous viewers and as ErrForbidden otherwise.
+func Authorize(policy Policy, viewer auth.Viewer, action Action, entity interfaces.Owned) error {
+	switch {
+	case policy.Can(viewer, action, entity):
+		return nil
+	case action == ActionRead || (action != ActionCreate && !policy.Can(viewer, ActionRead, entity)):
+		return common.ErrNotFound
+	case viewer.IsAnonymous():
+		return ErrUnauthenticated
+	default:
+		return ErrForbidden
+	}
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"cabinet/src/main/auth"
+	"cabinet/src/main/model"
+	"cabinet/src/main/model/interfaces"
+	"cabinet/src/main/repository/common"
+	"context"
+	"database/sql"
+	"log/slog"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// viewerContext ctx of a request authenticated as the profile, with the admin role when admin is set
+func viewerContext(id uuid.UUID, admin bool) context.Context {
+	var claims = &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: uuid.NewString()}}
+
+	if admin {
+		claims.RealmAccess.Roles = []string{auth.AdminRole}
+	}
+
+	var profile = &model.Profile{}
+	profile.ID = id
+
+	return auth.WithProfile(auth.WithClaims(context.Background(), claims), profile)
+}
+
+func TestPolicy(t *testing.T) {
+	var owner = uuid.New()
+	var policy = DefaultPolicy()
+
+	var viewers = map[string]auth.Viewer{
+		"anonymous": {},
+		"owner":     {ID: owner},
+		"other":     {ID: uuid.New()},
+		"admin":     {ID: uuid.New(), Admin: true},
+	}
+
+	var entities = func(private bool) map[string]interfaces.Owned {
+		var profile = &model.Profile{Private: private}
+		profile.ID = owner
+
+		return map[string]interfaces.Owned{
+			"profile":    profile,
+			"attachment": &model.Attachment{UserID: owner, Private: private},
+		}
+	}
+
+	for _, tc := range []struct {
+		viewer  string
+		private bool
+		action  Action
+		err     error
+	}{
+		{"anonymous", true, ActionCreate, ErrUnauthenticated},
+		{"anonymous", false, ActionRead, nil},
+		{"anonymous", false, ActionWrite, ErrUnauthenticated},
+		{"anonymous", false, ActionDelete, ErrUnauthenticated},
+		{"anonymous", true, ActionRead, common.ErrNotFound},
+		{"anonymous", true, ActionWrite, common.ErrNotFound},
+		{"anonymous", true, ActionDelete, common.ErrNotFound},
+		{"owner", true, ActionCreate, nil},
+		{"owner", false, ActionRead, nil},
+		{"owner", false, ActionWrite, nil},
+		{"owner", false, ActionDelete, nil},
+		{"owner", true, ActionRead, nil},
+		{"owner", true, ActionWrite, nil},
+		{"owner", true, ActionDelete, nil},
+		{"other", true, ActionCreate, ErrForbidden},
+		{"other", false, ActionRead, nil},
+		{"other", false, ActionWrite, ErrForbidden},
+		{"other", false, ActionDelete, ErrForbidden},
+		{"other", true, ActionRead, common.ErrNotFound},
+		{"other", true, ActionWrite, common.ErrNotFound},
+		{"other", true, ActionDelete, common.ErrNotFound},
+		{"admin", true, ActionCreate, nil},
+		{"admin", false, ActionRead, nil},
+		{"admin", false, ActionWrite, nil},
+		{"admin", false, ActionDelete, nil},
+		{"admin", true, ActionRead, nil},
+		{"admin", true, ActionWrite, nil},
+		{"admin", true, ActionDelete, nil},
+	} {
+		for kind, entity := range entities(tc.private) {
+			var name = tc.viewer + " " + string(tc.action) + " " + kind
+			var viewer = viewers[tc.viewer]
+
+			if tc.private {
+				name = name + " private"
+			}
+
+			assert.Equal(t, tc.err == nil, policy.Can(viewer, tc.action, entity), name)
+
+			if tc.err == nil {
+				assert.NoError(t, Authorize(policy, viewer, tc.action, entity), name)
+			} else {
+				assert.ErrorIs(t, Authorize(policy, viewer, tc.action, entity), tc.err, name)
+			}
+		}
+	}
+
+	// a new profile has no owner, only admins create profiles
+	assert.ErrorIs(t, Authorize(policy, viewers["other"], ActionCreate, &model.Profile{Private: true}), ErrForbidden)
+	assert.True(t, policy.Can(viewers["admin"], ActionCreate, &model.Profile{Private: true}))
+
+	slog.Info("TestPolicy success")
+}
+
+func TestPolicyReadable(t *testing.T) {
+	var db = bun.NewDB(&sql.DB{}, pgdialect.New())
+	var policy = DefaultPolicy()
+	var viewer = uuid.MustParse("00000000-0000-4000-8000-000000000001")
+
+	var selected = func(filter common.Filter) string {
+		query := db.NewSelect().Model((*model.Attachment)(nil)).Column("id")
+
+		if filter != nil {
+			query = filter(query)
+		}
+
+		return query.String()
+	}
+
+	assert.Contains(t, selected(policy.Readable(auth.Viewer{}, "user_id")),
+		`WHERE ("attachment".private IS FALSE)`)
+	assert.Contains(t, selected(policy.Readable(auth.Viewer{ID: viewer}, "user_id")),
+		`WHERE (("attachment".private IS FALSE OR "attachment"."user_id" = '00000000-0000-4000-8000-000000000001'))`)
+	assert.NotContains(t, selected(policy.Readable(auth.Viewer{ID: viewer, Admin: true}, "user_id")), "private")
+
+	assert.Equal(t, auth.Viewer{}, auth.ViewerFrom(context.Background()))
+	assert.Equal(t, auth.Viewer{ID: viewer}, auth.ViewerFrom(viewerContext(viewer, false)))
+	assert.Equal(t, auth.Viewer{ID: viewer, Admin: true}, auth.ViewerFrom(viewerContext(viewer, true)))
+
+	slog.Info("TestPolicyReadable success")
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"cabinet/src/main/auth"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/repository/common"
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrPrimaryEmail    = errors.New("the primary email can not be removed")
+	ErrUnverifiedEmail = errors.New("email is not verified")
+)
+
+// ProfileService manages the addresses of profiles. New addresses are verified by mail before they may
+// become the primary one. Every method acts for the viewer of ctx, see auth.ViewerFrom, as the policy allows.
+type ProfileService struct {
+	profiles repository.IProfileRepository
+	emails   repository.IProfileEmailRepository
+	verifier *EmailVerifier
+	policy   Policy
+}
+
+func NewProfileService(profiles repository.IProfileRepository, emails repository.IProfileEmailRepository, verifier *EmailVerifier, policy Policy) *ProfileService {
+	return &ProfileService{profiles: profiles, emails: emails, verifier: verifier, policy: policy}
+}
+
+// Emails addresses of the profile, the primary one first
+func (s *ProfileService) Emails(ctx context.Context, profileID uuid.UUID) ([]*model.ProfileEmail, error) {
+	if _, err := s.find(ctx, profileID, ActionRead); err != nil {
+		return nil, err
+	}
+
+	return s.emails.ListByProfileID(ctx, profileID)
+}
+
+// AddEmail adds an unverified secondary address and mails its verification. An address the profile has or
+// another profile owns, in any case, fails with common.UniqueViolationError. Unverified copies of other
+// profiles are removed once the address is verified.
+func (s *ProfileService) AddEmail(ctx context.Context, profileID uuid.UUID, email string) (*model.ProfileEmail, error) {
+	profile, err := s.find(ctx, profileID, ActionWrite)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var address = &model.ProfileEmail{ProfileID: profile.ID, Email: normalizeEmail(email)}
+
+	if err = s.verifier.available(ctx, profile.ID, address.Email, "Email"); err != nil {
+		return nil, err
+	}
+
+	if err = s.emails.Create(ctx, address); err != nil {
+		return nil, err
+	}
+
+	if _, err = s.verifier.RequestSecondary(ctx, profile, address); err != nil {
+		return nil, err
+	}
+
+	return address, nil
+}
+
+// RemoveEmail deletes a secondary address, the primary one fails with ErrPrimaryEmail
+func (s *ProfileService) RemoveEmail(ctx context.Context, profileID uuid.UUID, emailID uuid.UUID) error {
+	_, address, err := s.findEmail(ctx, profileID, emailID)
+
+	if err != nil {
+		return err
+	}
+
+	if address.Primary {
+		return ErrPrimaryEmail
+	}
+
+	return s.emails.Delete(ctx, address.ID)
+}
+
+// VerifyEmail mails a new verification of the address, nil when it is verified already
+func (s *ProfileService) VerifyEmail(ctx context.Context, profileID uuid.UUID, emailID uuid.UUID) (*model.EmailVerification, error) {
+	profile, address, err := s.findEmail(ctx, profileID, emailID)
+
+	switch {
+	case err != nil:
+		return nil, err
+	case address.IsVerified():
+		return nil, nil
+	case address.Primary:
+		return s.verifier.Request(ctx, profile, address.Email)
+	default:
+		return s.verifier.RequestSecondary(ctx, profile, address)
+	}
+}
+
+// MakePrimary makes a verified address the PrimaryEmail of the profile, the previous one stays as
+// a secondary address. Unverified addresses fail with ErrUnverifiedEmail, addresses another profile verified
+// meanwhile with the common.UniqueViolationError of Email.
+func (s *ProfileService) MakePrimary(ctx context.Context, profileID uuid.UUID, emailID uuid.UUID) (*model.ProfileEmail, error) {
+	profile, address, err := s.findEmail(ctx, profileID, emailID)
+
+	switch {
+	case err != nil:
+		return nil, err
+	case !address.IsVerified():
+		return nil, ErrUnverifiedEmail
+	case address.Primary:
+		return address, nil
+	}
+
+	profile.PrimaryEmail = address.Email
+	profile.EmailVerified = address.Verified
+
+	if err = s.profiles.Update(ctx, profile); err != nil {
+		return nil, addressTaken(err)
+	}
+
+	address.Primary = true
+
+	return address, nil
+}
+
+// addressTaken reports an address verified by another profile as the Email of the address, profile writes
+// report it as the PrimaryEmail of the profile
+func addressTaken(err error) error {
+	var uniqueErr *common.UniqueViolationError
+
+	if errors.As(err, &uniqueErr) && uniqueErr.Constraint == "profile_emails_email_key" {
+		return &common.UniqueViolationError{Field: "Email", Constraint: uniqueErr.Constraint, Err: uniqueErr.Err}
+	}
+
+	return err
+}
+
+// find profile the viewer may perform the action on
+func (s *ProfileService) find(ctx context.Context, profileID uuid.UUID, action Action) (*model.Profile, error) {
+	profile, err := s.profiles.FindById(ctx, profileID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = Authorize(s.policy, auth.ViewerFrom(ctx), action, profile); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// findEmail address of a profile the viewer may change, addresses of other profiles are common.ErrNotFound
+func (s *ProfileService) findEmail(ctx context.Context, profileID uuid.UUID, emailID uuid.UUID) (*model.Profile, *model.ProfileEmail, error) {
+	profile, err := s.find(ctx, profileID, ActionWrite)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	address, err := s.emails.FindById(ctx, emailID)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if address.ProfileID != profile.ID {
+		return nil, nil, common.ErrNotFound
+	}
+
+	return profile, address, nil
+}
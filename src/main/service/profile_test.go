@@ -0,0 +1,121 @@
+package service
+
+import (
+	"cabinet/src/main/auth"
+	"cabinet/src/main/mail"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/repository/repotest"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileService(t *testing.T) {
+	var profile = &model.Profile{Login: "jsmith", PrimaryEmail: "john@smith.com", EmailVerified: time.Now().UTC()}
+	profile.ID = uuid.New()
+	var other = &model.Profile{Login: "jdoe", PrimaryEmail: "john@doe.com"}
+	other.ID = uuid.New()
+	var primary = &model.ProfileEmail{ProfileID: profile.ID, Email: "john@smith.com", Verified: profile.EmailVerified, Primary: true}
+	primary.ID = uuid.New()
+	var foreign = &model.ProfileEmail{ProfileID: other.ID, Email: "john@doe.com", Primary: true}
+	foreign.ID = uuid.New()
+
+	var profiles = repotest.NewProfiles(profile, other)
+	var emails = repotest.NewEmails(primary, foreign)
+	var verifications = &repotest.EmailVerifications{}
+	var mailer = mail.NewMemoryMailer("cabinet@example.com")
+	var verifier = NewEmailVerifier(verifications, emails, mailer, DefaultVerificationConfig())
+	var service = NewProfileService(profiles, emails, verifier, DefaultPolicy())
+
+	var owner = auth.WithProfile(context.Background(), profile)
+	var stranger = auth.WithProfile(context.Background(), other)
+
+	added, err := service.AddEmail(owner, profile.ID, " J.Smith@Acme.com")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "j.smith@acme.com", added.Email)
+	assert.False(t, added.IsVerified())
+	assert.Equal(t, "j.smith@acme.com", emails.Last("Create")[0].(model.ProfileEmail).Email)
+	assert.False(t, verifications.Last("Create")[0].(model.EmailVerification).Primary)
+	assert.Len(t, mailer.Sent(), 1)
+
+	emails.Emails = append(emails.Emails, added)
+
+	// addresses other profiles own are refused before they are stored, in any case
+	var uniqueErr *common.UniqueViolationError
+
+	_, err = service.AddEmail(owner, profile.ID, "JOHN@doe.com")
+
+	assert.True(t, errors.As(err, &uniqueErr))
+	assert.Equal(t, "Email", uniqueErr.Field)
+	assert.Equal(t, []any{"john@doe.com"}, emails.Last("FindByEmail"))
+
+	emails.Fail("Create", &common.UniqueViolationError{Field: "Email", Constraint: "profile_emails_profile_email_key"})
+
+	_, err = service.AddEmail(owner, profile.ID, "j.smith@acme.com")
+
+	assert.True(t, errors.As(err, &uniqueErr))
+	assert.Len(t, emails.Calls("Create"), 2)
+	assert.Len(t, mailer.Sent(), 1)
+
+	_, err = service.AddEmail(stranger, profile.ID, "jsmith@example.com")
+
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	listed, err := service.Emails(owner, profile.ID)
+
+	assert.NoError(t, err)
+	assert.Len(t, listed, 2)
+	assert.Equal(t, []any{profile.ID}, emails.Last("ListByProfileID"))
+
+	// unverified addresses are not promoted but mailed a new token
+	_, err = service.MakePrimary(owner, profile.ID, added.ID)
+
+	assert.ErrorIs(t, err, ErrUnverifiedEmail)
+
+	verification, err := service.VerifyEmail(owner, profile.ID, added.ID)
+
+	assert.NoError(t, err)
+	assert.False(t, verification.Primary)
+	assert.Len(t, mailer.Sent(), 2)
+
+	// the verified address becomes the primary one of the profile
+	added.Verified = time.Now().UTC()
+
+	promoted, err := service.MakePrimary(owner, profile.ID, added.ID)
+
+	assert.NoError(t, err)
+	assert.True(t, promoted.Primary)
+	assert.Equal(t, "j.smith@acme.com", profiles.Last("Update")[0].(model.Profile).PrimaryEmail)
+	assert.Equal(t, added.Verified, profiles.Last("Update")[0].(model.Profile).EmailVerified)
+
+	// an address another profile verified meanwhile is reported as the address, not the primary email
+	profiles.Fail("Update", &common.UniqueViolationError{Field: "PrimaryEmail", Constraint: "profile_emails_email_key"})
+
+	_, err = service.MakePrimary(owner, profile.ID, added.ID)
+
+	assert.ErrorAs(t, err, &uniqueErr)
+	assert.Equal(t, "Email", uniqueErr.Field)
+
+	verification, err = service.VerifyEmail(owner, profile.ID, added.ID)
+
+	assert.NoError(t, err)
+	assert.Nil(t, verification)
+	assert.Len(t, mailer.Sent(), 2)
+
+	// the primary address is kept, addresses of other profiles are hidden
+	assert.ErrorIs(t, service.RemoveEmail(owner, profile.ID, primary.ID), ErrPrimaryEmail)
+	assert.ErrorIs(t, service.RemoveEmail(owner, profile.ID, foreign.ID), common.ErrNotFound)
+	assert.ErrorIs(t, service.RemoveEmail(stranger, profile.ID, added.ID), ErrForbidden)
+	assert.Empty(t, emails.Calls("Delete"))
+	assert.NoError(t, service.RemoveEmail(owner, profile.ID, added.ID))
+	assert.Equal(t, []any{added.ID}, emails.Last("Delete"))
+
+	slog.Info("TestProfileService success")
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"cabinet/src/main/auth"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/repository/common"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sizes of the synced columns, longer names are truncated and longer emails dropped
+const (
+	maxLoginLength = 50
+	maxEmailLength = 50
+	maxNameLength  = 100
+)
+
+// Profile fields synced from identity claims, keys of Profile.IdentitySync
+const (
+	SyncLogin     = "login"
+	SyncEmail     = "primary_email"
+	SyncFirstName = "fist_name"
+	SyncLastName  = "last_name"
+)
+
+// syncedField profile field fed by an identity claim
+type syncedField struct {
+	name   string
+	unique string // UniqueViolationError.Field of the column, empty when not unique
+	claim  func(claims *auth.Claims) string
+	field  func(profile *model.Profile) *string
+}
+
+var syncedFields = []syncedField{
+	{SyncLogin, "Login", func(c *auth.Claims) string { return truncate(c.PreferredUsername, maxLoginLength) }, func(p *model.Profile) *string { return &p.Login }},
+	{SyncEmail, "PrimaryEmail", emailClaim, func(p *model.Profile) *string { return &p.PrimaryEmail }},
+	{SyncFirstName, "", func(c *auth.Claims) string { return truncate(c.GivenName, maxNameLength) }, func(p *model.Profile) *string { return &p.FistName }},
+	{SyncLastName, "", func(c *auth.Claims) string { return truncate(c.FamilyName, maxNameLength) }, func(p *model.Profile) *string { return &p.LastName }},
+}
+
+// emailClaim address confirmed by the identity provider, unverified addresses count as absent
+func emailClaim(claims *auth.Claims) string {
+	if !claims.EmailVerified || len(claims.Email) > maxEmailLength {
+		return ""
+	}
+	return strings.ToLower(claims.Email)
+}
+
+// Provisioner creates the profile of an identity on its first request and keeps the
+// claim fed fields in sync afterwards, see Resolve
+type Provisioner struct {
+	profiles repository.IProfileRepository
+}
+
+func NewProvisioner(profiles repository.IProfileRepository) *Provisioner {
+	return &Provisioner{profiles: profiles}
+}
+
+// Resolve profile of the token subject, provisioned when missing and synced when claims changed.
+// A failed sync is logged and the stored profile returned, the next request retries it.
+func (p *Provisioner) Resolve(ctx context.Context, claims *auth.Claims) (*model.Profile, error) {
+	externalID, err := claims.ExternalID()
+
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := p.profiles.FindByExternalID(ctx, externalID)
+
+	if errors.Is(err, common.ErrNotFound) {
+		return p.provision(ctx, externalID, claims)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = p.sync(ctx, found, claims); err != nil {
+		slog.Warn("Syncing profile claims failed", slog.String("profile", found.ID.String()), slog.Any("err", err))
+
+		return p.profiles.FindByExternalID(ctx, externalID)
+	}
+
+	return found, nil
+}
+
+// provision creates a private profile from the claims. A taken login falls back to
+// login-<subject prefix>, then to the subject itself, a taken email is left empty.
+// Concurrent provisioning of the same subject returns the profile stored first.
+func (p *Provisioner) provision(ctx context.Context, externalID uuid.UUID, claims *auth.Claims) (*model.Profile, error) {
+	var profile = &model.Profile{ExternalID: externalID, Private: true, IdentitySync: map[string]model.ClaimSync{}}
+	var logins = loginCandidates(claims.PreferredUsername, externalID)
+
+	for _, synced := range syncedFields {
+		*synced.field(profile) = synced.claim(claims)
+	}
+
+	profile.Login = logins[0]
+
+	for {
+		for _, synced := range syncedFields {
+			profile.IdentitySync[synced.name] = model.ClaimSync{Claim: synced.claim(claims), Value: *synced.field(profile)}
+		}
+
+		profile.EmailVerified = time.Time{}
+
+		if profile.PrimaryEmail != "" {
+			profile.EmailVerified = time.Now().UTC()
+		}
+
+		err := p.profiles.Create(ctx, profile)
+
+		var uniqueErr *common.UniqueViolationError
+
+		if !errors.As(err, &uniqueErr) {
+			if err != nil {
+				return nil, err
+			}
+			return profile, nil
+		}
+
+		switch {
+		case uniqueErr.Field == "ExternalID":
+			return p.profiles.FindByExternalID(ctx, externalID)
+		case uniqueErr.Field == "PrimaryEmail" && profile.PrimaryEmail != "":
+			profile.PrimaryEmail = ""
+		case uniqueErr.Field == "Login" && len(logins) > 1:
+			logins = logins[1:]
+			profile.Login = logins[0]
+		default:
+			return nil, err
+		}
+	}
+}
+
+// sync applies changed claims to fields still holding the value of their last sync.
+// A change colliding with another profile is skipped until the claim changes again.
+// An address taken from the claims counts as verified by the identity provider.
+func (p *Provisioner) sync(ctx context.Context, profile *model.Profile, claims *auth.Claims) error {
+	var changed = false
+	var email, verified = profile.PrimaryEmail, profile.EmailVerified
+	var applied = map[string]appliedClaim{} // by unique field, reverted on collision
+
+	if profile.IdentitySync == nil {
+		profile.IdentitySync = map[string]model.ClaimSync{}
+	}
+
+	for _, synced := range syncedFields {
+		var claim = synced.claim(claims)
+		var field = synced.field(profile)
+		previous, seen := profile.IdentitySync[synced.name]
+
+		if seen && previous.Claim == claim {
+			continue
+		}
+
+		changed = true
+
+		switch {
+		case !seen:
+			// linked before provisioning, the local value wins until the claim changes
+			profile.IdentitySync[synced.name] = model.ClaimSync{Claim: claim, Value: *field}
+		case claim == "" || *field != previous.Value:
+			// a dropped claim keeps the data, a local edit keeps the field
+			profile.IdentitySync[synced.name] = model.ClaimSync{Claim: claim, Value: previous.Value}
+		default:
+			if synced.unique != "" {
+				applied[synced.unique] = appliedClaim{field: synced, previous: *field}
+			}
+
+			*field = claim
+			profile.IdentitySync[synced.name] = model.ClaimSync{Claim: claim, Value: claim}
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	for {
+		if profile.PrimaryEmail != email {
+			profile.EmailVerified = time.Now().UTC()
+		} else {
+			profile.EmailVerified = verified
+		}
+
+		err := p.profiles.Update(ctx, profile)
+
+		var uniqueErr *common.UniqueViolationError
+
+		if !errors.As(err, &uniqueErr) {
+			return err
+		}
+
+		reverted, ok := applied[uniqueErr.Field]
+
+		if !ok {
+			return err
+		}
+
+		delete(applied, uniqueErr.Field)
+
+		*reverted.field.field(profile) = reverted.previous
+		profile.IdentitySync[reverted.field.name] = model.ClaimSync{Claim: reverted.field.claim(claims), Value: reverted.previous}
+	}
+}
+
+// appliedClaim unique field set from a claim and its value before
+type appliedClaim struct {
+	field    syncedField
+	previous string
+}
+
+// loginCandidates logins tried in order, derived only from the claims so every instance picks the same
+func loginCandidates(username string, externalID uuid.UUID) []string {
+	var subject = externalID.String()
+
+	if username == "" {
+		return []string{subject}
+	}
+
+	var suffix = "-" + subject[:8]
+
+	return []string{
+		truncate(username, maxLoginLength),
+		truncate(username, maxLoginLength-len(suffix)) + suffix,
+		subject,
+	}
+}
+
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	return strings.ToValidUTF8(value[:length], "")
+}
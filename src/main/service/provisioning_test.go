@@ -0,0 +1,192 @@
+package service
+
+import (
+	"cabinet/src/main/auth"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/repository/repotest"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	loginTaken        = &common.UniqueViolationError{Field: "Login", Constraint: "profiles_login_key"}
+	primaryEmailTaken = &common.UniqueViolationError{Field: "PrimaryEmail", Constraint: "profile_emails_email_key"}
+)
+
+func newIdentityClaims(subject uuid.UUID, username string, email string) *auth.Claims {
+	return &auth.Claims{
+		RegisteredClaims:  jwt.RegisteredClaims{Subject: subject.String()},
+		PreferredUsername: username,
+		Email:             email,
+		EmailVerified:     true,
+		GivenName:         "John",
+		FamilyName:        "Smith",
+	}
+}
+
+func TestProvisionProfile(t *testing.T) {
+	var ctx = context.Background()
+	var repo = repotest.NewProfiles()
+	var provisioner = NewProvisioner(repo)
+	var subject = uuid.New()
+
+	profile, err := provisioner.Resolve(ctx, newIdentityClaims(subject, "jsmith", "John@Smith.com"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, subject, profile.ExternalID)
+	assert.Equal(t, "jsmith", profile.Login)
+	assert.Equal(t, "john@smith.com", profile.PrimaryEmail)
+	assert.False(t, profile.EmailVerified.IsZero())
+	assert.Equal(t, "John", profile.FistName)
+	assert.Equal(t, "Smith", profile.LastName)
+	assert.True(t, profile.Private)
+	assert.Equal(t, model.ClaimSync{Claim: "jsmith", Value: "jsmith"}, profile.IdentitySync[SyncLogin])
+
+	repo.Profiles = []*model.Profile{profile}
+
+	again, err := provisioner.Resolve(ctx, newIdentityClaims(subject, "jsmith", "John@Smith.com"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, profile.ID, again.ID)
+	assert.Equal(t, int64(1), again.Version)
+	assert.Len(t, repo.Calls("Create"), 1)
+	assert.Empty(t, repo.Calls("Update"))
+
+	// another identity with the same username and email, the fallbacks derive from its subject
+	var other = uuid.MustParse("1a2b3c4d-0000-4000-8000-000000000000")
+	repo.Fail("Create", loginTaken, primaryEmailTaken)
+
+	collided, err := provisioner.Resolve(ctx, newIdentityClaims(other, "jsmith", "john@smith.com"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "jsmith-1a2b3c4d", collided.Login)
+	assert.Empty(t, collided.PrimaryEmail)
+	assert.True(t, collided.EmailVerified.IsZero())
+	assert.Equal(t, model.ClaimSync{Claim: "jsmith", Value: "jsmith-1a2b3c4d"}, collided.IdentitySync[SyncLogin])
+	assert.Len(t, repo.Calls("Create"), 4)
+
+	var third = uuid.MustParse("1a2b3c4d-1111-4000-8000-000000000000")
+	repo.Fail("Create", loginTaken, loginTaken)
+
+	collided, err = provisioner.Resolve(ctx, newIdentityClaims(third, "jsmith", ""))
+
+	assert.NoError(t, err)
+	assert.Equal(t, third.String(), collided.Login)
+
+	repo.Fail("Create", loginTaken, loginTaken, loginTaken)
+
+	_, err = provisioner.Resolve(ctx, newIdentityClaims(uuid.New(), "jsmith", ""))
+
+	assert.ErrorIs(t, err, loginTaken)
+
+	// addresses the identity provider did not verify are left out
+	var unverified = newIdentityClaims(uuid.New(), "jdoe", "john@doe.com")
+	unverified.EmailVerified = false
+
+	collided, err = provisioner.Resolve(ctx, unverified)
+
+	assert.NoError(t, err)
+	assert.Empty(t, collided.PrimaryEmail)
+
+	// a concurrent request provisioned the subject between lookup and insert
+	var racing = &model.Profile{Login: "racer", ExternalID: uuid.New()}
+	racing.ID = uuid.New()
+	repo.Profiles = []*model.Profile{racing}
+	repo.Fail("FindByExternalID", common.ErrNotFound)
+	repo.Fail("Create", &common.UniqueViolationError{Field: "ExternalID", Constraint: "profiles_external_id_key"})
+
+	resolved, err := provisioner.Resolve(ctx, newIdentityClaims(racing.ExternalID, "racer2", ""))
+
+	assert.NoError(t, err)
+	assert.Equal(t, racing.ID, resolved.ID)
+
+	slog.Info("TestProvisionProfile success")
+}
+
+func TestSyncProfileClaims(t *testing.T) {
+	var ctx = context.Background()
+	var repo = repotest.NewProfiles()
+	var provisioner = NewProvisioner(repo)
+	var subject = uuid.New()
+	var claims = newIdentityClaims(subject, "jsmith", "john@smith.com")
+
+	profile, err := provisioner.Resolve(ctx, claims)
+	assert.NoError(t, err)
+
+	// the user edits the last name locally
+	profile.LastName = "Smith-Jones"
+	profile.Version++
+	repo.Profiles = []*model.Profile{profile}
+
+	claims.GivenName = "Johnny"
+	claims.FamilyName = "Smythe"
+	claims.Email = ""
+
+	profile, err = provisioner.Resolve(ctx, claims)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Johnny", profile.FistName)
+	assert.Equal(t, "Smith-Jones", profile.LastName)
+	assert.Equal(t, "john@smith.com", profile.PrimaryEmail)
+	assert.Equal(t, model.ClaimSync{Claim: "Smythe", Value: "Smith"}, profile.IdentitySync[SyncLastName])
+
+	// a username taken by another profile is skipped, the rest of the claims still apply
+	repo.Profiles = []*model.Profile{profile}
+	repo.Fail("Update", loginTaken)
+
+	claims.PreferredUsername = "john"
+	claims.GivenName = "Jon"
+
+	profile, err = provisioner.Resolve(ctx, claims)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "jsmith", profile.Login)
+	assert.Equal(t, "Jon", profile.FistName)
+	assert.Equal(t, model.ClaimSync{Claim: "john", Value: "jsmith"}, profile.IdentitySync[SyncLogin])
+	assert.Equal(t, "john", repo.Calls("Update")[1].Args[0].(model.Profile).Login)
+	assert.Equal(t, "jsmith", repo.Calls("Update")[2].Args[0].(model.Profile).Login)
+
+	repo.Profiles = []*model.Profile{profile}
+
+	again, err := provisioner.Resolve(ctx, claims)
+
+	assert.NoError(t, err)
+	assert.Equal(t, profile.Version, again.Version)
+	assert.Len(t, repo.Calls("Update"), 3)
+
+	// a changed address is verified by the identity provider
+	var verified = profile.EmailVerified
+	claims.Email = "jsmith@acme.com"
+
+	profile, err = provisioner.Resolve(ctx, claims)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "jsmith@acme.com", profile.PrimaryEmail)
+	assert.True(t, profile.EmailVerified.After(verified))
+
+	// profiles linked before provisioning keep their values until a claim changes
+	var linked = &model.Profile{Login: "legacy", FistName: "Old", ExternalID: uuid.New()}
+	linked.ID = uuid.New()
+	repo.Profiles = []*model.Profile{linked}
+
+	profile, err = provisioner.Resolve(ctx, newIdentityClaims(linked.ExternalID, "legacy-kc", ""))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy", profile.Login)
+	assert.Equal(t, "Old", profile.FistName)
+
+	repo.Profiles = []*model.Profile{profile}
+
+	profile, err = provisioner.Resolve(ctx, newIdentityClaims(linked.ExternalID, "legacy-new", ""))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy-new", profile.Login)
+
+	slog.Info("TestSyncProfileClaims success")
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/storage"
+	"context"
+	"time"
+)
+
+// PurgeRepository storage of soft deleted rows referencing blobs, see common.ISoftDeleteRepository
+type PurgeRepository interface {
+	Purge(ctx context.Context, before time.Time) (*common.Purged, error)
+}
+
+// BlobPurger purges soft deleted rows together with the blobs they referenced, avatar renditions included,
+// see job.Purger
+type BlobPurger struct {
+	repo  PurgeRepository
+	blobs storage.BlobStore
+}
+
+func NewBlobPurger(repo PurgeRepository, blobs storage.BlobStore) *BlobPurger {
+	return &BlobPurger{repo: repo, blobs: blobs}
+}
+
+// Purge hard deletes the rows deleted before the time, then their blobs. Blobs failing to delete are
+// logged and stay orphaned, the rows are gone already.
+func (p *BlobPurger) Purge(ctx context.Context, before time.Time) (int64, error) {
+	purged, err := p.repo.Purge(ctx, before)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var keys = purged.Blobs
+
+	for _, avatar := range purged.Avatars {
+		keys = append(keys, renditionKeys(avatar)...)
+	}
+
+	discard(ctx, p.blobs, keys...)
+
+	return purged.Count, nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/repository/repotest"
+	"cabinet/src/main/storage"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlobPurger(t *testing.T) {
+	var ctx = context.Background()
+	var blobs = storage.NewMemoryStore()
+	var purgedKey, keptKey = uuid.New(), uuid.New()
+
+	for _, key := range []uuid.UUID{purgedKey, keptKey} {
+		_, err := blobs.Put(ctx, key, strings.NewReader("content"), 7, "text/plain")
+		assert.NoError(t, err)
+	}
+
+	var repo = repotest.NewAttachments()
+	repo.Purged = common.Purged{Count: 1, Blobs: []uuid.UUID{purgedKey}}
+
+	var purger = NewBlobPurger(repo, blobs)
+	var before = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	count, err := purger.Purge(ctx, before)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, []any{before}, repo.Last("Purge"))
+	assert.Equal(t, []uuid.UUID{keptKey}, blobs.Keys())
+
+	// blobs stay when the rows do
+	var failure = errors.New("purge failed")
+	repo.Purged = common.Purged{Count: 1, Blobs: []uuid.UUID{keptKey}}
+	repo.Fail("Purge", failure)
+
+	_, err = purger.Purge(ctx, before)
+
+	assert.ErrorIs(t, err, failure)
+	assert.Equal(t, []uuid.UUID{keptKey}, blobs.Keys())
+
+	// purged profiles take the renditions of their avatars along
+	var avatar = uuid.New()
+
+	for _, key := range renditionKeys(avatar) {
+		_, err = blobs.Put(ctx, key, strings.NewReader("content"), 7, "image/png")
+		assert.NoError(t, err)
+	}
+
+	var profiles = repotest.NewProfiles()
+	profiles.Purged = common.Purged{Count: 1, Avatars: []uuid.UUID{avatar}}
+
+	count, err = NewBlobPurger(profiles, blobs).Purge(ctx, before)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Len(t, renditionKeys(avatar), len(AvatarSizes)+1)
+	assert.Equal(t, []uuid.UUID{keptKey}, blobs.Keys())
+
+	slog.Info("TestBlobPurger success")
+}
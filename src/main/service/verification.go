@@ -0,0 +1,247 @@
+package service
+
+import (
+	"cabinet/src/main/mail"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/repository/common"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Environment variables read by VerificationConfigFromEnv
+const (
+	VerifyURLEnv    = "CABINET_VERIFY_URL"
+	VerifyTTLEnv    = "CABINET_VERIFY_TTL"
+	VerifySecretEnv = "CABINET_VERIFY_SECRET"
+)
+
+// tokenBytes entropy of a verification token
+const tokenBytes = 32
+
+var ErrInvalidVerification = errors.New("verification token is invalid, used or expired")
+
+// VerificationConfig email verification settings
+type VerificationConfig struct {
+	URL string        // page confirming the token, the mail links it with a token query parameter, the bare token is mailed when empty
+	TTL time.Duration // validity of a token
+	// Secret keys the stored token and code hashes, shared by all instances. Random per process when empty,
+	// pending verifications then fail after a restart.
+	Secret []byte
+}
+
+func DefaultVerificationConfig() VerificationConfig {
+	return VerificationConfig{TTL: 24 * time.Hour}
+}
+
+// VerificationConfigFromEnv DefaultVerificationConfig overridden by CABINET_VERIFY_* environment variables
+func VerificationConfigFromEnv() (VerificationConfig, error) {
+	var cfg = DefaultVerificationConfig()
+
+	cfg.URL = os.Getenv(VerifyURLEnv)
+	cfg.Secret = []byte(os.Getenv(VerifySecretEnv))
+
+	if value, ok := os.LookupEnv(VerifyTTLEnv); ok {
+		ttl, err := time.ParseDuration(value)
+
+		if err != nil || ttl <= 0 {
+			return cfg, fmt.Errorf("%s: must be a positive duration, got %q", VerifyTTLEnv, value)
+		}
+
+		cfg.TTL = ttl
+	}
+
+	if cfg.URL != "" {
+		if _, err := url.Parse(cfg.URL); err != nil {
+			return cfg, fmt.Errorf("%s: %w", VerifyURLEnv, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// EmailVerifier confirms addresses of profiles, primary addresses before they become the PrimaryEmail.
+// Tokens are mailed once and stored as HMAC-SHA256 hashes keyed by the Secret, they are single use and expire.
+type EmailVerifier struct {
+	verifications repository.IEmailVerificationRepository
+	emails        repository.IProfileEmailRepository
+	mailer        mail.Mailer
+	cfg           VerificationConfig
+	now           func() time.Time
+}
+
+func NewEmailVerifier(verifications repository.IEmailVerificationRepository, emails repository.IProfileEmailRepository, mailer mail.Mailer, cfg VerificationConfig) *EmailVerifier {
+	cfg.Secret = newSecret(cfg.Secret)
+
+	return &EmailVerifier{verifications: verifications, emails: emails, mailer: mailer, cfg: cfg, now: time.Now}
+}
+
+// Available fails with common.UniqueViolationError when another profile than the given one owns the address, in any
+// case. Unverified secondary copies do not own it.
+func (v *EmailVerifier) Available(ctx context.Context, profileID uuid.UUID, email string) error {
+	return v.available(ctx, profileID, email, "PrimaryEmail")
+}
+
+// available like Available with the field reported by the common.UniqueViolationError
+func (v *EmailVerifier) available(ctx context.Context, profileID uuid.UUID, email string, field string) error {
+	owner, err := v.emails.FindByEmail(ctx, normalizeEmail(email))
+
+	switch {
+	case errors.Is(err, common.ErrNotFound):
+		return nil
+	case err != nil:
+		return err
+	case owner.ProfileID != profileID:
+		return &common.UniqueViolationError{Field: field, Constraint: "profile_emails_email_key"}
+	default:
+		return nil
+	}
+}
+
+// Request mails a token making the address the PrimaryEmail of the profile once confirmed, earlier primary
+// tokens of the profile stop working. Returns nil when the address already is the verified PrimaryEmail.
+func (v *EmailVerifier) Request(ctx context.Context, profile *model.Profile, email string) (*model.EmailVerification, error) {
+	email = normalizeEmail(email)
+
+	if email == profile.PrimaryEmail && !profile.EmailVerified.IsZero() {
+		return nil, nil
+	}
+
+	if err := v.Available(ctx, profile.ID, email); err != nil {
+		return nil, err
+	}
+
+	return v.send(ctx, profile, email, true)
+}
+
+// RequestSecondary mails a token verifying a secondary address of the profile, see ProfileService.AddEmail
+func (v *EmailVerifier) RequestSecondary(ctx context.Context, profile *model.Profile, address *model.ProfileEmail) (*model.EmailVerification, error) {
+	return v.send(ctx, profile, address.Email, false)
+}
+
+func (v *EmailVerifier) send(ctx context.Context, profile *model.Profile, email string, primary bool) (*model.EmailVerification, error) {
+	token, err := newToken()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var now = v.now().UTC()
+	var verification = &model.EmailVerification{
+		ProfileID: profile.ID,
+		Email:     email,
+		TokenHash: hashToken(v.cfg.Secret, token),
+		Expires:   now.Add(v.cfg.TTL),
+		Primary:   primary,
+	}
+
+	verification.Created = now
+
+	if err = v.verifications.Create(ctx, verification); err != nil {
+		return nil, err
+	}
+
+	if err = v.mailer.Send(ctx, v.message(profile, email, token, primary)); err != nil {
+		return nil, fmt.Errorf("sending verification mail: %w", err)
+	}
+
+	return verification, nil
+}
+
+// Pending latest primary verification of the profile still waiting for its token, nil when there is none
+func (v *EmailVerifier) Pending(ctx context.Context, profileID uuid.UUID) (*model.EmailVerification, error) {
+	verification, err := v.verifications.FindPending(ctx, profileID, v.now().UTC())
+
+	if errors.Is(err, common.ErrNotFound) {
+		return nil, nil
+	}
+
+	return verification, err
+}
+
+// Confirm marks the address of the token verified, the address of a primary token becomes the PrimaryEmail
+// of its profile. Unknown, used and expired tokens and removed addresses fail with ErrInvalidVerification.
+func (v *EmailVerifier) Confirm(ctx context.Context, token string) (*model.Profile, error) {
+	if token == "" {
+		return nil, ErrInvalidVerification
+	}
+
+	profile, err := v.verifications.Confirm(ctx, hashToken(v.cfg.Secret, token), v.now().UTC())
+
+	if errors.Is(err, common.ErrNotFound) {
+		return nil, ErrInvalidVerification
+	}
+
+	return profile, err
+}
+
+func (v *EmailVerifier) message(profile *model.Profile, email string, token string, primary bool) mail.Message {
+	var confirm = token
+
+	if v.cfg.URL != "" {
+		link, _ := url.Parse(v.cfg.URL)
+		query := link.Query()
+		query.Set("token", token)
+		link.RawQuery = query.Encode()
+		confirm = link.String()
+	}
+
+	var body strings.Builder
+
+	body.WriteString("Hello " + profile.Login + ",\n\n")
+	if primary {
+		body.WriteString("please confirm " + email + " as the primary email of your profile:\n\n")
+	} else {
+		body.WriteString("please confirm " + email + " as an email of your profile:\n\n")
+	}
+
+	body.WriteString(confirm + "\n\n")
+	body.WriteString("The confirmation expires in " + v.cfg.TTL.String() + ". Ignore this mail if you did not ask for it.\n")
+
+	return mail.Message{To: email, Subject: "Confirm your email address", Body: body.String()}
+}
+
+// newToken random URL safe token, only its hash is stored
+func newToken() (string, error) {
+	var token = make([]byte, tokenBytes)
+
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// newSecret the secret, a random one when it is empty
+func newSecret(secret []byte) []byte {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, _ = rand.Read(secret)
+	}
+
+	return secret
+}
+
+// hashToken hex HMAC-SHA256 of the token, a leaked table is worthless without the secret
+func hashToken(secret []byte, token string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// normalizeEmail addresses are stored lower case like the ones provisioned from claims
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"cabinet/src/main/mail"
+	"cabinet/src/main/model"
+	"cabinet/src/main/repository/common"
+	"cabinet/src/main/repository/repotest"
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailVerifier(t *testing.T) {
+	var ctx = context.Background()
+	var profile = &model.Profile{Login: "jsmith", PrimaryEmail: "john@smith.com"}
+	profile.ID = uuid.New()
+	var taken = &model.ProfileEmail{ProfileID: uuid.New(), Email: "john@doe.com", Primary: true}
+
+	var emails = repotest.NewEmails(taken)
+	var verifications = &repotest.EmailVerifications{}
+	var mailer = mail.NewMemoryMailer("cabinet@example.com")
+	var cfg = VerificationConfig{URL: "https://cabinet.example.com/verify?lang=en", TTL: time.Hour, Secret: []byte("secret")}
+	var verifier = NewEmailVerifier(verifications, emails, mailer, cfg)
+	var issued = time.Now().UTC().Truncate(time.Second)
+
+	verifier.now = func() time.Time { return issued }
+
+	verification, err := verifier.Request(ctx, profile, " Jsmith@Acme.com ")
+
+	// stored times come from the clock of the verifier
+	assert.NoError(t, err)
+	assert.Equal(t, "jsmith@acme.com", verification.Email)
+	assert.True(t, verification.Primary)
+	assert.Equal(t, issued, verification.Created)
+	assert.Equal(t, issued.Add(time.Hour), verification.Expires)
+	assert.Equal(t, issued.Add(time.Hour), verifications.Last("Create")[0].(model.EmailVerification).Expires)
+	assert.Equal(t, []any{"jsmith@acme.com"}, emails.Last("FindByEmail"))
+
+	message, _ := mailer.Last()
+	link, err := url.Parse(message.Body[strings.Index(message.Body, "https://"):strings.Index(message.Body, "\n\nThe confirmation")])
+
+	assert.NoError(t, err)
+	assert.Equal(t, "jsmith@acme.com", message.To)
+	assert.Equal(t, "en", link.Query().Get("lang"))
+
+	// only the hash keyed by the secret is stored
+	var token = link.Query().Get("token")
+
+	assert.Len(t, verification.TokenHash, 64)
+	assert.NotContains(t, verification.TokenHash, token)
+	assert.Equal(t, hashToken([]byte("secret"), token), verification.TokenHash)
+	assert.NotEqual(t, hashToken([]byte("other"), token), verification.TokenHash)
+
+	verifications.Pending = verification
+
+	pending, err := verifier.Pending(ctx, profile.ID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "jsmith@acme.com", pending.Email)
+	assert.Equal(t, []any{profile.ID, issued}, verifications.Last("FindPending"))
+
+	verifications.Pending = nil
+
+	pending, err = verifier.Pending(ctx, profile.ID)
+
+	assert.NoError(t, err)
+	assert.Nil(t, pending)
+
+	// tokens are confirmed by their hash, unknown, used and expired ones fail
+	_, err = verifier.Confirm(ctx, token)
+
+	assert.ErrorIs(t, err, ErrInvalidVerification)
+	assert.Equal(t, []any{hashToken([]byte("secret"), token), issued}, verifications.Last("Confirm"))
+
+	var confirmed = *profile
+	confirmed.PrimaryEmail = "jsmith@acme.com"
+	confirmed.EmailVerified = issued
+	verifications.Confirmed = &confirmed
+
+	found, err := verifier.Confirm(ctx, token)
+
+	assert.NoError(t, err)
+	assert.Equal(t, confirmed, *found)
+
+	_, err = verifier.Confirm(ctx, "")
+
+	assert.ErrorIs(t, err, ErrInvalidVerification)
+	assert.Len(t, verifications.Calls("Confirm"), 2)
+
+	// verified addresses are not mailed again, taken ones are refused
+	verification, err = verifier.Request(ctx, &confirmed, "jsmith@acme.com")
+
+	assert.NoError(t, err)
+	assert.Nil(t, verification)
+	assert.Len(t, mailer.Sent(), 1)
+
+	var uniqueErr *common.UniqueViolationError
+
+	_, err = verifier.Request(ctx, &confirmed, "John@Doe.com")
+
+	assert.True(t, errors.As(err, &uniqueErr))
+	assert.Equal(t, "PrimaryEmail", uniqueErr.Field)
+	assert.Len(t, mailer.Sent(), 1)
+	assert.NoError(t, verifier.Available(ctx, taken.ProfileID, "john@doe.com"))
+
+	slog.Info("TestEmailVerifier success")
+}
+
+func TestVerificationConfigFromEnv(t *testing.T) {
+	t.Setenv(VerifyURLEnv, "https://cabinet.example.com/verify")
+	t.Setenv(VerifyTTLEnv, "30m")
+	t.Setenv(VerifySecretEnv, "secret")
+
+	cfg, err := VerificationConfigFromEnv()
+
+	assert.NoError(t, err)
+	assert.Equal(t, VerificationConfig{URL: "https://cabinet.example.com/verify", TTL: 30 * time.Minute, Secret: []byte("secret")}, cfg)
+
+	t.Setenv(VerifyTTLEnv, "-1h")
+
+	_, err = VerificationConfigFromEnv()
+
+	assert.ErrorContains(t, err, VerifyTTLEnv)
+
+	slog.Info("TestVerificationConfigFromEnv success")
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var _ BlobStore = (*FSStore)(nil)
+
+// FSStore objects in a local directory for development and tests, content types are kept in
+// <key>.json sidecars. Presigned URLs are file URLs, the expiry is informational only.
+type FSStore struct {
+	root string
+}
+
+type fsMeta struct {
+	ContentType string `json:"contentType"`
+	ETag        string `json:"etag"`
+}
+
+func NewFSStore(root string) (*FSStore, error) {
+	root, err := filepath.Abs(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(root, 0o750); err != nil {
+		return nil, err
+	}
+
+	return &FSStore{root: root}, nil
+}
+
+func (f *FSStore) Put(ctx context.Context, key uuid.UUID, content io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var path = f.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+
+	// written to a temporary file first, readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	var hash = md5.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hash), contextReader{ctx: ctx, reader: content})
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = checkSize(size, written)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var meta = fsMeta{ContentType: contentTypeOrDefault(contentType), ETag: hex.EncodeToString(hash.Sum(nil))}
+	encoded, err := json.Marshal(meta)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.WriteFile(path+".json", encoded, 0o640); err != nil {
+		return nil, err
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	return f.Stat(ctx, key)
+}
+
+func (f *FSStore) Get(ctx context.Context, key uuid.UUID) (io.ReadCloser, *ObjectInfo, error) {
+	info, err := f.Stat(ctx, key)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(f.path(key))
+
+	if err != nil {
+		return nil, nil, translateFSError(err)
+	}
+
+	return file, info, nil
+}
+
+func (f *FSStore) Stat(ctx context.Context, key uuid.UUID) (*ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var path = f.path(key)
+
+	stat, err := os.Stat(path)
+
+	if err != nil {
+		return nil, translateFSError(err)
+	}
+
+	var meta = fsMeta{ContentType: DefaultContentType}
+
+	if encoded, err := os.ReadFile(path + ".json"); err == nil {
+		if err = json.Unmarshal(encoded, &meta); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Key:         key,
+		Size:        stat.Size(),
+		ContentType: meta.ContentType,
+		ETag:        meta.ETag,
+		Modified:    stat.ModTime().UTC(),
+	}, nil
+}
+
+func (f *FSStore) Delete(ctx context.Context, key uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var path = f.path(key)
+
+	for _, name := range []string{path, path + ".json"} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *FSStore) Presign(ctx context.Context, key uuid.UUID, expiry time.Duration) (*url.URL, error) {
+	if _, err := f.Stat(ctx, key); err != nil {
+		return nil, err
+	}
+
+	var query = url.Values{"expires": {strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)}}
+
+	return &url.URL{Scheme: "file", Path: filepath.ToSlash(f.path(key)), RawQuery: query.Encode()}, nil
+}
+
+// path spreads objects over 256 directories by the key prefix
+func (f *FSStore) path(key uuid.UUID) string {
+	var name = key.String()
+	return filepath.Join(f.root, name[:2], name)
+}
+
+func translateFSError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// contextReader stops a copy once the context is done
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.reader.Read(p)
+}
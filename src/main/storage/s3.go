@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config S3 compatible endpoint, e.g. s3.amazonaws.com or minio:9000
+type S3Config struct {
+	Endpoint  string
+	Region    string // set to presign without a bucket location request
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Secure    bool // https
+}
+
+var _ BlobStore = (*S3Store)(nil)
+
+// S3Store objects of one bucket keyed by the uuid string
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New(S3BucketEnv + ": bucket is required")
+	}
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.Secure,
+		Region: cfg.Region,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Store{client: client, bucket: cfg.Bucket}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key uuid.UUID, content io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	upload, err := s.client.PutObject(ctx, s.bucket, key.String(), content, size,
+		minio.PutObjectOptions{ContentType: contentTypeOrDefault(contentType)})
+
+	if err != nil {
+		return nil, translateS3Error(err)
+	}
+
+	return &ObjectInfo{
+		Key:         key,
+		Size:        upload.Size,
+		ContentType: contentTypeOrDefault(contentType),
+		ETag:        upload.ETag,
+		Modified:    upload.LastModified,
+	}, nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key uuid.UUID) (io.ReadCloser, *ObjectInfo, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key.String(), minio.GetObjectOptions{})
+
+	if err != nil {
+		return nil, nil, translateS3Error(err)
+	}
+
+	// GetObject is lazy, Stat issues the request and reports a missing object
+	stat, err := object.Stat()
+
+	if err != nil {
+		_ = object.Close()
+		return nil, nil, translateS3Error(err)
+	}
+
+	return object, fromS3Info(key, stat), nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key uuid.UUID) (*ObjectInfo, error) {
+	stat, err := s.client.StatObject(ctx, s.bucket, key.String(), minio.StatObjectOptions{})
+
+	if err != nil {
+		return nil, translateS3Error(err)
+	}
+
+	return fromS3Info(key, stat), nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key uuid.UUID) error {
+	return translateS3Error(s.client.RemoveObject(ctx, s.bucket, key.String(), minio.RemoveObjectOptions{}))
+}
+
+func (s *S3Store) Presign(ctx context.Context, key uuid.UUID, expiry time.Duration) (*url.URL, error) {
+	presigned, err := s.client.PresignedGetObject(ctx, s.bucket, key.String(), expiry, nil)
+
+	if err != nil {
+		return nil, translateS3Error(err)
+	}
+
+	return presigned, nil
+}
+
+func fromS3Info(key uuid.UUID, stat minio.ObjectInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Key:         key,
+		Size:        stat.Size,
+		ContentType: stat.ContentType,
+		ETag:        stat.ETag,
+		Modified:    stat.LastModified,
+	}
+}
+
+// translateS3Error maps missing keys to ErrNotFound
+func translateS3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	response := minio.ToErrorResponse(err)
+
+	if response.Code == "NoSuchKey" || response.StatusCode == http.StatusNotFound && response.Code != "NoSuchBucket" {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	return err
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Environment variables read by ConfigFromEnv
+const (
+	BackendEnv     = "CABINET_STORAGE"
+	DirEnv         = "CABINET_STORAGE_DIR"
+	S3EndpointEnv  = "CABINET_S3_ENDPOINT"
+	S3RegionEnv    = "CABINET_S3_REGION"
+	S3BucketEnv    = "CABINET_S3_BUCKET"
+	S3AccessKeyEnv = "CABINET_S3_ACCESS_KEY"
+	S3SecretKeyEnv = "CABINET_S3_SECRET_KEY"
+	S3SecureEnv    = "CABINET_S3_SECURE"
+)
+
+// Backends selected by CABINET_STORAGE
+const (
+	BackendS3     = "s3"
+	BackendFS     = "fs"
+	BackendMemory = "memory"
+)
+
+// DefaultContentType stored when Put is given no content type
+const DefaultContentType = "application/octet-stream"
+
+var (
+	ErrNotFound     = errors.New("blob not found")
+	ErrSizeMismatch = errors.New("blob size does not match the declared size")
+)
+
+// ObjectInfo stored blob attributes
+type ObjectInfo struct {
+	Key         uuid.UUID
+	Size        int64
+	ContentType string
+	ETag        string
+	Modified    time.Time
+}
+
+// BlobStore object storage addressed by the S3Key and Avatar ids of the models.
+// Missing objects are reported as ErrNotFound, Delete of a missing object succeeds.
+type BlobStore interface {
+	// Put streams the content, size -1 when unknown, replacing an existing object
+	Put(ctx context.Context, key uuid.UUID, content io.Reader, size int64, contentType string) (*ObjectInfo, error)
+	// Get opens the content, the caller closes it
+	Get(ctx context.Context, key uuid.UUID) (io.ReadCloser, *ObjectInfo, error)
+	Stat(ctx context.Context, key uuid.UUID) (*ObjectInfo, error)
+	Delete(ctx context.Context, key uuid.UUID) error
+	// Presign URL granting a download of the object until the expiry passes
+	Presign(ctx context.Context, key uuid.UUID, expiry time.Duration) (*url.URL, error)
+}
+
+// Config blob store selection and settings
+type Config struct {
+	Backend string // s3, fs or memory
+	Dir     string // root of the fs backend
+	S3      S3Config
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Backend: BackendFS,
+		Dir:     "data/blobs",
+		S3:      S3Config{Secure: true},
+	}
+}
+
+// ConfigFromEnv DefaultConfig overridden by CABINET_STORAGE* and CABINET_S3_* environment variables
+func ConfigFromEnv() (Config, error) {
+	var cfg = DefaultConfig()
+
+	for env, dest := range map[string]*string{
+		BackendEnv:     &cfg.Backend,
+		DirEnv:         &cfg.Dir,
+		S3EndpointEnv:  &cfg.S3.Endpoint,
+		S3RegionEnv:    &cfg.S3.Region,
+		S3BucketEnv:    &cfg.S3.Bucket,
+		S3AccessKeyEnv: &cfg.S3.AccessKey,
+		S3SecretKeyEnv: &cfg.S3.SecretKey,
+	} {
+		if value, ok := os.LookupEnv(env); ok {
+			*dest = value
+		}
+	}
+
+	if value, ok := os.LookupEnv(S3SecureEnv); ok {
+		secure, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", S3SecureEnv, err)
+		}
+
+		cfg.S3.Secure = secure
+	}
+
+	return cfg, nil
+}
+
+// New opens the blob store selected by cfg
+func New(cfg Config) (BlobStore, error) {
+	switch cfg.Backend {
+	case BackendS3:
+		return NewS3Store(cfg.S3)
+	case BackendFS:
+		return NewFSStore(cfg.Dir)
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("%s: unknown storage backend %q, expected s3, fs or memory", BackendEnv, cfg.Backend)
+	}
+}
+
+// NewFromEnv opens the blob store configured by ConfigFromEnv
+func NewFromEnv() (BlobStore, error) {
+	cfg, err := ConfigFromEnv()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return New(cfg)
+}
+
+func contentTypeOrDefault(contentType string) string {
+	if contentType == "" {
+		return DefaultContentType
+	}
+	return contentType
+}
+
+// checkSize fails when a declared size differs from the written byte count
+func checkSize(declared int64, written int64) error {
+	if declared >= 0 && declared != written {
+		return fmt.Errorf("%w: declared %d, got %d", ErrSizeMismatch, declared, written)
+	}
+	return nil
+}
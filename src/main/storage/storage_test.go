@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlobStores(t *testing.T) {
+	fsStore, err := NewFSStore(t.TempDir())
+	assert.NoError(t, err)
+
+	for name, store := range map[string]BlobStore{"memory": NewMemoryStore(), "fs": fsStore} {
+		t.Run(name, func(t *testing.T) {
+			var ctx = context.Background()
+			var key = uuid.New()
+
+			_, err := store.Stat(ctx, key)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			info, err := store.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain")
+
+			assert.NoError(t, err)
+			assert.Equal(t, key, info.Key)
+			assert.Equal(t, int64(5), info.Size)
+			assert.Equal(t, "text/plain", info.ContentType)
+			assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", info.ETag)
+
+			content, info, err := store.Get(ctx, key)
+
+			assert.NoError(t, err)
+			data, _ := io.ReadAll(content)
+			_ = content.Close()
+			assert.Equal(t, "hello", string(data))
+			assert.Equal(t, "text/plain", info.ContentType)
+
+			// replaced object, unknown size, default content type
+			info, err = store.Put(ctx, key, strings.NewReader("bye"), -1, "")
+
+			assert.NoError(t, err)
+			assert.Equal(t, int64(3), info.Size)
+			assert.Equal(t, DefaultContentType, info.ContentType)
+
+			presigned, err := store.Presign(ctx, key, time.Minute)
+
+			assert.NoError(t, err)
+			assert.NotEmpty(t, presigned.Query().Get("expires"))
+
+			_, err = store.Put(ctx, uuid.New(), strings.NewReader("short"), 10, "")
+			assert.ErrorIs(t, err, ErrSizeMismatch)
+
+			assert.NoError(t, store.Delete(ctx, key))
+			assert.NoError(t, store.Delete(ctx, key))
+
+			_, _, err = store.Get(ctx, key)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			_, err = store.Presign(ctx, key, time.Minute)
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+
+	slog.Info("TestBlobStores success")
+}
+
+func TestS3Store(t *testing.T) {
+	_, err := NewS3Store(S3Config{Endpoint: "localhost:9000"})
+	assert.Error(t, err)
+
+	store, err := NewS3Store(S3Config{Endpoint: "localhost:9000", Region: "us-east-1", Bucket: "cabinet",
+		AccessKey: "access", SecretKey: "secret"})
+	assert.NoError(t, err)
+
+	// presigning is local when the region is configured
+	var key = uuid.New()
+	presigned, err := store.Presign(context.Background(), key, time.Hour)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:9000", presigned.Host)
+	assert.Equal(t, "/cabinet/"+key.String(), presigned.Path)
+	assert.Equal(t, "3600", presigned.Query().Get("X-Amz-Expires"))
+
+	assert.ErrorIs(t, translateS3Error(minio.ErrorResponse{Code: "NoSuchKey", StatusCode: http.StatusNotFound}), ErrNotFound)
+	assert.NotErrorIs(t, translateS3Error(minio.ErrorResponse{Code: "NoSuchBucket", StatusCode: http.StatusNotFound}), ErrNotFound)
+	assert.NoError(t, translateS3Error(nil))
+
+	slog.Info("TestS3Store success")
+}
+
+func TestStorageConfigFromEnv(t *testing.T) {
+	t.Setenv(BackendEnv, BackendMemory)
+	t.Setenv(S3SecureEnv, "false")
+
+	cfg, err := ConfigFromEnv()
+
+	assert.NoError(t, err)
+	assert.Equal(t, BackendMemory, cfg.Backend)
+	assert.False(t, cfg.S3.Secure)
+
+	store, err := New(cfg)
+
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, store)
+
+	_, err = New(Config{Backend: "tape"})
+	assert.Error(t, err)
+
+	slog.Info("TestStorageConfigFromEnv success")
+}
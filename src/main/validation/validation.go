@@ -0,0 +1,389 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/schema"
+)
+
+// Tag struct tag of the field rules, comma separated, rules after dive apply to slice elements:
+//
+//	required   not empty, not nil
+//	min=N      at least N characters, or elements
+//	max=N      at most N characters, or elements
+//	email      a bare address, empty passes unless required
+//	e164       a phone number like +12025550143, empty passes unless required
+//	dive       following rules check every element
+//
+// Fields of bun models are also limited by their type:varchar(N) and varchar(N)[] columns.
+const Tag = "validate"
+
+var ErrInvalid = errors.New("validation failed")
+
+// Violation rule a field failed, Path names the field by its json name, or column of bun models,
+// with [i] for slice elements and dots for nested structs, e.g. email[1] or address.city
+type Violation struct {
+	Path  string
+	Rule  string
+	Param string
+}
+
+// String machine readable path: rule, e.g. login: required or primary_email: max=50
+func (v Violation) String() string {
+	if v.Param == "" {
+		return v.Path + ": " + v.Rule
+	}
+	return v.Path + ": " + v.Rule + "=" + v.Param
+}
+
+// Errors every violation of a validated value, matches ErrInvalid
+type Errors []Violation
+
+func (e Errors) Error() string {
+	return ErrInvalid.Error() + ": " + strings.Join(e.Details(), "; ")
+}
+
+func (e Errors) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+// Details violations as ErrorDto details
+func (e Errors) Details() []string {
+	var details = make([]string, 0, len(e))
+
+	for _, violation := range e {
+		details = append(details, violation.String())
+	}
+
+	return details
+}
+
+// Validate checks the struct, or pointer to struct, against its rules. Returns nil or Errors with all violations.
+func Validate(value any) error {
+	var v = reflect.ValueOf(value)
+
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var violations Errors
+
+	validateStruct(v, "", &violations)
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return violations
+}
+
+type rule struct {
+	name  string
+	param string
+	limit int
+}
+
+// field rules of a struct field, nested structs are validated by their own rules
+type field struct {
+	index []int
+	path  string
+	rules []rule
+	each  []rule
+}
+
+var (
+	fieldsCache sync.Map // reflect.Type to []field
+	tables      = schema.NewTables(pgdialect.New())
+	baseModel   = reflect.TypeOf(bun.BaseModel{})
+	varchar     = regexp.MustCompile(`(?i)^varchar\((\d+)\)(\[\])?$`)
+	e164        = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+)
+
+func validateStruct(v reflect.Value, prefix string, violations *Errors) {
+	for _, f := range fieldsOf(v.Type()) {
+		value, ok := fieldByIndex(v, f.index)
+		path := prefix + f.path
+
+		if !ok {
+			// nil embedded pointer, its fields are as empty as the pointer
+			value = reflect.Value{}
+		}
+
+		validateValue(value, path, f.rules, violations)
+
+		value = indirect(value)
+
+		if !value.IsValid() {
+			continue
+		}
+
+		switch value.Kind() {
+		case reflect.Struct:
+			validateStruct(value, path+".", violations)
+		case reflect.Slice, reflect.Array:
+			if len(f.each) == 0 && indirectType(value.Type().Elem()).Kind() != reflect.Struct {
+				continue
+			}
+
+			for i := 0; i < value.Len(); i++ {
+				element := value.Index(i)
+				elementPath := path + "[" + strconv.Itoa(i) + "]"
+
+				validateValue(element, elementPath, f.each, violations)
+
+				if element = indirect(element); element.IsValid() && element.Kind() == reflect.Struct {
+					validateStruct(element, elementPath+".", violations)
+				}
+			}
+		}
+	}
+}
+
+func validateValue(value reflect.Value, path string, rules []rule, violations *Errors) {
+	for _, r := range rules {
+		if !check(r, value) {
+			*violations = append(*violations, Violation{Path: path, Rule: r.name, Param: r.param})
+		}
+	}
+}
+
+func check(r rule, value reflect.Value) bool {
+	value = indirect(value)
+
+	if r.name == "required" {
+		return value.IsValid() && !value.IsZero() && (!hasLength(value) || value.Len() > 0)
+	}
+
+	if !value.IsValid() {
+		return true
+	}
+
+	switch r.name {
+	case "min":
+		return length(value) >= r.limit
+	case "max":
+		return length(value) <= r.limit
+	case "email":
+		return value.Kind() != reflect.String || value.String() == "" || isEmail(value.String())
+	case "e164":
+		return value.Kind() != reflect.String || value.String() == "" || e164.MatchString(value.String())
+	}
+
+	return true
+}
+
+func isEmail(value string) bool {
+	address, err := mail.ParseAddress(value)
+	return err == nil && address.Address == value
+}
+
+// length characters of strings, elements of collections, the value of integers
+func length(value reflect.Value) int {
+	switch value.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(value.String())
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return value.Len()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(value.Uint())
+	}
+	return 0
+}
+
+func hasLength(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+func indirect(value reflect.Value) reflect.Value {
+	for value.IsValid() && (value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+// fieldByIndex like reflect.Value.FieldByIndex without panicking on nil embedded pointers
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 {
+			if v = indirect(v); !v.IsValid() {
+				return v, false
+			}
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := fieldsCache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var fields []field
+
+	if isModel(t) {
+		fields = modelFields(t)
+	} else {
+		fields = structFields(t, nil)
+	}
+
+	fieldsCache.Store(t, fields)
+
+	return fields
+}
+
+// isModel reports whether the struct is a bun model, see bun.BaseModel
+func isModel(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type == baseModel {
+			return true
+		}
+	}
+	return false
+}
+
+// modelFields rules of the columns named by their SQL name, relations are not validated
+func modelFields(t reflect.Type) []field {
+	var table = tables.Get(t)
+	var fields = make([]field, 0, len(table.Fields))
+
+	for _, column := range table.Fields {
+		rules, each := parseRules(t, column.StructField)
+
+		if matches := varchar.FindStringSubmatch(column.UserSQLType); matches != nil {
+			limit, _ := strconv.Atoi(matches[1])
+
+			if matches[2] == "" {
+				rules = withDefault(rules, rule{name: "max", param: matches[1], limit: limit})
+			} else {
+				each = withDefault(each, rule{name: "max", param: matches[1], limit: limit})
+			}
+		}
+
+		fields = append(fields, field{index: column.Index, path: column.Name, rules: rules, each: each})
+	}
+
+	return fields
+}
+
+// structFields rules of exported fields named by their json name, embedded structs are flattened
+func structFields(t reflect.Type, index []int) []field {
+	var fields []field
+
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+
+		if structField.Tag.Get(Tag) == "-" {
+			continue
+		}
+
+		// promoted fields like encoding/json, even of unexported embedded structs
+		if structField.Anonymous && indirectType(structField.Type).Kind() == reflect.Struct && structField.Tag.Get("json") == "" {
+			fields = append(fields, structFields(indirectType(structField.Type), fieldIndex)...)
+			continue
+		}
+
+		if !structField.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(structField.Tag.Get("json"), ",")
+
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = structField.Name
+		}
+
+		rules, each := parseRules(t, structField)
+		fields = append(fields, field{index: fieldIndex, path: name, rules: rules, each: each})
+	}
+
+	return fields
+}
+
+// parseRules rules of the field tag, panics on unknown rules like a malformed struct would
+func parseRules(t reflect.Type, structField reflect.StructField) (rules []rule, each []rule) {
+	var tag = structField.Tag.Get(Tag)
+	var dive = false
+
+	if tag == "" {
+		return nil, nil
+	}
+
+	for _, part := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		r := rule{name: name, param: param}
+
+		switch name {
+		case "dive":
+			dive = true
+			continue
+		case "required", "email", "e164":
+		case "min", "max":
+			limit, err := strconv.Atoi(param)
+
+			if err != nil {
+				panic(fmt.Sprintf("%s.%s: %s needs a number", t.Name(), structField.Name, name))
+			}
+
+			r.limit = limit
+		default:
+			panic(fmt.Sprintf("%s.%s: unknown rule %q", t.Name(), structField.Name, name))
+		}
+
+		if dive {
+			each = append(each, r)
+		} else {
+			rules = append(rules, r)
+		}
+	}
+
+	return rules, each
+}
+
+// withDefault adds the rule unless the tag set one of the same name
+func withDefault(rules []rule, r rule) []rule {
+	for _, existing := range rules {
+		if existing.name == r.name {
+			return rules
+		}
+	}
+	return append(rules, r)
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
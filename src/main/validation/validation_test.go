@@ -0,0 +1,127 @@
+package validation
+
+import (
+	"cabinet/src/main/model"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type address struct {
+	City string `json:"city" validate:"required,max=5"`
+}
+
+type named struct {
+	Name string `json:"name" validate:"min=2"`
+}
+
+type request struct {
+	named
+	Login     *string   `json:"login" validate:"min=1,max=5"`
+	Email     []string  `json:"email" validate:"max=2,dive,email"`
+	Address   address   `json:"address"`
+	Addresses []address `json:"addresses"`
+	Internal  string    `json:"-" validate:"required"`
+	Comment   string    `validate:"max=3"`
+}
+
+func violations(t *testing.T, value any) []string {
+	var errs Errors
+
+	err := Validate(value)
+
+	if err == nil {
+		return nil
+	}
+
+	assert.True(t, errors.Is(err, ErrInvalid))
+	assert.True(t, errors.As(err, &errs))
+
+	return errs.Details()
+}
+
+func TestValidateStruct(t *testing.T) {
+	var empty = ""
+	var long = "toolong"
+
+	assert.NoError(t, Validate(&request{named: named{Name: "Jo"}, Address: address{City: "Rome"}}))
+	assert.NoError(t, Validate((*request)(nil)))
+	assert.NoError(t, Validate("not a struct"))
+
+	assert.Equal(t, []string{
+		"name: min=2",
+		"login: min=1",
+		"email: max=2",
+		"email[1]: email",
+		"address.city: required",
+		"addresses[1].city: max=5",
+		"Comment: max=3",
+	}, violations(t, &request{
+		named:     named{Name: "J"},
+		Login:     &empty,
+		Email:     []string{"john@smith.com", "John <john@smith.com>", "jsmith@acme.com"},
+		Addresses: []address{{City: "Paris"}, {City: "Amsterdam"}},
+		Comment:   "long",
+	}))
+
+	assert.Equal(t, []string{"name: min=2", "login: max=5", "address.city: required"}, violations(t, request{Login: &long}))
+
+	slog.Info("TestValidateStruct success")
+}
+
+func TestValidateModel(t *testing.T) {
+	var profile = &model.Profile{
+		Login:        "jsmith",
+		PrimaryEmail: "john@smith.com",
+		Tags:         []string{"go"},
+	}
+
+	assert.NoError(t, Validate(profile))
+
+	profile.Login = ""
+	profile.FistName = strings.Repeat("й", 100) // limits count characters, not bytes
+	profile.LastName = strings.Repeat("a", 101)
+	profile.PrimaryEmail = "not an email"
+	profile.Tags = []string{strings.Repeat("t", 51)}
+
+	assert.Equal(t, []string{
+		"login: required",
+		"last_name: max=100",
+		"primary_email: email",
+		"tags[0]: max=50",
+	}, violations(t, profile))
+
+	// relations are validated on their own
+	profile.Emails = []*model.ProfileEmail{{Email: "not an email"}}
+	assert.Len(t, violations(t, profile), 4)
+
+	assert.Equal(t, []string{"email: max=50"}, violations(t, &model.ProfileEmail{Email: strings.Repeat("a", 41) + "@smith.com"}))
+
+	profile.Emails = nil
+	profile.PhoneE164 = "(202) 555-0143"
+	assert.Contains(t, violations(t, profile), "phone_e164: e164")
+
+	profile.PhoneE164 = "+12025550143"
+	assert.Len(t, violations(t, profile), 4)
+
+	assert.Equal(t, []string{"phone: required"}, violations(t, &model.PhoneVerification{}))
+	assert.Equal(t, []string{"phone: e164"}, violations(t, &model.PhoneVerification{Phone: "+0123"}))
+
+	var attachment = &model.Attachment{Title: "Report", Profile: model.Profile{}}
+	assert.NoError(t, Validate(attachment))
+
+	attachment.Title = ""
+	attachment.Name = strings.Repeat("n", 256)
+	assert.Equal(t, []string{"name: max=255", "title: required"}, violations(t, attachment))
+
+	assert.Panics(t, func() {
+		_ = Validate(struct {
+			Field string `validate:"unknown"`
+		}{})
+	})
+
+	slog.Info("TestValidateModel success")
+}
@@ -61,8 +61,11 @@ type Pagination struct {
 	PageSize uint   `json:"pageSize"`
 }
 
+// IsValidPagination the page starts inside the total, the last page may be partial.
+// The first page is always valid, it is empty when there is nothing to page.
 func IsValidPagination(pagination *Pagination) bool {
-	return pagination != nil && (uint64)((pagination.Page+1)*pagination.PageSize) <= pagination.Total
+	return pagination != nil && pagination.PageSize > 0 &&
+		(pagination.Page == 0 || (uint64)(pagination.Page*pagination.PageSize) < pagination.Total)
 }
 
 func BuildPagination(page uint, total uint64, pageSize uint) *Pagination {
@@ -85,6 +88,10 @@ type PagedResult[T any] struct {
 	ResultDto Paged[T] `json:"result"`
 }
 
+func (p *Paged[T]) Result() *PagedResult[T] {
+	return &PagedResult[T]{*p}
+}
+
 func BuildPaged[T any](entities []T, pageable *Pagination) *PagedResult[T] {
 	if !IsValidPagination(pageable) {
 		if pageable != nil {
@@ -106,8 +113,25 @@ func BuildPaged[T any](entities []T, pageable *Pagination) *PagedResult[T] {
 		return &PagedResult[T]{*paged}
 	}
 
-	paged.Entities = entities[pageable.PageSize*(pageable.Page) : pageable.PageSize*(pageable.Page+1)]
+	var start = min(pageable.PageSize*pageable.Page, uint(len(entities)))
+	var end = min(pageable.PageSize*(pageable.Page+1), uint(len(entities)))
+
+	paged.Entities = entities[start:end]
 	paged.Pageable = *pageable
 
 	return &PagedResult[T]{*paged}
 }
+
+// NewPaged wraps a page already fetched from the database
+func NewPaged[T any](entities []T, pageable Pagination) *Paged[T] {
+	if entities == nil {
+		entities = []T{}
+	}
+
+	return &Paged[T]{Entities: entities, Pageable: pageable}
+}
+
+// Offset of the first page entity
+func (p *Pagination) Offset() int {
+	return int(p.Page * p.PageSize)
+}
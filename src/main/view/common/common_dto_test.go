@@ -174,3 +174,35 @@ func TestBuildPaged(test *testing.T) {
 
 	slog.Info("TestBuildPaged success")
 }
+
+func TestBuildPagedPartialPage(test *testing.T) {
+	var indents []common.Identifiable
+
+	for i := 0; i < 5; i++ {
+		indents = append(indents, common.Identifiable{ID: uuid.New()})
+	}
+
+	assert.True(test, IsValidPagination(&Pagination{Page: 2, Total: 5, PageSize: 2}))
+	assert.True(test, IsValidPagination(&Pagination{Page: 0, Total: 0, PageSize: 2}))
+	assert.False(test, IsValidPagination(&Pagination{Page: 3, Total: 5, PageSize: 2}))
+	assert.False(test, IsValidPagination(&Pagination{Page: 0, Total: 5, PageSize: 0}))
+
+	var paged = BuildPaged[common.Identifiable](indents, BuildPagination(2, 5, 2))
+
+	assert.NotNil(test, paged)
+	assert.Equal(test, 1, len(paged.ResultDto.Entities))
+	assert.Equal(test, indents[4].ID, paged.ResultDto.Entities[0].ID)
+
+	var empty = BuildPaged[common.Identifiable](nil, BuildPagination(0, 0, 10))
+
+	assert.NotNil(test, empty)
+	assert.Empty(test, empty.ResultDto.Entities)
+
+	var page = NewPaged[common.Identifiable](nil, Pagination{Page: 1, Total: 3, PageSize: 2})
+
+	assert.NotNil(test, page.Entities)
+	assert.Equal(test, 2, page.Pageable.Offset())
+	assert.Equal(test, uint64(3), page.Result().ResultDto.Pageable.Total)
+
+	slog.Info("TestBuildPagedPartialPage success")
+}
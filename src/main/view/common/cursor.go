@@ -0,0 +1,114 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor keyset position (created, id) of a listing
+type Cursor struct {
+	Created  time.Time `json:"c"`
+	ID       uuid.UUID `json:"i"`
+	Backward bool      `json:"b,omitempty"` // page before the position
+}
+
+// CursorPage keyset page, Next and Prev are opaque signed tokens
+type CursorPage[T any] struct {
+	Entities []T    `json:"entities"`
+	Next     string `json:"next,omitempty"`
+	Prev     string `json:"prev,omitempty"`
+	PageSize uint   `json:"pageSize"`
+}
+
+type CursorPagedResult[T any] struct {
+	ResultDto CursorPage[T] `json:"result"`
+}
+
+// CursorCodec signs cursors with HMAC-SHA256 so clients cannot forge positions
+type CursorCodec struct {
+	key []byte
+}
+
+// NewCursorCodec codec signing with key, a random key is generated when key is empty
+func NewCursorCodec(key []byte) *CursorCodec {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		_, _ = rand.Read(key)
+	}
+
+	return &CursorCodec{key: key}
+}
+
+// Encode signed token of the cursor, empty for nil
+func (c *CursorCodec) Encode(cursor *Cursor) string {
+	if cursor == nil {
+		return ""
+	}
+
+	payload, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(c.sign(payload))
+}
+
+// Decode verifies the token, empty token is the first page and decodes to nil
+func (c *CursorCodec) Decode(token string) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+
+	if err != nil || !hmac.Equal(signature, c.sign(payload)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor = &Cursor{}
+
+	if err = json.Unmarshal(payload, cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+func (c *CursorCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// BuildCursorPage signs the keyset positions of a fetched page
+func BuildCursorPage[T any](entities []T, next *Cursor, prev *Cursor, pageSize uint, codec *CursorCodec) *CursorPagedResult[T] {
+	if entities == nil {
+		entities = []T{}
+	}
+
+	return &CursorPagedResult[T]{CursorPage[T]{
+		Entities: entities,
+		Next:     codec.Encode(next),
+		Prev:     codec.Encode(prev),
+		PageSize: pageSize,
+	}}
+}
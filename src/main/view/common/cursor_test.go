@@ -0,0 +1,71 @@
+package common
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursorCodec(test *testing.T) {
+	var codec = NewCursorCodec([]byte("secret"))
+	var cursor = &Cursor{Created: time.Now().UTC().Truncate(time.Microsecond), ID: uuid.New(), Backward: true}
+
+	var token = codec.Encode(cursor)
+
+	assert.NotEmpty(test, token)
+	assert.NotContains(test, token, cursor.ID.String())
+
+	decoded, err := codec.Decode(token)
+
+	assert.NoError(test, err)
+	assert.Equal(test, cursor.ID, decoded.ID)
+	assert.True(test, cursor.Created.Equal(decoded.Created))
+	assert.True(test, decoded.Backward)
+
+	decoded, err = codec.Decode("")
+
+	assert.NoError(test, err)
+	assert.Nil(test, decoded)
+	assert.Empty(test, codec.Encode(nil))
+
+	_, err = NewCursorCodec([]byte("other secret")).Decode(token)
+
+	assert.ErrorIs(test, err, ErrInvalidCursor)
+
+	payload, signature, _ := strings.Cut(token, ".")
+	forged := codec.Encode(&Cursor{Created: cursor.Created, ID: uuid.New()})
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	_, err = codec.Decode(forgedPayload + "." + signature)
+
+	assert.ErrorIs(test, err, ErrInvalidCursor)
+
+	for _, broken := range []string{payload, payload + ".", "!!." + signature, "e30." + signature} {
+		_, err = codec.Decode(broken)
+		assert.ErrorIs(test, err, ErrInvalidCursor)
+	}
+
+	slog.Info("TestCursorCodec success")
+}
+
+func TestBuildCursorPage(test *testing.T) {
+	var codec = NewCursorCodec(nil)
+	var next = &Cursor{Created: time.Now().UTC(), ID: uuid.New()}
+
+	var result = BuildCursorPage[string](nil, next, nil, 10, codec)
+
+	assert.NotNil(test, result.ResultDto.Entities)
+	assert.Empty(test, result.ResultDto.Prev)
+	assert.Equal(test, uint(10), result.ResultDto.PageSize)
+
+	decoded, err := codec.Decode(result.ResultDto.Next)
+
+	assert.NoError(test, err)
+	assert.Equal(test, next.ID, decoded.ID)
+
+	slog.Info("TestBuildCursorPage success")
+}
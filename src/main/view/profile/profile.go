@@ -0,0 +1,391 @@
+package profile
+
+import (
+	"cabinet/src/main/model"
+	"cabinet/src/main/view/common"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProfileDto public representation of model.Profile, internal columns are never exposed.
+// Fields of private profiles are omitted unless the viewer may read them, see service.Policy.
+type ProfileDto struct {
+	common.IdInfo
+	Created       *time.Time  `json:"created,omitempty"`
+	Changed       *time.Time  `json:"changed,omitempty"`
+	Version       int64       `json:"version,omitempty"` // matches the ETag header
+	Login         string      `json:"login"`
+	FirstName     string      `json:"firstName"`
+	MiddleName    string      `json:"middleName"`
+	LastName      string      `json:"lastName"`
+	FullName      string      `json:"fullName"`
+	Private       bool        `json:"private"`
+	PrimaryEmail  string      `json:"primaryEmail,omitempty"`
+	Verified      *time.Time  `json:"emailVerified,omitempty"` // when primaryEmail was confirmed, absent while unverified
+	PendingEmail  string      `json:"pendingEmail,omitempty"`  // address waiting for its confirmation, see EmailVerificationDto
+	Emails        []*EmailDto `json:"emails,omitempty"`        // all addresses, only where they were loaded
+	Phone         string      `json:"phone,omitempty"`         // as typed
+	PhoneNumber   string      `json:"phoneNumber,omitempty"`   // phone in E.164, e.g. +12025550143
+	PhoneVerified *time.Time  `json:"phoneVerified,omitempty"` // when phoneNumber was confirmed by SMS, absent while unverified
+	Tags          []string    `json:"tags,omitempty"`
+	Biography     string      `json:"biography,omitempty"`
+	Company       string      `json:"company,omitempty"`
+	Location      string      `json:"location,omitempty"`
+	Avatar        *uuid.UUID  `json:"avatar,omitempty"`
+}
+
+// ProfileShortDto profile reference for listings and relations
+type ProfileShortDto struct {
+	common.ShortNamedInfo
+	Login  string     `json:"login"`
+	Avatar *uuid.UUID `json:"avatar,omitempty"`
+}
+
+// ProfileMatchDto search result, Snippet is HTML escaped with matches wrapped in <b></b>
+type ProfileMatchDto struct {
+	Profile *ProfileDto `json:"profile"`
+	Rank    float64     `json:"rank"`
+	Snippet string      `json:"snippet"`
+}
+
+// EmailDto address of a profile, managed through /profiles/{id}/emails
+type EmailDto struct {
+	common.IdInfo
+	Email    string     `json:"email"`
+	Verified *time.Time `json:"verified,omitempty"` // absent while unverified
+	Primary  bool       `json:"primary"`
+}
+
+// AddEmailRequest body of POST /profiles/{id}/emails
+type AddEmailRequest struct {
+	Email string `json:"email" validate:"required,email,max=50"`
+}
+
+// EmailVerificationDto address mailed a confirmation token, it becomes the primary email once confirmed
+type EmailVerificationDto struct {
+	Email   string    `json:"email"`
+	Expires time.Time `json:"expires"`
+}
+
+// EmailVerificationRequest body of POST /profiles/{id}/email/verification
+type EmailVerificationRequest struct {
+	Email string `json:"email" validate:"required,email,max=50"`
+}
+
+// PhoneVerificationDto number texted a confirmation code
+type PhoneVerificationDto struct {
+	Phone   string    `json:"phone"`
+	Expires time.Time `json:"expires"`
+}
+
+// ConfirmPhoneRequest body of POST /profiles/{id}/phone/verify, the code texted by the verification
+type ConfirmPhoneRequest struct {
+	Code string `json:"code" validate:"required,max=10"`
+}
+
+// ConfirmEmailRequest body of POST /email/verify, the token mailed by the verification
+type ConfirmEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// CreateProfileRequest body of POST /profiles and PUT /profiles/{id}.
+// A new PrimaryEmail is verified before it is stored, see service.EmailVerifier.
+type CreateProfileRequest struct {
+	Login        string   `json:"login" validate:"required,max=50"`
+	FirstName    string   `json:"firstName" validate:"max=100"`
+	MiddleName   string   `json:"middleName" validate:"max=100"`
+	LastName     string   `json:"lastName" validate:"max=100"`
+	Private      *bool    `json:"private"` // true when omitted
+	PrimaryEmail string   `json:"primaryEmail" validate:"email,max=50"`
+	Phone        string   `json:"phone" validate:"max=50"`
+	Tags         []string `json:"tags" validate:"dive,required,max=50"`
+	Biography    string   `json:"biography"`
+	Company      string   `json:"company" validate:"max=100"`
+	Location     string   `json:"location" validate:"max=255"`
+}
+
+// UpdateProfileRequest body of PATCH /profiles/{id}, nil fields are left unchanged.
+// A new PrimaryEmail is verified before it is stored, see service.EmailVerifier.
+type UpdateProfileRequest struct {
+	Login        *string   `json:"login" validate:"min=1,max=50"`
+	FirstName    *string   `json:"firstName" validate:"max=100"`
+	MiddleName   *string   `json:"middleName" validate:"max=100"`
+	LastName     *string   `json:"lastName" validate:"max=100"`
+	Private      *bool     `json:"private"`
+	PrimaryEmail *string   `json:"primaryEmail" validate:"email,max=50"`
+	Phone        *string   `json:"phone" validate:"max=50"`
+	Tags         *[]string `json:"tags" validate:"dive,required,max=50"`
+	Biography    *string   `json:"biography"`
+	Company      *string   `json:"company" validate:"max=100"`
+	Location     *string   `json:"location" validate:"max=255"`
+}
+
+// Detailed decides per profile whether the viewer may read the private fields
+type Detailed func(profile *model.Profile) bool
+
+// FromProfile maps the profile, the private fields of private profiles only when detailed is set
+func FromProfile(profile *model.Profile, detailed bool) *ProfileDto {
+	if profile == nil {
+		return nil
+	}
+
+	var dto = &ProfileDto{
+		Login:      profile.Login,
+		FirstName:  profile.FistName,
+		MiddleName: profile.MiddleName,
+		LastName:   profile.LastName,
+		FullName:   profile.FullName(),
+		Private:    profile.Private,
+		Avatar:     optionalId(profile.Avatar),
+	}
+
+	dto.IdInfo.From(profile)
+
+	if profile.Private && !detailed {
+		return dto
+	}
+
+	dto.Created = optionalTime(profile.Created)
+	dto.Changed = optionalTime(profile.Changed)
+	dto.Version = profile.Version
+	dto.PrimaryEmail = profile.PrimaryEmail
+	dto.Verified = optionalTime(profile.EmailVerified)
+	dto.Emails = FromEmails(profile.Emails)
+	dto.Phone = profile.Phone
+	dto.PhoneNumber = profile.PhoneE164
+	dto.PhoneVerified = optionalTime(profile.PhoneVerified)
+	dto.Tags = profile.Tags
+	dto.Biography = profile.Biography
+	dto.Company = profile.Company
+	dto.Location = profile.Location
+
+	return dto
+}
+
+// FromProfiles maps a profile listing as seen by the viewer
+func FromProfiles(profiles []*model.Profile, detailed Detailed) []*ProfileDto {
+	var dtos = make([]*ProfileDto, 0, len(profiles))
+
+	for _, profile := range profiles {
+		dtos = append(dtos, FromProfile(profile, detailed(profile)))
+	}
+
+	return dtos
+}
+
+// FromMatches maps search results as seen by the viewer
+func FromMatches(matches []*model.ProfileMatch, detailed Detailed) []*ProfileMatchDto {
+	var dtos = make([]*ProfileMatchDto, 0, len(matches))
+
+	for _, match := range matches {
+		dtos = append(dtos, &ProfileMatchDto{
+			Profile: FromProfile(&match.Profile, detailed(&match.Profile)),
+			Rank:    match.Rank,
+			Snippet: match.Snippet,
+		})
+	}
+
+	return dtos
+}
+
+func ShortFromProfile(profile *model.Profile) *ProfileShortDto {
+	if profile == nil {
+		return nil
+	}
+
+	var dto = &ProfileShortDto{Login: profile.Login, Avatar: optionalId(profile.Avatar)}
+
+	dto.ShortNamedInfo.From(profile)
+
+	return dto
+}
+
+// ToModel maps the visible fields back to a profile, internal columns stay zero
+func (d *ProfileDto) ToModel() *model.Profile {
+	var profile = &model.Profile{
+		Login:        d.Login,
+		FistName:     d.FirstName,
+		MiddleName:   d.MiddleName,
+		LastName:     d.LastName,
+		Private:      d.Private,
+		PrimaryEmail: d.PrimaryEmail,
+		Phone:        d.Phone,
+		PhoneE164:    d.PhoneNumber,
+		Tags:         d.Tags,
+		Biography:    d.Biography,
+		Company:      d.Company,
+		Location:     d.Location,
+	}
+
+	profile.ID = d.ID
+
+	if d.Avatar != nil {
+		profile.Avatar = *d.Avatar
+	}
+
+	if d.Created != nil {
+		profile.Created = *d.Created
+	}
+
+	if d.Changed != nil {
+		profile.Changed = *d.Changed
+	}
+
+	if d.Verified != nil {
+		profile.EmailVerified = *d.Verified
+	}
+
+	if d.PhoneVerified != nil {
+		profile.PhoneVerified = *d.PhoneVerified
+	}
+
+	for _, email := range d.Emails {
+		profile.Emails = append(profile.Emails, email.ToModel(profile.ID))
+	}
+
+	profile.Version = d.Version
+
+	return profile
+}
+
+// FromEmail maps an address of a profile
+func FromEmail(email *model.ProfileEmail) *EmailDto {
+	if email == nil {
+		return nil
+	}
+
+	var dto = &EmailDto{Email: email.Email, Verified: optionalTime(email.Verified), Primary: email.Primary}
+
+	dto.IdInfo.From(email)
+
+	return dto
+}
+
+// FromEmails maps the addresses of a profile, nil when none were loaded
+func FromEmails(emails []*model.ProfileEmail) []*EmailDto {
+	if emails == nil {
+		return nil
+	}
+
+	var dtos = make([]*EmailDto, 0, len(emails))
+
+	for _, email := range emails {
+		dtos = append(dtos, FromEmail(email))
+	}
+
+	return dtos
+}
+
+// ToModel maps the address back for the profile
+func (d *EmailDto) ToModel(profileID uuid.UUID) *model.ProfileEmail {
+	var email = &model.ProfileEmail{ProfileID: profileID, Email: d.Email, Primary: d.Primary}
+
+	email.ID = d.ID
+
+	if d.Verified != nil {
+		email.Verified = *d.Verified
+	}
+
+	return email
+}
+
+// ToModel new profile built from the request
+func (r *CreateProfileRequest) ToModel() *model.Profile {
+	var profile = &model.Profile{}
+
+	r.ApplyTo(profile)
+
+	return profile
+}
+
+// FromVerification maps a pending verification, nil when there is none
+func FromVerification(verification *model.EmailVerification) *EmailVerificationDto {
+	if verification == nil {
+		return nil
+	}
+	return &EmailVerificationDto{Email: verification.Email, Expires: verification.Expires}
+}
+
+// FromPhoneVerification maps a texted verification, nil when there is none
+func FromPhoneVerification(verification *model.PhoneVerification) *PhoneVerificationDto {
+	if verification == nil {
+		return nil
+	}
+	return &PhoneVerificationDto{Phone: verification.Phone, Expires: verification.Expires}
+}
+
+// ApplyTo replaces the user editable fields of the profile, an empty PrimaryEmail clears it
+func (r *CreateProfileRequest) ApplyTo(profile *model.Profile) {
+	profile.Login = r.Login
+	profile.FistName = r.FirstName
+	profile.MiddleName = r.MiddleName
+	profile.LastName = r.LastName
+	profile.Private = r.Private == nil || *r.Private
+	profile.Phone = r.Phone
+	profile.Tags = r.Tags
+	profile.Biography = r.Biography
+	profile.Company = r.Company
+	profile.Location = r.Location
+
+	if r.PrimaryEmail == "" {
+		clearEmail(profile)
+	}
+}
+
+// ApplyTo sets the fields present in the request, an empty PrimaryEmail clears it
+func (r *UpdateProfileRequest) ApplyTo(profile *model.Profile) {
+	apply(&profile.Login, r.Login)
+	apply(&profile.FistName, r.FirstName)
+	apply(&profile.MiddleName, r.MiddleName)
+	apply(&profile.LastName, r.LastName)
+	apply(&profile.Private, r.Private)
+	apply(&profile.Phone, r.Phone)
+	apply(&profile.Tags, r.Tags)
+	apply(&profile.Biography, r.Biography)
+	apply(&profile.Company, r.Company)
+	apply(&profile.Location, r.Location)
+
+	if r.PrimaryEmail != nil && *r.PrimaryEmail == "" {
+		clearEmail(profile)
+	}
+}
+
+// RequestedEmail primary email asked for, verified before it is stored, empty when it is cleared
+func (r *CreateProfileRequest) RequestedEmail() string {
+	return r.PrimaryEmail
+}
+
+// RequestedEmail primary email asked for, empty when it is left unchanged or cleared
+func (r *UpdateProfileRequest) RequestedEmail() string {
+	if r.PrimaryEmail == nil {
+		return ""
+	}
+	return *r.PrimaryEmail
+}
+
+// clearEmail removing an address needs no confirmation
+func clearEmail(profile *model.Profile) {
+	profile.PrimaryEmail = ""
+	profile.EmailVerified = time.Time{}
+}
+
+func apply[T any](dest *T, value *T) {
+	if value != nil {
+		*dest = *value
+	}
+}
+
+func optionalId(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
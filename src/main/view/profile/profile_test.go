@@ -0,0 +1,183 @@
+package profile
+
+import (
+	"cabinet/src/main/model"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareProfile(private bool) *model.Profile {
+	var profile = &model.Profile{
+		Login:        "login1",
+		FistName:     "John",
+		MiddleName:   "Doe",
+		LastName:     "Smith",
+		Private:      private,
+		PrimaryEmail: "john@smith.com",
+		Phone:        "(202) 555-0143",
+		PhoneE164:    "+12025550143",
+		Tags:         []string{"tag1"},
+		Biography:    "An poor John",
+		Company:      "Acme",
+		Location:     "Nowhere",
+		ExternalID:   uuid.New(),
+		Avatar:       uuid.New(),
+		Metadata:     map[string]any{"aaa": "bbb"},
+	}
+
+	profile.ID = uuid.New()
+	profile.Created = time.Now().UTC()
+	profile.Changed = time.Now().UTC()
+
+	var secondary = &model.ProfileEmail{ProfileID: profile.ID, Email: "john@doe.com"}
+	secondary.ID = uuid.New()
+	profile.Emails = []*model.ProfileEmail{secondary}
+
+	return profile
+}
+
+func TestFromProfile(test *testing.T) {
+	var profile = prepareProfile(false)
+
+	assert.Nil(test, FromProfile(nil, false))
+
+	var dto = FromProfile(profile, false)
+
+	assert.Equal(test, profile.ID, dto.ID)
+	assert.Equal(test, profile.FistName, dto.FirstName)
+	assert.Equal(test, profile.FullName(), dto.FullName)
+	assert.Equal(test, profile.PrimaryEmail, dto.PrimaryEmail)
+	assert.Equal(test, profile.Company, dto.Company)
+	assert.Equal(test, profile.Avatar, *dto.Avatar)
+	assert.Equal(test, profile.Created, *dto.Created)
+	assert.Equal(test, "john@doe.com", dto.Emails[0].Email)
+	assert.Nil(test, dto.Emails[0].Verified)
+
+	content, err := json.Marshal(dto)
+
+	assert.NoError(test, err)
+	assert.NotContains(test, string(content), profile.ExternalID.String())
+	assert.NotContains(test, string(content), "aaa")
+
+	slog.Info("TestFromProfile success", slog.String("content", string(content)))
+}
+
+func TestFromPrivateProfile(test *testing.T) {
+	var profile = prepareProfile(true)
+
+	var dto = FromProfile(profile, false)
+
+	assert.Equal(test, profile.ID, dto.ID)
+	assert.Equal(test, profile.Login, dto.Login)
+	assert.Equal(test, profile.FullName(), dto.FullName)
+	assert.True(test, dto.Private)
+	assert.Empty(test, dto.PrimaryEmail)
+	assert.Empty(test, dto.Emails)
+	assert.Empty(test, dto.Phone)
+	assert.Empty(test, dto.PhoneNumber)
+	assert.Empty(test, dto.Company)
+	assert.Nil(test, dto.Created)
+
+	content, err := json.Marshal(dto)
+
+	assert.NoError(test, err)
+	assert.NotContains(test, string(content), "primaryEmail")
+	assert.NotContains(test, string(content), "phone")
+
+	dto = FromProfile(profile, true)
+
+	assert.Equal(test, profile.PrimaryEmail, dto.PrimaryEmail)
+	assert.Equal(test, profile.Phone, dto.Phone)
+	assert.Equal(test, profile.PhoneE164, dto.PhoneNumber)
+	assert.Nil(test, dto.PhoneVerified)
+
+	var dtos = FromProfiles([]*model.Profile{profile, prepareProfile(false)}, func(*model.Profile) bool { return false })
+
+	assert.Equal(test, 2, len(dtos))
+	assert.Empty(test, dtos[0].PrimaryEmail)
+	assert.NotEmpty(test, dtos[1].PrimaryEmail)
+
+	slog.Info("TestFromPrivateProfile success")
+}
+
+func TestShortFromProfile(test *testing.T) {
+	var profile = prepareProfile(true)
+
+	var dto = ShortFromProfile(profile)
+
+	assert.Equal(test, profile.ID, dto.ID)
+	assert.Equal(test, profile.FullName(), dto.Name)
+	assert.Equal(test, profile.Login, dto.Login)
+	assert.Equal(test, profile.Avatar, *dto.Avatar)
+
+	profile.Avatar = uuid.Nil
+
+	assert.Nil(test, ShortFromProfile(profile).Avatar)
+	assert.Nil(test, ShortFromProfile(nil))
+
+	slog.Info("TestShortFromProfile success")
+}
+
+func TestProfileRequests(test *testing.T) {
+	var create = &CreateProfileRequest{}
+
+	err := json.Unmarshal([]byte(`{"login": "login1", "firstName": "John", "primaryEmail": "john@smith.com"}`), create)
+
+	assert.NoError(test, err)
+
+	var profile = create.ToModel()
+
+	assert.Equal(test, "login1", profile.Login)
+	assert.Equal(test, "John", profile.FistName)
+	assert.True(test, profile.Private)
+	assert.Empty(test, profile.PrimaryEmail) // stored once verified
+	assert.Equal(test, "john@smith.com", create.RequestedEmail())
+
+	var public = false
+	create.Private = &public
+
+	assert.False(test, create.ToModel().Private)
+
+	var update = &UpdateProfileRequest{}
+
+	err = json.Unmarshal([]byte(`{"company": "Acme", "tags": []}`), update)
+
+	assert.NoError(test, err)
+
+	update.ApplyTo(profile)
+
+	assert.Equal(test, "Acme", profile.Company)
+	assert.Equal(test, "login1", profile.Login)
+	assert.NotNil(test, profile.Tags)
+	assert.Empty(test, profile.Tags)
+
+	profile.PrimaryEmail = "john@smith.com"
+	profile.EmailVerified = time.Now()
+
+	err = json.Unmarshal([]byte(`{"primaryEmail": ""}`), update)
+
+	assert.NoError(test, err)
+
+	update.ApplyTo(profile)
+
+	assert.Empty(test, update.RequestedEmail())
+	assert.Empty(test, profile.PrimaryEmail)
+	assert.True(test, profile.EmailVerified.IsZero())
+
+	var stored = prepareProfile(false)
+	var roundTrip = FromProfile(stored, true).ToModel()
+
+	assert.Equal(test, stored.ID, roundTrip.ID)
+	assert.Equal(test, stored.Login, roundTrip.Login)
+	assert.Equal(test, stored.Emails, roundTrip.Emails)
+	assert.Equal(test, stored.Avatar, roundTrip.Avatar)
+	assert.Empty(test, roundTrip.ExternalID)
+	assert.Nil(test, roundTrip.Metadata)
+
+	slog.Info("TestProfileRequests success")
+}
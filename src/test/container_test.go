@@ -1,26 +1,25 @@
 package test
 
 import (
+	"cabinet/src/main/datasource"
+	"cabinet/src/main/migrations"
 	"cabinet/src/main/model"
+	"cabinet/src/main/repository"
+	"cabinet/src/main/repository/common"
 	"context"
-	"io"
+	"errors"
 	"log/slog"
 	"os"
-	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 	"github.com/stapelberg/postgrestest"
 	"github.com/stretchr/testify/assert"
-	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dbfixture"
-	"github.com/uptrace/bun/dialect/pgdialect"
-	"github.com/uptrace/bun/extra/bundebug"
 )
 
-const MigrationsPath = "../main/migrations"
-
 func TestM(t *testing.T) {
 	ctx := context.Background()
 	pgt, err := postgrestest.Start(ctx)
@@ -32,40 +31,44 @@ func TestM(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, sqlDb)
 
-	err = sqlDb.Ping()
+	var cfg = datasource.DefaultConfig()
+	cfg.Debug = true
+
+	ds := datasource.NewFromDB(ctx, sqlDb, cfg)
+
+	err = ds.Ping(ctx)
 
-	bunDb := bun.NewDB(sqlDb, pgdialect.New())
+	assert.NoError(t, err)
+
+	bunDb := ds.Db
 
 	bunDb.RegisterModel((*model.Profile)(nil))
 	bunDb.RegisterModel((*model.Attachment)(nil))
 
-	bunDb.AddQueryHook(bundebug.NewQueryHook(
-		bundebug.WithVerbose(true),
-	))
-
 	defer pgt.Cleanup()
 
 	t.Run("Migrations", func(t *testing.T) {
-		dir, err2 := os.ReadDir(MigrationsPath)
-		assert.NoError(t, err2)
-
-		for _, d := range dir {
-			file, err := os.Open(filepath.Join(MigrationsPath, d.Name()))
-			migration, err := io.ReadAll(file)
-
-			slog.Info(string(migration))
-
-			assert.NoError(t, err)
+		migrator, err := migrations.New(bunDb)
+		assert.NoError(t, err)
 
-			slog.Info("Reading migration ok", slog.Any("name", d.Name()))
+		applied, err := migrator.Up(ctx)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, applied)
 
-			_, err = sqlDb.Exec(string(migration))
+		applied, err = migrator.Up(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, applied)
 
-			assert.NoError(t, err)
+		statuses, err := migrator.Status(ctx)
+		assert.NoError(t, err)
 
-			slog.Info("Loading migration ok", slog.Any("name", d.Name()))
+		for _, status := range statuses {
+			assert.NotNil(t, status.Applied)
+			assert.False(t, status.Modified)
 		}
 
+		slog.Info("Applying migrations ok")
+
 		fixture := dbfixture.New(bunDb, dbfixture.WithTruncateTables())
 		err = fixture.Load(ctx, os.DirFS("./template"), "profiles.yaml")
 
@@ -102,30 +105,35 @@ func TestM(t *testing.T) {
 
 	t.Run("Operate profile", func(t *testing.T) {
 		var profiles []model.Profile
+		var profileRepo = repository.NewProfileRepo(ds)
 
 		err = bunDb.NewSelect().Model(&profiles).Scan(ctx)
 
 		var profile = prepareProfileEntity()
 		profile.Login = profiles[0].Login
 
-		_, err = bunDb.NewInsert().Model(profile).Exec(ctx)
+		var uniqueErr *common.UniqueViolationError
 
-		assert.Error(t, err)
+		err = profileRepo.Create(ctx, profile)
+
+		assert.True(t, errors.As(err, &uniqueErr))
+		assert.Equal(t, "Login", uniqueErr.Field)
 
 		slog.Error(err.Error())
 
 		profile.Login = profiles[0].Login + "new"
 		profile.PrimaryEmail = profiles[0].PrimaryEmail
 
-		_, err = bunDb.NewInsert().Model(profile).Exec(ctx)
+		err = profileRepo.Create(ctx, profile)
 
-		assert.Error(t, err)
+		assert.True(t, errors.As(err, &uniqueErr))
+		assert.Equal(t, "PrimaryEmail", uniqueErr.Field)
 
 		slog.Error(err.Error())
 
 		profile.PrimaryEmail = profiles[0].PrimaryEmail + "New"
 
-		_, err = bunDb.NewInsert().Model(profile).Exec(ctx)
+		err = profileRepo.Create(ctx, profile)
 
 		assert.NoError(t, err)
 
@@ -137,19 +145,67 @@ func TestM(t *testing.T) {
 		assert.NotEmpty(t, profiles)
 		assert.Equal(t, len(profiles), 3)
 
+		found, err := profileRepo.FindByLogin(ctx, profile.Login)
+
+		assert.NoError(t, err)
+		assert.Equal(t, profile.ID, found.ID)
+
+		matches, err := profileRepo.Search(ctx, profile.Login, 0, 10)
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, matches.Entities)
+
 		profile.Metadata = map[string]interface{}{}
 		profile.Metadata["aaa"] = "bbb"
 		profile.Metadata["bbb"] = "ccc"
 		profile.Metadata["ddd"] = "eee"
 		profile.Tags = []string{"tag1", "tag2"}
 
-		_, err = bunDb.NewUpdate().Model(profile).Where("id = ?", profiles[2].ID).Exec(ctx)
+		err = profileRepo.Update(ctx, profile)
+
+		assert.NoError(t, err)
+
+		var stale = *found
+
+		assert.True(t, errors.Is(profileRepo.Update(ctx, &stale), common.ErrConcurrentModification))
+
+		filter, err := profileRepo.Filter(&common.Spec{Conditions: []common.Condition{
+			{Field: "tags", Op: common.OpContains, Value: "tag1"},
+			{Field: "metadata.aaa", Op: common.OpEq, Value: "bbb"},
+		}})
+
+		assert.NoError(t, err)
+
+		tagged, err := profileRepo.FindPage(ctx, filter, 0, 10)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(tagged.Entities))
+		assert.Equal(t, profile.ID, tagged.Entities[0].ID)
+
+		err = profileRepo.Delete(ctx, profile.ID)
+
+		assert.NoError(t, err)
+
+		_, err = profileRepo.FindById(ctx, profile.ID)
+
+		assert.True(t, errors.Is(err, common.ErrNotFound))
+
+		deleted, err := profileRepo.FindDeleted(ctx, nil, 0, 10)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(deleted.Entities))
+
+		assert.NoError(t, profileRepo.Restore(ctx, profile.ID))
+
+		_, err = profileRepo.FindById(ctx, profile.ID)
 
 		assert.NoError(t, err)
+		assert.NoError(t, profileRepo.Delete(ctx, profile.ID))
 
-		_, err = bunDb.NewDelete().Model(profile).Where("id = ?", profiles[2].ID).Exec(ctx)
+		purged, err := profileRepo.Purge(ctx, time.Now().Add(time.Minute))
 
 		assert.NoError(t, err)
+		assert.Equal(t, int64(1), purged)
 
 		err = bunDb.NewSelect().Model(&profiles).Scan(ctx)
 
@@ -186,10 +242,18 @@ func TestM(t *testing.T) {
 
 		assert.Equal(t, 3, count)
 
-		bunDb.NewSelect().Model(attachment).Relation("Profile").Where("s3_key = ?", attachment.S3Key).Scan(ctx)
+		var attachmentRepo = repository.NewAttachmentRepo(ds)
+
+		attachment, err = attachmentRepo.FindByS3Key(ctx, attachment.S3Key, repository.WithProfile())
 
+		assert.NoError(t, err)
 		assert.Equal(t, attachment.UserID, attachment.Profile.ID)
 
+		public, err := attachmentRepo.ListByUserID(ctx, profiles[0].ID, false)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(public))
+
 		attachment.Metadata = map[string]interface{}{}
 
 		attachment.Metadata["aaa"] = "bbb"